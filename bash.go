@@ -9,7 +9,7 @@ import (
 
 var bashSource = fmt.Sprintf(`
 _bosh_comp() {
-	local output="$({{.Executable}} complete {{.Debug}} -- ${COMP_WORDS[@]::$COMP_CWORD} "${COMP_WORDS[$COMP_CWORD]}")"
+	local output="$(COMP_LINE="$COMP_LINE" COMP_POINT="$COMP_POINT" COMP_TYPE="$COMP_TYPE" {{.Executable}} complete {{.Debug}} -- "${COMP_WORDS[@]::$COMP_CWORD}" "${COMP_WORDS[$COMP_CWORD]}")"
 	COMPREPLY=()
 	local TMPIFS="$IFS"
 	IFS=''
@@ -19,6 +19,9 @@ _bosh_comp() {
     fi
 	done <<< "$output"
 	IFS="$TMPIFS"
+	if [[ -n "$BOSH_COMPLETE_BASH_MENU" ]]; then
+		compopt -o nosort 2>/dev/null
+	fi
 }
 
 complete -o nospace -F _bosh_comp {{.Bosh}}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//The COMP_TYPE that bash sets when Tab is pressed again to list the candidates
+const bashListingCompType = "63"
+
+//bashMenuEnabled returns whether bash should get its candidates grouped by
+// kind and, when it's only listing them, described. It can be turned on with
+// BOSH_COMPLETE_BASH_MENU=true
+func bashMenuEnabled() bool {
+	val := os.Getenv("BOSH_COMPLETE_BASH_MENU")
+	if val == "" {
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Write("Ignoring invalid value for BOSH_COMPLETE_BASH_MENU: `%s'", val)
+		return false
+	}
+
+	return enabled
+}
+
+//groupByKind sorts the candidates by kind, and then by sort key
+func groupByKind(candidates []candidate) []candidate {
+	ret := append([]candidate{}, candidates...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if kindOrder[a.kind()] != kindOrder[b.kind()] {
+			return kindOrder[a.kind()] < kindOrder[b.kind()]
+		}
+		return a.sortKey() < b.sortKey()
+	})
+	return ret
+}
+
+//bashListing lays the candidates out with their descriptions lined up after
+// them. readline shows control characters as they are, so there's no coloring
+// them here
+func bashListing(candidates []candidate) []string {
+	width := 0
+	for _, c := range candidates {
+		if n := utf8.RuneCountInString(c.display()); n > width {
+			width = n
+		}
+	}
+
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		line := c.display()
+		if c.Description != "" {
+			padding := strings.Repeat(" ", width-utf8.RuneCountInString(line))
+			line += padding + "  (" + truncateDescription(c.Description) + ")"
+		}
+		ret = append(ret, line)
+	}
+
+	return ret
+}
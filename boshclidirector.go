@@ -0,0 +1,582 @@
+//go:build boshcli
+// +build boshcli
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	boshdir "github.com/cloudfoundry/bosh-cli/v7/director"
+	boshuaa "github.com/cloudfoundry/bosh-cli/v7/uaa"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//Builds made with -tags boshcli can use the bosh CLI's own director client,
+// with backend: bosh-cli
+func init() {
+	newBoshCLIDirector = func(ctx compContext) (director.Director, error) {
+		c, err := getBoshClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		boshCLIDirectorsLock.Lock()
+		defer boshCLIDirectorsLock.Unlock()
+		key := clientKey(ctx)
+		if b, found := boshCLIDirectors[key]; found {
+			return b, nil
+		}
+
+		ret, err := newBoshCLIClient(c)
+		if err != nil {
+			return nil, err
+		}
+		boshCLIDirectors[key] = ret
+		return ret, nil
+	}
+}
+
+var boshCLIDirectors = map[string]*boshCLIDirector{}
+var boshCLIDirectorsLock sync.Mutex
+
+//boshCLIDirector answers for the director through the bosh CLI's director
+// package, which does its own auth (UAA included) and honours
+// $BOSH_ALL_PROXY. Nothing it gets is cached except the candidates made from
+// it, as the package offers no way to revalidate a response
+type boshCLIDirector struct {
+	//Where the credentials, CA, and address came from, worked out the same way
+	// as for the API
+	client *director.Client
+	dir    boshdir.Director
+}
+
+var _ director.Director = (*boshCLIDirector)(nil)
+
+func newBoshCLIClient(c *director.Client) (*boshCLIDirector, error) {
+	logger := boshlog.NewLogger(boshlog.LevelNone)
+
+	address := c.URL
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "https://" + address
+	}
+	dirConfig, err := boshdir.NewConfigFromURL(address)
+	if err != nil {
+		return nil, err
+	}
+	dirConfig.CACert = c.CACert
+	if dirConfig.Port == 0 {
+		dirConfig.Port = c.DefaultPort
+	}
+
+	//The auth type is needed before auth can be done, as it is with the CLI
+	anonymous, err := boshdir.NewFactory(logger).New(dirConfig, boshdir.NewNoopTaskReporter(), boshdir.NewNoopFileReporter())
+	if err != nil {
+		return nil, err
+	}
+	info, err := anonymous.Info()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Auth.Type != "uaa" {
+		dirConfig.Client, dirConfig.ClientSecret = c.ClientID, c.ClientSecret
+		if c.ClientID == "" {
+			dirConfig.Client, dirConfig.ClientSecret = c.Username, c.Password
+		}
+	} else {
+		uaaURL, _ := info.Auth.Options["url"].(string)
+		uaaConfig, err := boshuaa.NewConfigFromURL(uaaURL)
+		if err != nil {
+			return nil, err
+		}
+		uaaConfig.CACert = c.UAACACert
+		uaaConfig.Client, uaaConfig.ClientSecret = c.ClientID, c.ClientSecret
+		if c.ClientID == "" {
+			uaaConfig.Client, uaaConfig.ClientSecret = c.UAAClientID, c.UAAClientSecret
+		}
+
+		uaa, err := boshuaa.NewFactory(logger).New(uaaConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.ClientID != "" {
+			dirConfig.TokenFunc = boshuaa.NewClientTokenSession(uaa).TokenFunc
+		} else if c.RefreshToken != "" {
+			dirConfig.TokenFunc = boshuaa.NewAccessTokenSession(uaa.NewStaleAccessToken(c.RefreshToken)).TokenFunc
+		} else {
+			return nil, fmt.Errorf("No client credentials or refresh token for the bosh CLI's client to auth with. Log in with the bosh CLI first")
+		}
+	}
+
+	dir, err := boshdir.NewFactory(logger).New(dirConfig, boshdir.NewNoopTaskReporter(), boshdir.NewNoopFileReporter())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Write("asking %s through the bosh CLI's director client", address)
+	return &boshCLIDirector{client: c, dir: dir}, nil
+}
+
+//boshCLICall runs fn, giving up on it if ctx is done first. The bosh CLI's
+// client can't be cancelled, so whatever it was doing carries on regardless
+func boshCLICall(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *boshCLIDirector) Address() string {
+	return b.client.Address()
+}
+
+func (b *boshCLIDirector) Identity() string {
+	return b.client.Identity()
+}
+
+//CurrentAccessToken is always empty, as the bosh CLI's client keeps its
+// tokens to itself
+func (b *boshCLIDirector) CurrentAccessToken() string {
+	return ""
+}
+
+//GetMany does nothing, as the bosh CLI's client has nowhere to get paths
+// ready in
+func (b *boshCLIDirector) GetMany(context.Context, []string, time.Duration) error {
+	return nil
+}
+
+func (b *boshCLIDirector) Info(ctx context.Context) (*director.Info, error) {
+	var info boshdir.Info
+	err := boshCLICall(ctx, func() (err error) {
+		info, err = b.dir.Info()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &director.Info{Name: info.Name, Version: info.Version}
+	ret.Auth.Type = info.Auth.Type
+	ret.Auth.Options.URL, _ = info.Auth.Options["url"].(string)
+	return ret, nil
+}
+
+func (b *boshCLIDirector) deployment(ctx context.Context, name string) (boshdir.Deployment, error) {
+	var ret boshdir.Deployment
+	err := boshCLICall(ctx, func() (err error) {
+		ret, err = b.dir.FindDeployment(name)
+		return err
+	})
+	return ret, err
+}
+
+func (b *boshCLIDirector) Deployments(ctx context.Context) ([]director.Deployment, error) {
+	ret := []director.Deployment{}
+	err := boshCLICall(ctx, func() error {
+		deployments, err := b.dir.Deployments()
+		if err != nil {
+			return err
+		}
+
+		for _, deployment := range deployments {
+			teams, err := deployment.Teams()
+			if err != nil {
+				return err
+			}
+			ret = append(ret, director.Deployment{Name: deployment.Name(), Teams: teams})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//Instances leaves out the indexes and VM CIDs, which the bosh CLI's client
+// only has with the full details
+func (b *boshCLIDirector) Instances(ctx context.Context, deployment string) ([]director.Instance, error) {
+	dep, err := b.deployment(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Instance{}
+	err = boshCLICall(ctx, func() error {
+		instances, err := dep.Instances()
+		if err != nil {
+			return err
+		}
+
+		for _, instance := range instances {
+			ret = append(ret, director.Instance{
+				AgentID:   instance.AgentID,
+				Job:       instance.Group,
+				ID:        instance.ID,
+				ExpectsVM: instance.ExpectsVM,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) InstanceDetails(ctx context.Context, deployment string) ([]director.InstanceDetails, error) {
+	dep, err := b.deployment(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.InstanceDetails{}
+	err = boshCLICall(ctx, func() error {
+		infos, err := dep.InstanceInfos()
+		if err != nil {
+			return err
+		}
+
+		for _, info := range infos {
+			details := director.InstanceDetails{
+				Job:      info.JobName,
+				ID:       info.ID,
+				Ignore:   info.Ignore,
+				DiskCIDs: info.DiskIDs,
+			}
+			if info.Index != nil {
+				details.Index = *info.Index
+			}
+			for _, process := range info.Processes {
+				details.Processes = append(details.Processes, struct {
+					Name string `json:"name"`
+				}{Name: process.Name})
+			}
+			ret = append(ret, details)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) OrphanedDisks(ctx context.Context) ([]director.OrphanedDisk, error) {
+	ret := []director.OrphanedDisk{}
+	err := boshCLICall(ctx, func() error {
+		disks, err := b.dir.OrphanedDisks()
+		if err != nil {
+			return err
+		}
+
+		for _, disk := range disks {
+			ret = append(ret, director.OrphanedDisk{
+				CID:        disk.CID(),
+				Deployment: disk.Deployment().Name(),
+				Instance:   disk.InstanceName(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) Problems(ctx context.Context, deployment string) ([]director.Problem, error) {
+	dep, err := b.deployment(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Problem{}
+	err = boshCLICall(ctx, func() error {
+		problems, err := dep.ScanForProblems()
+		if err != nil {
+			return err
+		}
+
+		for _, problem := range problems {
+			this := director.Problem{ID: problem.ID, Description: problem.Description}
+			for _, resolution := range problem.Resolutions {
+				name := ""
+				if resolution.Name != nil {
+					name = *resolution.Name
+				}
+				this.Resolutions = append(this.Resolutions, struct {
+					Name string `json:"name"`
+					Plan string `json:"plan"`
+				}{Name: name, Plan: resolution.Plan})
+			}
+			ret = append(ret, this)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) Snapshots(ctx context.Context, deployment string) ([]director.Snapshot, error) {
+	dep, err := b.deployment(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Snapshot{}
+	err = boshCLICall(ctx, func() error {
+		snapshots, err := dep.Snapshots()
+		if err != nil {
+			return err
+		}
+
+		for _, snapshot := range snapshots {
+			this := director.Snapshot{
+				Job:       snapshot.Job,
+				CID:       snapshot.CID,
+				CreatedAt: snapshot.CreatedAt.Format(time.RFC3339),
+			}
+			if snapshot.Index != nil {
+				this.Index = *snapshot.Index
+			}
+			ret = append(ret, this)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) Variables(ctx context.Context, deployment string) ([]director.Variable, error) {
+	dep, err := b.deployment(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Variable{}
+	err = boshCLICall(ctx, func() error {
+		variables, err := dep.Variables()
+		if err != nil {
+			return err
+		}
+
+		for _, variable := range variables {
+			ret = append(ret, director.Variable{ID: variable.ID, Name: variable.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) Errands(ctx context.Context, deployment string) ([]director.Errand, error) {
+	dep, err := b.deployment(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Errand{}
+	err = boshCLICall(ctx, func() error {
+		errands, err := dep.Errands()
+		if err != nil {
+			return err
+		}
+
+		for _, errand := range errands {
+			ret = append(ret, director.Errand{Name: errand.Name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) Configs(ctx context.Context, configType string, latest bool) ([]director.Config, error) {
+	//The bosh CLI's client asks for only the current configs when limited to
+	// one of each
+	limit := 1
+	if !latest {
+		limit = defaultTaskLimit
+	}
+
+	ret := []director.Config{}
+	err := boshCLICall(ctx, func() error {
+		configs, err := b.dir.ListConfigs(limit, boshdir.ConfigsFilter{Type: configType})
+		if err != nil {
+			return err
+		}
+
+		for _, config := range configs {
+			ret = append(ret, director.Config{
+				ID:        config.ID,
+				Name:      config.Name,
+				Type:      config.Type,
+				Content:   config.Content,
+				CreatedAt: config.CreatedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//Tasks asks for the current tasks when asked for particular states, which
+// are then picked out of them, and the recent ones otherwise
+func (b *boshCLIDirector) Tasks(ctx context.Context, filter director.TaskFilter) ([]director.Task, error) {
+	ret := []director.Task{}
+	err := boshCLICall(ctx, func() error {
+		tasksFilter := boshdir.TasksFilter{Deployment: filter.Deployment}
+		var tasks []boshdir.Task
+		var err error
+		if len(filter.States) > 0 {
+			tasks, err = b.dir.CurrentTasks(tasksFilter)
+		} else {
+			tasks, err = b.dir.RecentTasks(filter.Limit, tasksFilter)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			if !taskInStates(task.State(), filter.States) {
+				continue
+			}
+			ret = append(ret, director.Task{
+				ID:          task.ID(),
+				State:       task.State(),
+				Description: task.Description(),
+				Result:      task.Result(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (b *boshCLIDirector) Events(ctx context.Context, deployment, beforeID string) ([]director.Event, error) {
+	ret := []director.Event{}
+	err := boshCLICall(ctx, func() error {
+		events, err := b.dir.Events(boshdir.EventsFilter{Deployment: deployment, BeforeID: beforeID})
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			ret = append(ret, director.Event{
+				ID:         event.ID(),
+				User:       event.User(),
+				Action:     event.Action(),
+				ObjectType: event.ObjectType(),
+				ObjectName: event.ObjectName(),
+				Task:       event.TaskID(),
+				Deployment: event.DeploymentName(),
+				Instance:   event.Instance(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//Releases groups the bosh CLI's releases, which it has one of for each
+// version, by name
+func (b *boshCLIDirector) Releases(ctx context.Context) ([]director.Release, error) {
+	ret := []director.Release{}
+	err := boshCLICall(ctx, func() error {
+		releases, err := b.dir.Releases()
+		if err != nil {
+			return err
+		}
+
+		for _, release := range releases {
+			if len(ret) == 0 || ret[len(ret)-1].Name != release.Name() {
+				ret = append(ret, director.Release{Name: release.Name()})
+			}
+			last := &ret[len(ret)-1]
+			last.Versions = append(last.Versions, director.ReleaseVersion{
+				Version:           release.Version().String(),
+				CurrentlyDeployed: release.VersionMark("*") != "",
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//Stemcells takes the stemcells that the bosh CLI's client marks as in use as
+// being used by some deployment, without knowing which
+func (b *boshCLIDirector) Stemcells(ctx context.Context) ([]director.Stemcell, error) {
+	ret := []director.Stemcell{}
+	err := boshCLICall(ctx, func() error {
+		stemcells, err := b.dir.Stemcells()
+		if err != nil {
+			return err
+		}
+
+		for _, stemcell := range stemcells {
+			this := director.Stemcell{
+				Name:            stemcell.Name(),
+				OperatingSystem: stemcell.OSName(),
+				Version:         stemcell.Version().String(),
+			}
+			if stemcell.VersionMark("*") != "" {
+				this.Deployments = append(this.Deployments, struct {
+					Name string `json:"name"`
+				}{})
+			}
+			ret = append(ret, this)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
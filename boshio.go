@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+const boshIOURL = "https://bosh.io"
+
+//What bosh.io knows about changes slowly, so it's kept around for a long time
+const boshIOCacheTTL = 24 * time.Hour
+
+//boshIOEnabled returns whether completions may ask bosh.io about stemcells and
+// releases. They don't unless told to, with boshio: true in the tool config or
+// BOSH_COMPLETE_BOSHIO=true
+func boshIOEnabled() bool {
+	return envBool("BOSH_COMPLETE_BOSHIO", getToolConfig().BoshIO)
+}
+
+//boshIOGet fetches the given bosh.io API path into output, by way of the disk
+// cache. If bosh.io can't be reached, whatever was cached last will do
+func boshIOGet(ctx context.Context, path string, output interface{}) error {
+	key := director.Key{Director: boshIOURL, Path: path}
+	entry, cached := loadDiskEntry(key)
+	if cached && time.Since(entry.Fetched) < boshIOCacheTTL {
+		log.Write("bosh.io cache hit: %s", path)
+		return entry.Decode(output)
+	}
+
+	if offlineMode() {
+		if cached {
+			log.Write("bosh.io offline cache hit: %s", path)
+			return entry.Decode(output)
+		}
+		return &director.OfflineError{Path: boshIOURL + path}
+	}
+
+	body, err := boshIOFetch(ctx, path)
+	if err != nil {
+		if cached {
+			log.Write("Could not reach bosh.io (%s). Using what was cached %s ago", err, time.Since(entry.Fetched))
+			return entry.Decode(output)
+		}
+		return err
+	}
+
+	entry = director.Entry{Body: body, Fetched: time.Now()}
+	saveDiskEntry(key, entry)
+	return entry.Decode(output)
+}
+
+func boshIOFetch(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", boshIOURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	//bosh.io is out on the internet, so it's not reached through a jumpbox
+	// meant for the director
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("bosh.io returned status %d for %s", resp.StatusCode, path)
+	}
+
+	return ioutil.ReadAll(director.LimitReader(resp.Body, path, maxResponseSize()))
+}
+
+//The stemcells published on bosh.io, which has no way of listing them
+var boshIOStemcellNames = func() []string {
+	ret := []string{}
+	for _, infrastructure := range []string{
+		"aws-xen-hvm", "azure-hyperv", "google-kvm", "openstack-kvm",
+		"vsphere-esxi", "warden-boshlite",
+	} {
+		for _, osName := range []string{"ubuntu-jammy", "ubuntu-bionic", "ubuntu-xenial"} {
+			ret = append(ret, fmt.Sprintf("bosh-%s-%s-go_agent", infrastructure, osName))
+		}
+	}
+	return ret
+}()
+
+type boshIOStemcell struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func boshIOStemcellVersions(ctx context.Context, name string) ([]string, error) {
+	stemcells := []boshIOStemcell{}
+	err := boshIOGet(ctx, "/api/v1/stemcells/"+name, &stemcells)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(stemcells))
+	for _, stemcell := range stemcells {
+		ret = append(ret, stemcell.Version)
+	}
+	return ret, nil
+}
+
+//compBoshIOURL offers URLs under base, by way of whatever's been typed of
+// base itself, then the names, and then the versions of the named thing
+func compBoshIOURL(ctx compContext, base string, names []string, versions func(context.Context, string) ([]string, error)) ([]candidate, error) {
+	token := ctx.CurrentToken
+	if !boshIOEnabled() || token == "" {
+		return nil, nil
+	}
+
+	//All the candidates start with what's typed, and these are often merged
+	// with file paths, which aren't filtered on the way out
+	matching := func(candidates []string) []string {
+		ret := []string{}
+		for _, candidate := range candidates {
+			if strings.HasPrefix(candidate, token) {
+				ret = append(ret, candidate)
+			}
+		}
+		return ret
+	}
+
+	if !strings.HasPrefix(token, base) {
+		if strings.HasPrefix(base, token) {
+			dontAddSpace = true
+			return []candidate{{Value: base}}, nil
+		}
+		return nil, nil
+	}
+
+	rest := token[len(base):]
+	if i := strings.Index(rest, "?v="); i >= 0 {
+		name := rest[:i]
+		vers, err := versions(ctx.Context, name)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]string, 0, len(vers))
+		for _, version := range vers {
+			ret = append(ret, fmt.Sprintf("%s%s?v=%s", base, name, version))
+		}
+		return values(matching(ret)), nil
+	}
+
+	//Without a version, the latest one is what gets uploaded
+	dontAddSpace = true
+	ret := make([]string, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, base+name)
+	}
+	return values(matching(ret)), nil
+}
+
+func compBoshIOStemcells(ctx compContext) ([]candidate, error) {
+	return compBoshIOURL(ctx, boshIOURL+"/d/stemcells/", boshIOStemcellNames, boshIOStemcellVersions)
+}
+
+//compBoshIOStemcellVersions offers the versions on bosh.io of the stemcell
+// being uploaded, if it's named by --name or a bosh.io URL
+func compBoshIOStemcellVersions(ctx compContext) ([]candidate, error) {
+	if !boshIOEnabled() {
+		return nil, nil
+	}
+
+	name, found := ctx.FlagValue("--name")
+	if !found && len(ctx.Args) > 0 {
+		name = strings.TrimPrefix(ctx.Args[0], boshIOURL+"/d/stemcells/")
+		name = strings.SplitN(name, "?", 2)[0]
+		found = name != ctx.Args[0]
+	}
+	if !found {
+		return nil, nil
+	}
+
+	vers, err := boshIOStemcellVersions(ctx.Context, name)
+	return values(vers), err
+}
+
+//Well known releases on bosh.io, which has far too many to list them all
+var boshIOReleaseNames = []string{
+	"github.com/bosh-prometheus/node-exporter-boshrelease",
+	"github.com/bosh-prometheus/prometheus-boshrelease",
+	"github.com/cloudfoundry/bosh",
+	"github.com/cloudfoundry/bosh-aws-cpi-release",
+	"github.com/cloudfoundry/bosh-azure-cpi-release",
+	"github.com/cloudfoundry/bosh-dns-release",
+	"github.com/cloudfoundry/bosh-google-cpi-release",
+	"github.com/cloudfoundry/bosh-openstack-cpi-release",
+	"github.com/cloudfoundry/bosh-vsphere-cpi-release",
+	"github.com/cloudfoundry/bosh-warden-cpi-release",
+	"github.com/cloudfoundry/bpm-release",
+	"github.com/cloudfoundry/capi-release",
+	"github.com/cloudfoundry/cf-networking-release",
+	"github.com/cloudfoundry/cflinuxfs4-release",
+	"github.com/cloudfoundry/credhub-release",
+	"github.com/cloudfoundry/diego-release",
+	"github.com/cloudfoundry/garden-runc-release",
+	"github.com/cloudfoundry/haproxy-boshrelease",
+	"github.com/cloudfoundry/log-cache-release",
+	"github.com/cloudfoundry/loggregator-release",
+	"github.com/cloudfoundry/nats-release",
+	"github.com/cloudfoundry/os-conf-release",
+	"github.com/cloudfoundry/postgres-release",
+	"github.com/cloudfoundry/routing-release",
+	"github.com/cloudfoundry/syslog-release",
+	"github.com/cloudfoundry/uaa-release",
+}
+
+type boshIORelease struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+func boshIOReleaseVersions(ctx context.Context, name string) ([]string, error) {
+	releases := []boshIORelease{}
+	err := boshIOGet(ctx, "/api/v1/releases/"+name, &releases)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(releases))
+	for _, release := range releases {
+		ret = append(ret, release.Version)
+	}
+	return ret, nil
+}
+
+func compBoshIOReleases(ctx compContext) ([]candidate, error) {
+	return compBoshIOURL(ctx, boshIOURL+"/d/", boshIOReleaseNames, boshIOReleaseVersions)
+}
+
+//compBoshIOReleaseVersions offers the versions on bosh.io of the release
+// being uploaded, if it's given as a bosh.io URL
+func compBoshIOReleaseVersions(ctx compContext) ([]candidate, error) {
+	if !boshIOEnabled() || len(ctx.Args) == 0 || !strings.HasPrefix(ctx.Args[0], boshIOURL+"/d/") {
+		return nil, nil
+	}
+
+	name := strings.TrimPrefix(ctx.Args[0], boshIOURL+"/d/")
+	vers, err := boshIOReleaseVersions(ctx.Context, strings.SplitN(name, "?", 2)[0])
+	return values(vers), err
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//ttlClass returns the kind of data the given director path holds, as named
+// under ttl in the tool config, or "" if it isn't one that can be configured
+func ttlClass(path string) string {
+	if path == director.AuthPath {
+		return "auth"
+	}
+
+	path = strings.SplitN(path, "?", 2)[0]
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 3 && parts[0] == "deployments" && parts[2] == "instances" {
+		return "instances"
+	}
+
+	switch parts[0] {
+	case "deployments", "releases", "stemcells", "tasks", "events", "configs":
+		return parts[0]
+	}
+	return ""
+}
+
+var cacheTTLs map[string]time.Duration
+var cacheTTLsOnce sync.Once
+
+//getCacheTTLs returns the TTLs set in the tool config, by kind of data.
+// Anything that isn't a duration (like 90s or 10m) is ignored
+func getCacheTTLs() map[string]time.Duration {
+	cacheTTLsOnce.Do(func() {
+		cacheTTLs = map[string]time.Duration{}
+		for class, val := range getToolConfig().TTL {
+			ttl, err := time.ParseDuration(val)
+			if err != nil || ttl <= 0 {
+				log.Write("Ignoring invalid ttl for %s in config: `%s'", class, val)
+				continue
+			}
+			cacheTTLs[class] = ttl
+		}
+	})
+
+	return cacheTTLs
+}
+
+//cacheTTLFor returns how long the response for path is good for
+func cacheTTLFor(path string) time.Duration {
+	ttls := getCacheTTLs()
+	if ttl, found := ttls[ttlClass(path)]; found {
+		return ttl
+	}
+	//How a director does auth is good for much longer than anything else
+	if path == director.AuthPath {
+		return director.DefaultAuthTTL
+	}
+	if ttl, found := ttls["default"]; found {
+		return ttl
+	}
+	return director.DefaultTTL
+}
+
+//shortestCacheTTL returns the shortest TTL that any response may have
+func shortestCacheTTL() time.Duration {
+	ret := cacheTTLFor("")
+	for _, ttl := range getCacheTTLs() {
+		if ttl < ret {
+			ret = ttl
+		}
+	}
+	return ret
+}
+
+//How much room cached responses get, in memory and again on disk, unless told
+// otherwise
+const defaultCacheSize = 64 * 1024 * 1024
+
+//maxCacheSize is the most that cached responses may take up before the least
+// recently used ones are thrown out. It can be set with
+// $BOSH_COMPLETE_CACHE_SIZE, in bytes or with a K, M, or G suffix
+func maxCacheSize() int64 {
+	val := os.Getenv("BOSH_COMPLETE_CACHE_SIZE")
+	if val == "" {
+		return defaultCacheSize
+	}
+
+	ret, err := parseSize(val)
+	if err != nil || ret <= 0 {
+		log.Write("Ignoring invalid value for BOSH_COMPLETE_CACHE_SIZE: `%s'", val)
+		return defaultCacheSize
+	}
+
+	return ret
+}
+
+//Candidates that have already been extracted from director responses. This
+// is kept apart from the HTTP cache so that the raw bodies can still be
+// reused by other completers that pull different things out of them
+type candidateKey struct {
+	director   string
+	identity   string
+	kind       string
+	deployment string
+}
+
+type candidateEntry struct {
+	candidates []candidate
+	fetched    time.Time
+}
+
+//The candidate cache only lives in memory. A completion run from the shell
+// exits after one Tab, so outside of the daemon it only saves extracting the
+// same kind twice within a completion. Under the daemon, whose clients (and so
+// what they've extracted) outlive a completion, it saves reworking every
+// response on every Tab. The responses themselves are what's kept on disk
+var candidateCache = map[candidateKey]candidateEntry{}
+var candidateCacheLock sync.Mutex
+
+//Candidates can come from any kind of response, so they're kept no longer
+// than the shortest-lived of them
+func (e candidateEntry) fresh() bool {
+	return time.Since(e.fetched) < shortestCacheTTL()
+}
+
+//cachedCandidates returns the candidates of the given kind previously
+// extracted for this director and deployment, or calls fn to extract them
+// and remembers the result. That only pays off with the daemon, or when a
+// completion asks for the same kind more than once
+func cachedCandidates(ctx compContext, kind string, fn func(director.Director) ([]candidate, error)) ([]candidate, error) {
+	c, err := getDirector(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := candidateKey{director: c.Address(), identity: c.Identity(), kind: kind}
+	if deployments, found := ctx.Flags["--deployment"]; found {
+		key.deployment = deployments[0]
+	}
+
+	candidateCacheLock.Lock()
+	entry, found := candidateCache[key]
+	candidateCacheLock.Unlock()
+	if found && entry.fresh() {
+		log.Write("candidate cache hit: %+v", key)
+		return append([]candidate{}, entry.candidates...), nil
+	}
+	log.Write("candidate cache miss: %+v", key)
+
+	candidates, err := fn(c)
+	if director.IsNotFound(err) || director.IsRecentFailure(err) {
+		//e.g. a deployment that doesn't exist (yet) has nothing to offer, and
+		// that's not worth treating as a failure
+		log.Write("%s", err)
+		candidates, err = []candidate{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candidateCacheLock.Lock()
+	candidateCache[key] = candidateEntry{
+		candidates: append([]candidate{}, candidates...),
+		fetched:    time.Now(),
+	}
+	candidateCacheLock.Unlock()
+
+	return candidates, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//cachedResponse is a response cached on disk, along with what it's known by
+type cachedResponse struct {
+	//The name of the file it's in, which is a hash of its key. The start of
+	// it is enough to tell it apart from the rest
+	ID    string
+	Entry diskEntry
+}
+
+//How much of an ID `cache ls' shows
+const shortIDLength = 12
+
+func (r cachedResponse) shortID() string {
+	if len(r.ID) > shortIDLength {
+		return r.ID[:shortIDLength]
+	}
+	return r.ID
+}
+
+//environmentDirector returns the URL of the director for the given
+// environment (by alias or URL), going by the bosh config, or nothing if no
+// environment is given
+func environmentDirector(envName string) (string, error) {
+	if envName == "" {
+		return "", nil
+	}
+
+	location := os.Getenv("BOSH_CONFIG")
+	if location == "" {
+		location = defaultBoshConfigPath()
+	}
+
+	cfg, err := loadBoshConfig(location)
+	if err != nil {
+		return "", err
+	}
+
+	director, _ := cfg.resolveEnvironment(envName)
+	return director, nil
+}
+
+//listCachedResponses returns the responses cached on disk for the given
+// director, or for every director if it's empty, sorted by director and then
+// path
+func listCachedResponses(director string) ([]cachedResponse, error) {
+	files, err := ioutil.ReadDir(responseCacheDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ret := []cachedResponse{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		entry := diskEntry{}
+		err = readCacheFile(fmt.Sprintf("%s/%s", responseCacheDir(), file.Name()), &entry)
+		if err != nil {
+			log.Write("Could not read cache file `%s': %s", file.Name(), err)
+			continue
+		}
+		if director != "" && entry.Director != director {
+			continue
+		}
+
+		ret = append(ret, cachedResponse{ID: strings.TrimSuffix(file.Name(), ".json"), Entry: entry})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Entry.Director != ret[j].Entry.Director {
+			return ret[i].Entry.Director < ret[j].Entry.Director
+		}
+		if ret[i].Entry.Path != ret[j].Entry.Path {
+			return ret[i].Entry.Path < ret[j].Entry.Path
+		}
+		return ret[i].Entry.Identity < ret[j].Entry.Identity
+	})
+
+	return ret, nil
+}
+
+//doCacheLs lists what's cached on disk for each director (or just the given
+// environment's): the endpoint, who it was fetched as, how old it is, how big
+// it is, and how much longer it's fresh for
+func doCacheLs() {
+	director, err := environmentDirector(opts.Cache.Ls.Environment)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	responses, err := listCachedResponses(director)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not list cache: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(responses) == 0 {
+		fmt.Printf("No cached responses\n")
+		return
+	}
+
+	//Lines without tabs end a block of columns, so each director's responses
+	// line up among themselves
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	lastDirector := ""
+	for _, r := range responses {
+		if r.Entry.Director != lastDirector {
+			if lastDirector != "" {
+				fmt.Fprintf(w, "\n")
+			}
+			fmt.Fprintf(w, "%s\n", r.Entry.Director)
+			fmt.Fprintf(w, "  ID\tPATH\tAS\tAGE\tSIZE\tFRESH FOR\n")
+			lastDirector = r.Entry.Director
+		}
+
+		age := time.Since(r.Entry.Fetched)
+		freshFor := "stale"
+		if left := cacheTTLFor(r.Entry.Path) - age; left > 0 {
+			freshFor = left.Round(time.Second).String()
+		}
+
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d bytes\t%s\n",
+			r.shortID(), r.Entry.Path, r.Entry.Identity, age.Round(time.Second), len(r.Entry.Body), freshFor)
+	}
+	_ = w.Flush()
+}
+
+//doCacheShow prints the body of a cached response, given the start of its ID
+// (from `cache ls') or its endpoint. JSON is pretty printed
+func doCacheShow(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: bosh-complete cache show [-e <environment>] <id or path>\n")
+		os.Exit(1)
+	}
+	want := args[0]
+
+	director, err := environmentDirector(opts.Cache.Show.Environment)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	responses, err := listCachedResponses(director)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not list cache: %s\n", err)
+		os.Exit(1)
+	}
+
+	matches := []cachedResponse{}
+	for _, r := range responses {
+		if strings.HasPrefix(r.ID, want) || r.Entry.Path == want {
+			matches = append(matches, r)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		fmt.Fprintf(os.Stderr, "Nothing cached matches `%s'. See `bosh-complete cache ls'\n", want)
+		os.Exit(1)
+	case 1:
+	default:
+		fmt.Fprintf(os.Stderr, "`%s' matches more than one cached response:\n", want)
+		for _, r := range matches {
+			fmt.Fprintf(os.Stderr, "  %s %s %s (as %s)\n", r.shortID(), r.Entry.Director, r.Entry.Path, r.Entry.Identity)
+		}
+		os.Exit(1)
+	}
+
+	body := matches[0].Entry.Body
+	pretty := bytes.Buffer{}
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	fmt.Printf("%s\n", bytes.TrimRight(body, "\n"))
+}
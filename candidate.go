@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+)
+
+//candidate is one thing that the word being completed could become, and
+// everything the shells (and fzf) can make of it
+type candidate struct {
+	//What goes on the command line
+	Value string
+	//What's shown in menus, if it isn't just the value (e.g. the value before
+	// the rest of a comma separated list was put back on the front of it)
+	Display string
+	//A few words on what the value is, for shells that can show them
+	Description string
+	//What sort of thing the value is (see the kinds below). Left empty, it's
+	// worked out from the value
+	Kind string
+	//What the candidate sorts by when candidates are grouped, if not the
+	// value (e.g. task IDs, which should sort as numbers)
+	SortKey string
+}
+
+//The kinds of candidate, in the order they're listed
+const (
+	valueKind = "value"
+	dirKind   = "dir"
+	flagKind  = "flag"
+)
+
+var kindOrder = map[string]int{valueKind: 0, dirKind: 1, flagKind: 2}
+
+func describe(value, description string) candidate {
+	return candidate{Value: value, Description: description}
+}
+
+//values makes candidates of bare values
+func values(vals []string) []candidate {
+	ret := make([]candidate, 0, len(vals))
+	for _, val := range vals {
+		ret = append(ret, candidate{Value: val})
+	}
+	return ret
+}
+
+func (c candidate) display() string {
+	if c.Display != "" {
+		return c.Display
+	}
+	return c.Value
+}
+
+func (c candidate) kind() string {
+	switch {
+	case c.Kind != "":
+		return c.Kind
+	case strings.HasPrefix(c.Value, "-"):
+		return flagKind
+	case strings.HasSuffix(c.Value, "/"):
+		return dirKind
+	}
+	return valueKind
+}
+
+func (c candidate) sortKey() string {
+	if c.SortKey != "" {
+		return c.SortKey
+	}
+	return c.Value
+}
+
+//withValue returns the candidate with its value changed, still showing what
+// it showed before
+func (c candidate) withValue(value string) candidate {
+	c.Display = c.display()
+	c.Value = value
+	return c
+}
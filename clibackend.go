@@ -0,0 +1,775 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//newBoshCLIDirector makes a director.Director out of the bosh CLI's own
+// director client, in builds made with -tags boshcli. It's nil otherwise
+var newBoshCLIDirector func(ctx compContext) (director.Director, error)
+
+//directorBackend is how completions get at the director: api to ask it
+// directly, cli to run `bosh --json' instead, auto to ask it directly and
+// fall back to the CLI when that doesn't work, or bosh-cli to go through the
+// bosh CLI's director client (if this was built with it). It can be set with
+// backend in the tool config or BOSH_COMPLETE_BACKEND
+func directorBackend() string {
+	backend := envString("BOSH_COMPLETE_BACKEND", getToolConfig().Backend)
+	switch backend {
+	case "", "api":
+		return "api"
+	case "cli", "auto":
+		return backend
+	case "bosh-cli":
+		if newBoshCLIDirector != nil {
+			return backend
+		}
+		log.Write("Not built with the bosh CLI's director client (-tags boshcli). Asking the director directly")
+		return "api"
+	}
+
+	log.Write("Ignoring unknown backend `%s'", backend)
+	return "api"
+}
+
+//cliDirector answers for the director by running the bosh CLI and reading its
+// --json output, for wherever the CLI can get to the director and
+// bosh-complete can't (e.g. through a proxy or auth that only the CLI is set
+// up for). What it gets back is cached like responses from the director are,
+// under the path that the director would have answered it at
+type cliDirector struct {
+	path     string
+	address  string
+	identity string
+	//The flags that pick the environment and say how to auth to it, passed on
+	// to every command, and the environment that they're run in
+	flags []string
+	env   []string
+
+	lock    sync.Mutex
+	outputs map[string]cliCached
+}
+
+//cliCached is what the CLI said, and when it said it
+type cliCached struct {
+	output  cliOutput
+	fetched time.Time
+}
+
+var _ director.Director = (*cliDirector)(nil)
+
+var cliDirectors = map[string]*cliDirector{}
+var cliDirectorsLock sync.Mutex
+
+//getCLIDirector returns a cliDirector for the environment in ctx, or an error
+// if there's no bosh CLI to run
+func getCLIDirector(ctx compContext) (*cliDirector, error) {
+	cliDirectorsLock.Lock()
+	defer cliDirectorsLock.Unlock()
+
+	key := clientKey(ctx)
+	if c, found := cliDirectors[key]; found {
+		return c, nil
+	}
+
+	envName, found := ctx.FlagValue("--environment")
+	if !found {
+		return nil, fmt.Errorf("env not given")
+	}
+
+	path, err := exec.LookPath("bosh")
+	if err != nil {
+		return nil, fmt.Errorf("No bosh CLI to ask the director through: %s", err)
+	}
+
+	ret := &cliDirector{path: path, address: envName, outputs: map[string]cliCached{}}
+	ret.flags, ret.env = boshCLIFlags(ctx, "--environment", "--client", "--client-secret", "--ca-cert", "--config")
+
+	//What the CLI says is cached apart from what the director says, as the two
+	// aren't shaped alike
+	ret.identity = "cli"
+	if cfg, err := getBoshConfig(ctx); err == nil {
+		var env *boshEnvironment
+		ret.address, env = cfg.resolveEnvironment(envName)
+		if env != nil && env.Username != "" {
+			ret.identity = "cli:user:" + env.Username
+		}
+	}
+	if client, found := ctx.FlagValue("--client"); found {
+		ret.identity = "cli:client:" + client
+	}
+
+	log.Write("asking the bosh CLI at %s about %s", path, ret.address)
+	cliDirectors[key] = ret
+
+	return ret, nil
+}
+
+//boshCLIFlags returns the given flags from ctx as arguments to the bosh CLI,
+// along with the environment to run it in. The client secret is passed in the
+// environment instead, where it can't be seen in the list of processes. The
+// environment is nil when the CLI can have this one's
+func boshCLIFlags(ctx compContext, names ...string) ([]string, []string) {
+	var args, env []string
+	for _, name := range names {
+		val, found := ctx.FlagValue(name)
+		if !found {
+			continue
+		}
+		if name == "--client-secret" {
+			env = append(os.Environ(), "BOSH_CLIENT_SECRET="+val)
+			continue
+		}
+		args = append(args, name+"="+val)
+	}
+	return args, env
+}
+
+func (c *cliDirector) Address() string {
+	return c.address
+}
+
+func (c *cliDirector) Identity() string {
+	return c.identity
+}
+
+//CurrentAccessToken is always empty, as the CLI keeps its tokens to itself
+func (c *cliDirector) CurrentAccessToken() string {
+	return ""
+}
+
+//GetMany does nothing, as there's no asking the CLI for several things at
+// once
+func (c *cliDirector) GetMany(context.Context, []string, time.Duration) error {
+	return nil
+}
+
+//cliOutput is what the bosh CLI prints when given --json
+type cliOutput struct {
+	Tables []struct {
+		Rows []map[string]string `json:"Rows"`
+	} `json:"Tables"`
+	Lines []string `json:"Lines"`
+}
+
+//rows returns the rows of every table in the output, with the dashes that the
+// CLI shows in empty cells taken out
+func (o cliOutput) rows() []map[string]string {
+	ret := []map[string]string{}
+	for _, table := range o.Tables {
+		for _, row := range table.Rows {
+			for k, v := range row {
+				v = strings.TrimSpace(v)
+				if v == "-" {
+					v = ""
+				}
+				row[k] = v
+			}
+			ret = append(ret, row)
+		}
+	}
+	return ret
+}
+
+//run runs the bosh CLI with the given arguments, for what the director would
+// have answered at path with
+func (c *cliDirector) run(ctx context.Context, path string, args ...string) (cliOutput, error) {
+	//Completers ask for the same things at once, and the CLI is slow enough
+	// that it's better to wait for what another is already running
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	//The daemon keeps these for as long as it runs, so they go stale like
+	// anything else that's cached
+	if kept, found := c.outputs[path]; found && (offlineMode() || time.Since(kept.fetched) < cacheTTLFor(path)) {
+		stats.Hit(path)
+		return kept.output, nil
+	}
+
+	output := cliOutput{}
+	key := director.Key{Director: c.address, Identity: c.identity, Path: path}
+	entry, cached := diskStore{}.Load(key)
+	if cached && (offlineMode() || time.Since(entry.Fetched) < cacheTTLFor(path)) {
+		if json.Unmarshal(entry.Body, &output) == nil {
+			log.Write("CLI cache hit: %s", path)
+			stats.Hit(path)
+			c.outputs[path] = cliCached{output: output, fetched: entry.Fetched}
+			return output, nil
+		}
+	}
+	if offlineMode() {
+		return cliOutput{}, &director.OfflineError{Path: path}
+	}
+
+	args = append(append(append([]string{}, c.flags...), args...), "--json", "--non-interactive")
+	log.Write("running bosh %s", strings.Join(args, " "))
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, c.path, args...)
+	cmd.Env = c.env
+	body, err := cmd.Output()
+	took := time.Since(start)
+	//Failures are still printed as JSON, with what went wrong in the lines
+	jsonErr := json.Unmarshal(body, &output)
+	if err != nil {
+		if jsonErr == nil && len(output.Lines) > 0 {
+			err = fmt.Errorf("%s", strings.Join(output.Lines, ": "))
+		}
+		err = fmt.Errorf("Could not get %s from the bosh CLI: %s", path, err)
+		stale := cliOutput{}
+		if cached && staleOnError() && json.Unmarshal(entry.Body, &stale) == nil {
+			log.Write("%s. Using the stale cached response (fetched %s ago)", err, time.Since(entry.Fetched))
+			stats.Hit(path)
+			//Kept as if just fetched, so that the CLI isn't run again for
+			// every completion while it's failing
+			c.outputs[path] = cliCached{output: stale, fetched: time.Now()}
+			return stale, nil
+		}
+		return cliOutput{}, err
+	}
+	if jsonErr != nil {
+		return cliOutput{}, fmt.Errorf("Could not parse bosh CLI output for %s: %s", path, jsonErr)
+	}
+
+	stats.Fetched(path, int64(len(body)), took)
+	fetched := time.Now()
+	diskStore{}.Save(key, director.Entry{Body: body, Fetched: fetched})
+	c.outputs[path] = cliCached{output: output, fetched: fetched}
+
+	return output, nil
+}
+
+//splitInstance splits the job/id (or job/index) that the CLI shows instances
+// as
+func splitInstance(instance string) (string, string) {
+	parts := strings.SplitN(instance, "/", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	//Older CLIs put the index after the ID, like `router/0a1b2c3d (0)'
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return parts[0], ""
+	}
+	return parts[0], fields[0]
+}
+
+//cliList splits the cells that the CLI puts several values in, a line (or a
+// comma) each
+func cliList(cell string) []string {
+	return strings.Fields(strings.Replace(cell, ",", " ", -1))
+}
+
+func (c *cliDirector) Info(ctx context.Context) (*director.Info, error) {
+	output, err := c.run(ctx, "/info", "environment")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &director.Info{}
+	for _, row := range output.rows() {
+		ret.Name = row["name"]
+		ret.Version = row["version"]
+	}
+	return ret, nil
+}
+
+func (c *cliDirector) Deployments(ctx context.Context) ([]director.Deployment, error) {
+	output, err := c.run(ctx, director.DeploymentsPath, "deployments")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Deployment{}
+	for _, row := range output.rows() {
+		ret = append(ret, director.Deployment{Name: row["name"], Teams: cliList(row["team_s"])})
+	}
+	return ret, nil
+}
+
+func (c *cliDirector) Instances(ctx context.Context, deployment string) ([]director.Instance, error) {
+	output, err := c.run(ctx, director.InstancesPath(deployment), "--deployment="+deployment, "instances", "--details")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Instance{}
+	for _, row := range output.rows() {
+		job, id := splitInstance(row["instance"])
+		index, _ := strconv.Atoi(row["index"])
+		ret = append(ret, director.Instance{
+			AgentID: row["agent_id"],
+			CID:     row["vm_cid"],
+			Job:     job,
+			Index:   index,
+			ID:      id,
+			//The CLI doesn't say whether an instance should have a VM, only
+			// whether it has one
+			ExpectsVM: row["vm_cid"] != "",
+		})
+	}
+	return ret, nil
+}
+
+func (c *cliDirector) InstanceDetails(ctx context.Context, deployment string) ([]director.InstanceDetails, error) {
+	output, err := c.run(ctx, director.InstanceDetailsPath(deployment), "--deployment="+deployment, "instances", "--details", "--ps")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.InstanceDetails{}
+	for _, row := range output.rows() {
+		//Processes get a row of their own, under their instance's
+		if row["instance"] == "" || row["instance"] == "~" {
+			if process := row["process"]; process != "" && len(ret) > 0 {
+				last := &ret[len(ret)-1]
+				last.Processes = append(last.Processes, struct {
+					Name string `json:"name"`
+				}{Name: process})
+			}
+			continue
+		}
+
+		job, id := splitInstance(row["instance"])
+		index, _ := strconv.Atoi(row["index"])
+		ignore, _ := strconv.ParseBool(row["ignore"])
+		ret = append(ret, director.InstanceDetails{
+			Job:      job,
+			ID:       id,
+			Index:    index,
+			Ignore:   ignore,
+			DiskCIDs: cliList(row["disk_cids"]),
+		})
+	}
+	return ret, nil
+}
+
+func (c *cliDirector) OrphanedDisks(ctx context.Context) ([]director.OrphanedDisk, error) {
+	output, err := c.run(ctx, director.OrphanedDisksPath, "disks", "--orphaned")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.OrphanedDisk{}
+	for _, row := range output.rows() {
+		ret = append(ret, director.OrphanedDisk{
+			CID:        row["disk_cid"],
+			Deployment: row["deployment"],
+			Instance:   row["instance"],
+		})
+	}
+	return ret, nil
+}
+
+//Problems is an error, as the CLI can report problems but not the
+// resolutions that they can be dealt with by, and those are what's completed
+func (c *cliDirector) Problems(ctx context.Context, deployment string) ([]director.Problem, error) {
+	return nil, fmt.Errorf("Could not get %s from the bosh CLI: it doesn't list resolutions", director.ProblemsPath(deployment))
+}
+
+func (c *cliDirector) Snapshots(ctx context.Context, deployment string) ([]director.Snapshot, error) {
+	output, err := c.run(ctx, director.SnapshotsPath(deployment), "--deployment="+deployment, "snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Snapshot{}
+	for _, row := range output.rows() {
+		job, id := splitInstance(row["instance"])
+		//Instances are shown by ID; only old directors give an index
+		index, _ := strconv.Atoi(id)
+		ret = append(ret, director.Snapshot{Job: job, Index: index, CID: row["cid"], CreatedAt: row["created_at"]})
+	}
+	return ret, nil
+}
+
+func (c *cliDirector) Variables(ctx context.Context, deployment string) ([]director.Variable, error) {
+	output, err := c.run(ctx, director.VariablesPath(deployment), "--deployment="+deployment, "variables")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Variable{}
+	for _, row := range output.rows() {
+		ret = append(ret, director.Variable{ID: row["id"], Name: row["name"]})
+	}
+	return ret, nil
+}
+
+func (c *cliDirector) Errands(ctx context.Context, deployment string) ([]director.Errand, error) {
+	output, err := c.run(ctx, director.ErrandsPath(deployment), "--deployment="+deployment, "errands")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Errand{}
+	for _, row := range output.rows() {
+		ret = append(ret, director.Errand{Name: row["name"]})
+	}
+	return ret, nil
+}
+
+//Configs lists configs with `bosh configs', which doesn't show their content.
+// The content of the current configs is then got a config at a time; that of
+// older revisions is left out, as nothing completed from history needs it
+func (c *cliDirector) Configs(ctx context.Context, configType string, latest bool) ([]director.Config, error) {
+	args := []string{"configs"}
+	if configType != "" {
+		args = append(args, "--type="+configType)
+	}
+	if !latest {
+		args = append(args, fmt.Sprintf("--recent=%d", defaultTaskLimit))
+	}
+	output, err := c.run(ctx, director.ConfigsPath(configType, latest), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Config{}
+	for _, row := range output.rows() {
+		//The current revisions are starred in the history
+		config := director.Config{
+			ID:        strings.TrimSuffix(row["id"], "*"),
+			Name:      row["name"],
+			Type:      row["type"],
+			CreatedAt: row["created_at"],
+		}
+
+		if latest {
+			content, err := c.run(ctx, "/configs/"+config.ID, "config", config.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, contentRow := range content.rows() {
+				config.Content = contentRow["content"]
+			}
+		}
+
+		ret = append(ret, config)
+	}
+	return ret, nil
+}
+
+//Tasks lists the CLI's current tasks when asked for particular states, and
+// its recent ones otherwise
+func (c *cliDirector) Tasks(ctx context.Context, filter director.TaskFilter) ([]director.Task, error) {
+	args := []string{"tasks"}
+	if filter.Deployment != "" {
+		args = append(args, "--deployment="+filter.Deployment)
+	}
+	if len(filter.States) == 0 && filter.Limit > 0 {
+		args = append(args, fmt.Sprintf("--recent=%d", filter.Limit))
+	}
+	output, err := c.run(ctx, director.TasksPath(filter), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Task{}
+	for _, row := range output.rows() {
+		if !taskInStates(row["state"], filter.States) {
+			continue
+		}
+
+		id, err := strconv.Atoi(row["id"])
+		if err != nil {
+			continue
+		}
+		ret = append(ret, director.Task{ID: id, State: row["state"], Description: row["description"], Result: row["result"]})
+	}
+	return ret, nil
+}
+
+//taskInStates returns whether a task in the given state is one of those
+// asked for, which is any of them if none were
+func taskInStates(state string, states []string) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return len(states) == 0
+}
+
+func (c *cliDirector) Events(ctx context.Context, deployment, beforeID string) ([]director.Event, error) {
+	args := []string{"events"}
+	if deployment != "" {
+		args = append(args, "--deployment="+deployment)
+	}
+	if beforeID != "" {
+		args = append(args, "--before-id="+beforeID)
+	}
+	output, err := c.run(ctx, director.EventsPath(deployment, beforeID), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Event{}
+	for _, row := range output.rows() {
+		//Events that finish another are shown as `ID <- parent ID'
+		fields := strings.Fields(row["id"])
+		if len(fields) == 0 {
+			continue
+		}
+		ret = append(ret, director.Event{
+			ID:         fields[0],
+			User:       row["user"],
+			Action:     row["action"],
+			ObjectType: row["object_type"],
+			ObjectName: row["object_name"],
+			Task:       row["task_id"],
+			Deployment: row["deployment"],
+			Instance:   row["instance"],
+		})
+	}
+	return ret, nil
+}
+
+//Releases groups the CLI's release versions by release. Versions in use are
+// starred, and uncommitted ones have a + after them
+func (c *cliDirector) Releases(ctx context.Context) ([]director.Release, error) {
+	output, err := c.run(ctx, director.ReleasesPath, "releases")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Release{}
+	for _, row := range output.rows() {
+		version := strings.TrimSuffix(row["version"], "*")
+		deployed := version != row["version"]
+		version = strings.TrimSuffix(version, "+")
+
+		if len(ret) == 0 || ret[len(ret)-1].Name != row["name"] {
+			ret = append(ret, director.Release{Name: row["name"]})
+		}
+		last := &ret[len(ret)-1]
+		last.Versions = append(last.Versions, director.ReleaseVersion{Version: version, CurrentlyDeployed: deployed})
+	}
+	return ret, nil
+}
+
+//Stemcells takes the stemcells that the CLI stars as being used by some
+// deployment, without knowing which
+func (c *cliDirector) Stemcells(ctx context.Context) ([]director.Stemcell, error) {
+	output, err := c.run(ctx, director.StemcellsPath, "stemcells")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []director.Stemcell{}
+	for _, row := range output.rows() {
+		version := strings.TrimSuffix(row["version"], "*")
+		stemcell := director.Stemcell{Name: row["name"], OperatingSystem: row["os"], Version: version}
+		if version != row["version"] {
+			stemcell.Deployments = append(stemcell.Deployments, struct {
+				Name string `json:"name"`
+			}{})
+		}
+		ret = append(ret, stemcell)
+	}
+	return ret, nil
+}
+
+//fallbackDirector asks the director directly, and the bosh CLI once that
+// stops working. The CLI is slow enough that, once it's been needed, it's
+// used for a while instead of trying the director again on every call
+type fallbackDirector struct {
+	api *director.Client
+	cli *cliDirector
+
+	lock      sync.Mutex
+	apiFailed time.Time
+}
+
+var _ director.Director = (*fallbackDirector)(nil)
+
+//How long the CLI is used for, once the director has failed
+const fallbackRetryInterval = time.Minute
+
+var fallbackDirectors = map[string]*fallbackDirector{}
+var fallbackDirectorsLock sync.Mutex
+
+//getFallbackDirector returns the fallbackDirector for the client and CLI
+// made for ctx, so that it remembers the director failing from one call to
+// the next
+func getFallbackDirector(ctx compContext, api *director.Client, cli *cliDirector) *fallbackDirector {
+	fallbackDirectorsLock.Lock()
+	defer fallbackDirectorsLock.Unlock()
+
+	key := clientKey(ctx)
+	if f, found := fallbackDirectors[key]; found {
+		return f
+	}
+
+	ret := &fallbackDirector{api: api, cli: cli}
+	fallbackDirectors[key] = ret
+	return ret
+}
+
+func (f *fallbackDirector) useAPI() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return time.Since(f.apiFailed) >= fallbackRetryInterval
+}
+
+//try calls fn with the director, unless it failed recently, and with the CLI
+// if the director fails in a way that the CLI might not. What the director
+// says doesn't exist, the CLI won't find either
+func (f *fallbackDirector) try(ctx context.Context, fn func(director.Director) error) error {
+	if f.useAPI() {
+		err := fn(f.api)
+		if err == nil || director.IsNotFound(err) || director.IsOffline(err) || director.IsTooLarge(err) || ctx.Err() != nil {
+			return err
+		}
+
+		log.Write("Asking the bosh CLI instead: %s", err)
+		f.lock.Lock()
+		f.apiFailed = time.Now()
+		f.lock.Unlock()
+	}
+
+	return fn(f.cli)
+}
+
+func (f *fallbackDirector) Address() string {
+	return f.api.Address()
+}
+
+func (f *fallbackDirector) Identity() string {
+	return f.api.Identity()
+}
+
+func (f *fallbackDirector) CurrentAccessToken() string {
+	return f.api.CurrentAccessToken()
+}
+
+//GetMany gets paths ready from the director, unless it has already failed.
+// Each call that needs them can fall back on its own if it fails again
+func (f *fallbackDirector) GetMany(ctx context.Context, paths []string, timeout time.Duration) error {
+	if !f.useAPI() {
+		return nil
+	}
+
+	return f.api.GetMany(ctx, paths, timeout)
+}
+
+func (f *fallbackDirector) Info(ctx context.Context) (ret *director.Info, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Info(ctx)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Deployments(ctx context.Context) (ret []director.Deployment, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Deployments(ctx)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Instances(ctx context.Context, deployment string) (ret []director.Instance, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Instances(ctx, deployment)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) InstanceDetails(ctx context.Context, deployment string) (ret []director.InstanceDetails, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.InstanceDetails(ctx, deployment)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) OrphanedDisks(ctx context.Context) (ret []director.OrphanedDisk, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.OrphanedDisks(ctx)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Problems(ctx context.Context, deployment string) (ret []director.Problem, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Problems(ctx, deployment)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Snapshots(ctx context.Context, deployment string) (ret []director.Snapshot, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Snapshots(ctx, deployment)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Variables(ctx context.Context, deployment string) (ret []director.Variable, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Variables(ctx, deployment)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Errands(ctx context.Context, deployment string) (ret []director.Errand, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Errands(ctx, deployment)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Configs(ctx context.Context, configType string, latest bool) (ret []director.Config, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Configs(ctx, configType, latest)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Tasks(ctx context.Context, filter director.TaskFilter) (ret []director.Task, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Tasks(ctx, filter)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Events(ctx context.Context, deployment, beforeID string) (ret []director.Event, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Events(ctx, deployment, beforeID)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Releases(ctx context.Context) (ret []director.Release, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Releases(ctx)
+		return err
+	})
+	return ret, err
+}
+
+func (f *fallbackDirector) Stemcells(ctx context.Context) (ret []director.Stemcell, err error) {
+	err = f.try(ctx, func(d director.Director) error {
+		ret, err = d.Stemcells(ctx)
+		return err
+	})
+	return ret, err
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//fakeBoshScript stands in for the bosh CLI. It keeps the arguments and client
+// secret of each run in $FAKE_BOSH_DIR, and lists the one deployment
+const fakeBoshScript = `#!/bin/sh
+echo "$@" >> "$FAKE_BOSH_DIR/args"
+echo "$BOSH_CLIENT_SECRET" >> "$FAKE_BOSH_DIR/secret"
+echo '{"Tables": [{"Rows": [{"name": "cf", "team_s": ""}]}]}'
+`
+
+//fakeBosh puts a fake bosh CLI first on $PATH, returning the directory that
+// it records what it was given in
+func fakeBosh(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake bosh CLI is a shell script")
+	}
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home+"/cache")
+
+	dir := t.TempDir()
+	err := os.Mkdir(dir+"/bin", 0700)
+	if err != nil {
+		t.Fatalf("Could not make bin dir: %s", err)
+	}
+	err = ioutil.WriteFile(dir+"/bin/bosh", []byte(fakeBoshScript), 0700)
+	if err != nil {
+		t.Fatalf("Could not write fake bosh: %s", err)
+	}
+	t.Setenv("PATH", dir+"/bin:"+os.Getenv("PATH"))
+	t.Setenv("FAKE_BOSH_DIR", dir)
+
+	forget := func() {
+		cliDirectorsLock.Lock()
+		cliDirectors = map[string]*cliDirector{}
+		cliDirectorsLock.Unlock()
+	}
+	forget()
+	t.Cleanup(forget)
+	return dir
+}
+
+//fakeBoshRecord returns what the fake bosh CLI was given as name (args or
+// secret), a line each time it ran
+func fakeBoshRecord(t *testing.T, dir, name string) string {
+	t.Helper()
+	contents, err := ioutil.ReadFile(dir + "/" + name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Could not read %s: %s", name, err)
+	}
+	return string(contents)
+}
+
+//cliDeployments asks the bosh CLI for deployments for the given command line
+func cliDeployments(t *testing.T, args ...string) {
+	t.Helper()
+	resetCompletionState()
+	insertGlobalFlags()
+	ctx, ok := parseContext(append([]string{"bosh"}, args...))
+	if !ok {
+		t.Fatalf("Could not parse %q", args)
+	}
+
+	cli, err := getCLIDirector(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	deployments, err := cli.Deployments(ctx.Context)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(deployments) != 1 || deployments[0].Name != "cf" {
+		t.Errorf("Expected the one deployment, got %+v", deployments)
+	}
+}
+
+func TestCLIDirectorKeepsTheSecretOffTheCommandLine(t *testing.T) {
+	dir := fakeBosh(t)
+
+	cliDeployments(t, "-e", "https://10.0.0.1:25555", "--client", "ci", "--client-secret", "hunter2", "-d", "")
+
+	if args := fakeBoshRecord(t, dir, "args"); strings.Contains(args, "hunter2") || !strings.Contains(args, "--client=ci") {
+		t.Errorf("Expected the client but not its secret in the arguments, got %q", args)
+	}
+	if secret := fakeBoshRecord(t, dir, "secret"); secret != "hunter2\n" {
+		t.Errorf("Expected the secret in the environment, got %q", secret)
+	}
+}
+
+func TestCLIDirectorOutputsGoStale(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  string
+		runs int
+	}{
+		{name: "fresh", ttl: "1h", runs: 1},
+		{name: "stale", ttl: "1ns", runs: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := fakeBosh(t)
+			t.Setenv("BOSH_COMPLETE_CONFIG", writeFile(t, dir, "config.yml", "ttl:\n  deployments: "+test.ttl+"\n"))
+
+			for i := 0; i < 2; i++ {
+				cliDeployments(t, "-e", "https://10.0.0.1:25555", "-d", "")
+			}
+			if got := strings.Count(fakeBoshRecord(t, dir, "args"), "\n"); got != test.runs {
+				t.Errorf("Expected the CLI to run %d times, got %d", test.runs, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//How long to give the bosh CLI to tell us about its flags
+const cliHelpTimeout = 2 * time.Second
+
+//A flag as the bosh CLI's help describes it
+type cliFlag struct {
+	Long       string `json:"long"`
+	Short      string `json:"short,omitempty"`
+	TakesValue bool   `json:"takes_value,omitempty"`
+}
+
+//A command as `bosh help' lists it
+type cliCommand struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+//What one version of the bosh CLI has said about itself
+type cliHelp struct {
+	//nil until `bosh help' has been asked
+	Commands []cliCommand `json:"commands"`
+	//The flags of each command that has been asked about
+	Flags map[string][]cliFlag `json:"flags"`
+}
+
+//cliHelpTable is what's been learned from the bosh CLI's help, kept on disk
+// so that each version's help only gets read once
+type cliHelpTable struct {
+	//Which version each bosh binary is, by cliBinaryKey, so that finding the
+	// version doesn't mean running it every time
+	Binaries map[string]string   `json:"binaries"`
+	Versions map[string]*cliHelp `json:"versions"`
+}
+
+var cliHelpLock sync.Mutex
+
+//cliHelpEnabled returns whether commands and flags should be learned from the
+// bosh CLI's help. It can be turned off with cli_help: false in the tool
+// config or BOSH_COMPLETE_CLI_HELP=false
+func cliHelpEnabled() bool {
+	return envBool("BOSH_COMPLETE_CLI_HELP", orDefault(getToolConfig().CLIHelp, true))
+}
+
+func cliHelpTablePath() string {
+	return fmt.Sprintf("%s/cli-help.json", cacheDir())
+}
+
+func loadCLIHelpTable() cliHelpTable {
+	table := cliHelpTable{}
+	contents, err := ioutil.ReadFile(cliHelpTablePath())
+	if err == nil {
+		err = json.Unmarshal(contents, &table)
+		if err != nil {
+			log.Write("Ignoring unreadable CLI help table: %s", err)
+		}
+	}
+
+	if table.Binaries == nil {
+		table.Binaries = map[string]string{}
+	}
+	if table.Versions == nil {
+		table.Versions = map[string]*cliHelp{}
+	}
+	return table
+}
+
+func saveCLIHelpTable(table cliHelpTable) {
+	contents, err := json.Marshal(table)
+	if err != nil {
+		return
+	}
+
+	err = ensureDir(cacheDir())
+	if err == nil {
+		err = writeFileAtomic(cliHelpTablePath(), contents)
+	}
+	if err != nil {
+		log.Write("Could not save CLI help table: %s", err)
+	}
+}
+
+//cliBinaryKey identifies a particular bosh binary, changing whenever it's
+// replaced by another
+func cliBinaryKey(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s\x00%d\x00%d", path, info.ModTime().UnixNano(), info.Size()), nil
+}
+
+var cliVersionRegex = regexp.MustCompile(`version (\S+)`)
+
+func runCLI(path string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cliHelpTimeout)
+	defer cancel()
+
+	//--help exits non-zero, so only a lack of output counts as failing
+	output, err := exec.CommandContext(ctx, path, args...).Output()
+	if len(output) == 0 && err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+//The options of the command itself come under a heading like
+// `[deploy command options]'
+var cliOptionsHeadingRegex = regexp.MustCompile(`^\[.* command options\]$`)
+var cliOptionRegex = regexp.MustCompile(`^\s+(?:-(\w), )?\s*--([\w-]+)(=?)`)
+
+//parseCLIHelp picks the command's own flags out of its help
+func parseCLIHelp(help []byte) []cliFlag {
+	ret := []cliFlag{}
+	inOptions := false
+	scanner := bufio.NewScanner(bytes.NewReader(help))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cliOptionsHeadingRegex.MatchString(line) {
+			inOptions = true
+			continue
+		}
+		if !inOptions {
+			continue
+		}
+
+		matches := cliOptionRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		ret = append(ret, cliFlag{Long: matches[2], Short: matches[1], TakesValue: matches[3] == "="})
+	}
+
+	return ret
+}
+
+//withCLIHelp hands fn what's been learned about the version of the bosh CLI
+// on the PATH, saving it afterwards if fn says that it learned more. fn isn't
+// called if there's no bosh CLI to ask
+func withCLIHelp(fn func(path, version string, help *cliHelp) bool) {
+	if !cliHelpEnabled() {
+		return
+	}
+
+	path, err := exec.LookPath("bosh")
+	if err != nil {
+		return
+	}
+	key, err := cliBinaryKey(path)
+	if err != nil {
+		return
+	}
+
+	cliHelpLock.Lock()
+	defer cliHelpLock.Unlock()
+
+	table := loadCLIHelpTable()
+	changed := false
+	version, found := table.Binaries[key]
+	if !found {
+		output, err := runCLI(path, "--version")
+		matches := cliVersionRegex.FindSubmatch(output)
+		if err != nil || matches == nil {
+			log.Write("Could not get the bosh CLI's version: %v", err)
+			return
+		}
+		version = string(matches[1])
+		table.Binaries[key] = version
+		changed = true
+	}
+
+	help := table.Versions[version]
+	if help == nil {
+		help = &cliHelp{}
+		table.Versions[version] = help
+	}
+	if help.Flags == nil {
+		help.Flags = map[string][]cliFlag{}
+	}
+
+	if fn(path, version, help) || changed {
+		saveCLIHelpTable(table)
+	}
+}
+
+//cliFlags returns the flags that the bosh CLI says the given command takes,
+// asking it the first time that this version is asked about the command. Any
+// trouble just means there aren't any
+func cliFlags(command string) []cliFlag {
+	var ret []cliFlag
+	withCLIHelp(func(path, version string, help *cliHelp) bool {
+		var found bool
+		ret, found = help.Flags[command]
+		if found {
+			return false
+		}
+
+		output, err := runCLI(path, command, "--help")
+		if err != nil {
+			log.Write("Could not get help for `%s' from the bosh CLI: %s", command, err)
+			return false
+		}
+		ret = parseCLIHelp(output)
+		log.Write("bosh CLI %s says `%s' has %d flags", version, command, len(ret))
+		help.Flags[command] = ret
+		return true
+	})
+
+	return ret
+}
+
+//Commands are listed under `Available commands:', one to a line, with any
+// aliases after them in parentheses
+var cliCommandsHeadingRegex = regexp.MustCompile(`^Available commands:`)
+var cliCommandRegex = regexp.MustCompile(`^  ([a-z][\w-]*)`)
+var cliAliasesRegex = regexp.MustCompile(`\(aliases?: ([^)]*)\)`)
+
+//parseCLICommands picks the commands out of the output of `bosh help'
+func parseCLICommands(help []byte) []cliCommand {
+	ret := []cliCommand{}
+	inCommands := false
+	scanner := bufio.NewScanner(bytes.NewReader(help))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if cliCommandsHeadingRegex.MatchString(line) {
+			inCommands = true
+			continue
+		}
+		if !inCommands {
+			continue
+		}
+
+		matches := cliCommandRegex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		cmd := cliCommand{Name: matches[1]}
+		if aliases := cliAliasesRegex.FindStringSubmatch(line); aliases != nil {
+			for _, alias := range strings.Split(aliases[1], ",") {
+				cmd.Aliases = append(cmd.Aliases, strings.TrimSpace(alias))
+			}
+		}
+		ret = append(ret, cmd)
+	}
+
+	return ret
+}
+
+//cliCommands returns the commands that `bosh help' lists, asking it the first
+// time that this version is asked about
+func cliCommands() []cliCommand {
+	var ret []cliCommand
+	withCLIHelp(func(path, version string, help *cliHelp) bool {
+		if help.Commands != nil {
+			ret = help.Commands
+			return false
+		}
+
+		output, err := runCLI(path, "help")
+		if err != nil {
+			log.Write("Could not get the list of commands from the bosh CLI: %s", err)
+			return false
+		}
+		ret = parseCLICommands(output)
+		log.Write("bosh CLI %s says it has %d commands", version, len(ret))
+		help.Commands = ret
+		return true
+	})
+
+	return ret
+}
+
+//insertCLICommands adds whatever commands and aliases the bosh CLI has
+// that haven't been listed by hand. New commands get no positional
+// arguments completed
+func insertCLICommands() {
+	known := map[string]command{}
+	for _, cmd := range commands {
+		known[cmd.Name] = cmd
+	}
+
+	for _, c := range cliCommands() {
+		cmd, found := known[c.Name]
+		if !found {
+			log.Write("Adding command `%s' from the bosh CLI", c.Name)
+			cmd = command{Name: c.Name}.Insert()
+			known[c.Name] = cmd
+		}
+
+		for _, alias := range c.Aliases {
+			if _, found := known[alias]; !found {
+				known[alias] = cmd.Alias(alias)
+			}
+		}
+	}
+}
+
+//Values that can be completed for flags the bosh CLI has that aren't listed by
+// hand, by flag name. No command takes a team yet, but the director knows
+// which teams there are if one ever does
+var cliFlagCompleters = map[string]compFunc{
+	"team": compTeams,
+}
+
+//insertCLIFlags adds whatever flags the bosh CLI knows the command to have
+// that haven't been listed by hand. Their values aren't completed, unless
+// they're something in cliFlagCompleters
+func insertCLIFlags(command string) {
+	for _, f := range cliFlags(command) {
+		long := "--" + f.Long
+		if _, found := flags[long]; found {
+			continue
+		}
+
+		toInsert := flag{Long: f.Long}
+		if f.Short != "" {
+			toInsert.Short = rune(f.Short[0])
+		}
+		if f.TakesValue {
+			toInsert.Complete = compNoop
+			if complete, found := cliFlagCompleters[f.Long]; found {
+				toInsert.Complete = complete
+			}
+		}
+		insertFlag(toInsert)
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
-import "sort"
+import (
+	"sort"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
 
 type commandList []command
 
@@ -44,6 +48,10 @@ func (c *commandList) Populate() {
 		Flags: []flag{
 			{Long: "disk-properties", Complete: compNoop},
 		},
+		Args: []compFunc{
+			compInstances,
+			compOrphanedDisks,
+		},
 	}.Insert()
 
 	command{
@@ -53,8 +61,19 @@ func (c *commandList) Populate() {
 
 	command{
 		Name: "cancel-task",
+		Args: []compFunc{
+			compCancellableTasks,
+		},
 	}.Insert().Alias("ct")
 
+	command{
+		Name: "cancel-tasks",
+		Flags: []flag{
+			{Long: "type", Short: 't', Complete: compNoop, Repeatable: true},
+			{Long: "state", Short: 's', Complete: compVocabulary("task-states"), Repeatable: true},
+		},
+	}.Insert().Alias("cts")
+
 	command{
 		Name:  "clean-up",
 		Flags: []flag{{Long: "all"}},
@@ -65,7 +84,7 @@ func (c *commandList) Populate() {
 		Flags: []flag{
 			{Long: "auto", Short: 'a'},
 			{Long: "report", Short: 'r'},
-			{Long: "resolution", Complete: compNoop},
+			{Long: "resolution", Complete: compResolutions, Repeatable: true},
 		},
 	}.Insert().Alias("cck").Alias("cloudcheck")
 
@@ -76,21 +95,19 @@ func (c *commandList) Populate() {
 	command{
 		Name: "config",
 		Flags: []flag{
-			//TODO: name -> config names
-			{Long: "name", Complete: compNoop},
-			{Long: "type", Complete: compEnum("cloud", "runtime", "cpi")},
+			{Long: "name", Complete: compSupports(director.FeatureConfigs, compConfigNames)},
+			{Long: "type", Complete: compVocabulary("config-types")},
 		},
 		Args: []compFunc{
-			compNoop, //TODO: Config ids
+			compSupports(director.FeatureConfigs, compConfigIDs),
 		},
 	}.Insert().Alias("c")
 
 	command{
 		Name: "configs",
 		Flags: []flag{
-			//TODO: name -> config names
-			{Long: "name", Complete: compNoop},
-			{Long: "type", Complete: compEnum("cloud", "runtime", "cpi")},
+			{Long: "name", Complete: compSupports(director.FeatureConfigs, compConfigNames)},
+			{Long: "type", Complete: compVocabulary("config-types")},
 			{Long: "recent", Complete: compNoop},
 		},
 	}.Insert().Alias("cs")
@@ -102,20 +119,18 @@ func (c *commandList) Populate() {
 	command{
 		Name: "create-env",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 			{Long: "skip-drain"},
 			{Long: "state", Complete: compFiles},
 			{Long: "recreate"},
 			{Long: "recreate-persistent-disks"},
 		},
-		Args: []compFunc{compFiles},
+		Args: []compFunc{compManifests},
 	}.Insert()
 
 	command{
@@ -131,22 +146,32 @@ func (c *commandList) Populate() {
 		},
 	}.Insert().Alias("cr")
 
+	command{
+		Name: "create-recovery-plan",
+		Args: []compFunc{compFiles},
+	}.Insert()
+
 	command{
 		Name: "curl",
+		Flags: []flag{
+			{Long: "method", Short: 'X', Complete: compVocabulary("http-methods")},
+			{Long: "header", Short: 'H', Complete: compNoop, Repeatable: true},
+			{Long: "body", Complete: compFiles},
+			{Long: "show-headers", Short: 'i'},
+		},
 		Args: []compFunc{
-			compNoop,
+			compDirectorPaths,
 		},
 	}.Insert()
 
 	command{
 		Name: "delete-config",
 		Flags: []flag{
-			{Long: "type", Complete: compEnum("cloud", "runtime", "cpi")},
-			//TODO: name -> config names
-			{Long: "name", Complete: compNoop},
+			{Long: "type", Complete: compVocabulary("config-types")},
+			{Long: "name", Complete: compSupports(director.FeatureConfigs, compConfigNames)},
 		},
 		Args: []compFunc{
-			compNoop, //TODO: Config ids
+			compSupports(director.FeatureConfigs, compConfigIDs),
 		},
 	}.Insert().Alias("dc")
 
@@ -158,25 +183,23 @@ func (c *commandList) Populate() {
 	command{
 		Name: "delete-disk",
 		Args: []compFunc{
-			compNoop, //TODO: (orphaned?) Disk cids
+			compOrphanedDisks,
 		},
 	}.Insert()
 
 	command{
 		Name: "delete-env",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 			{Long: "skip-drain"},
 			{Long: "state", Complete: compFiles},
 		},
-		Args: []compFunc{compFiles},
+		Args: []compFunc{compManifests},
 	}.Insert()
 
 	command{
@@ -190,57 +213,55 @@ func (c *commandList) Populate() {
 		Name:  "delete-release",
 		Flags: []flag{{Long: "force"}},
 		Args: []compFunc{
-			compUnusedReleases,
+			compSlugs(compUnusedReleases),
 		},
 	}.Insert().Alias("delr")
 
 	command{
 		Name: "delete-snapshot",
 		Args: []compFunc{
-			compNoop, //TODO: snapshot cids
+			compSnapshots,
 		},
 	}.Insert()
 
 	command{
 		Name: "delete-snapshots",
-	}.Insert().Alias("dels")
+	}.Insert()
 
 	command{
 		Name:  "delete-stemcell",
 		Flags: []flag{{Long: "force"}},
 		Args: []compFunc{
-			compUnusedStemcells,
+			compSlugs(compUnusedStemcells),
 		},
-	}.Insert()
+	}.Insert().Alias("dels")
 
 	command{
 		Name: "delete-vm",
 		Args: []compFunc{
-			compNoop, //TODO: vm cids
+			compVMs,
 		},
 	}.Insert()
 
 	command{
 		Name: "deploy",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 			{Long: "no-redact"},
 			{Long: "recreate"},
 			{Long: "recreate-persistent-disks"},
 			{Long: "fix"},
 			//TODO: skip-drain -> get instance groups from manifest
-			{Long: "skip-drain", Complete: compNoop},
+			{Long: "skip-drain", Complete: compNoop, Repeatable: true},
 			{Long: "max-in-flight", Complete: compNoop},
 			{Long: "dry-run"},
 		},
-		Args: []compFunc{compFiles},
+		Args: []compFunc{compManifests},
 	}.Insert().Alias("d")
 
 	command{
@@ -248,24 +269,24 @@ func (c *commandList) Populate() {
 	}.Insert().Alias("dep")
 
 	command{
-		Name: "deployments",
+		Name:    "deployments",
+		Columns: []string{"Name", "Release(s)", "Stemcell(s)", "Team(s)"},
 	}.Insert().Alias("ds")
 
 	command{
 		Name: "diff-config",
 		Flags: []flag{
-			//TODO: Config ids
-			{Long: "from-id", Complete: compNoop},
-			//TODO: Config ids
-			{Long: "to-id", Complete: compNoop},
+			{Long: "from-id", Complete: compSupports(director.FeatureConfigs, compConfigRevisions)},
+			{Long: "to-id", Complete: compSupports(director.FeatureConfigs, compConfigRevisions)},
 			{Long: "from-content", Complete: compFiles},
 			{Long: "to-content", Complete: compFiles},
 		},
 	}.Insert()
 
 	command{
-		Name:  "disks",
-		Flags: []flag{{Long: "orphaned"}},
+		Name:    "disks",
+		Flags:   []flag{{Long: "orphaned"}},
+		Columns: []string{"Disk CID", "Size", "Deployment", "Instance", "AZ", "Orphaned At"},
 	}.Insert()
 
 	command{
@@ -294,16 +315,16 @@ func (c *commandList) Populate() {
 			{Long: "before-id", Complete: compNoop},
 			{Long: "before", Complete: compNoop},
 			{Long: "after", Complete: compNoop},
-			//TODO: Task IDs (?)
-			{Long: "task", Complete: compNoop},
-			//TODO: Instances
-			{Long: "instance", Complete: compNoop},
-			//TODO: Event users (?)
-			{Long: "event-user", Complete: compNoop},
-			{Long: "action", Complete: compEnum("update", "delete", "setup ssh", "cleanup ssh")},
-			{Long: "object-type", Complete: compEnum("instance", "deployment", "vm")},
-			//TODO: Probably complete this, but only if object type is given?
-			{Long: "object-name", Complete: compNoop},
+			{Long: "task", Complete: compTasks},
+			{Long: "instance", Complete: compInstances},
+			{Long: "event-user", Complete: compEventUsers},
+			{Long: "action", Complete: compVocabulary("event-actions")},
+			{Long: "object-type", Complete: compVocabulary("event-object-types")},
+			{Long: "object-name", Complete: compEventObjectNames},
+		},
+		Columns: []string{
+			"ID", "Time", "User", "Action", "Object Type", "Object Name", "Task ID",
+			"Deployment", "Instance", "Context", "Error",
 		},
 	}.Insert()
 
@@ -312,11 +333,11 @@ func (c *commandList) Populate() {
 		Flags: []flag{
 			{Long: "dir", Complete: compDirs},
 			//TODO: List jobs in current release dir
-			{Long: "job", Complete: compNoop},
+			{Long: "job", Complete: compNoop, Repeatable: true},
 		},
 		Args: []compFunc{
-			compNoop,
-			compNoop,
+			compSlugs(compSpecificReleases),
+			compSlugs(compStemcellOSVersions),
 		},
 	}.Insert()
 
@@ -339,6 +360,12 @@ func (c *commandList) Populate() {
 		Args:  []compFunc{compNoop},
 	}.Insert()
 
+	command{
+		Name:  "generate-package",
+		Flags: []flag{{Long: "dir", Complete: compDirs}},
+		Args:  []compFunc{compNoop},
+	}.Insert()
+
 	command{
 		Name: "help",
 	}.Insert()
@@ -358,6 +385,11 @@ func (c *commandList) Populate() {
 		},
 	}.Insert()
 
+	command{
+		Name: "inspect-local-release",
+		Args: []compFunc{compTarballs},
+	}.Insert()
+
 	command{
 		Name: "inspect-local-stemcell",
 		Args: []compFunc{compDirs},
@@ -365,7 +397,7 @@ func (c *commandList) Populate() {
 
 	command{
 		Name: "inspect-release",
-		Args: []compFunc{compSpecificReleases},
+		Args: []compFunc{compSlugs(compSpecificReleases)},
 	}.Insert()
 
 	command{
@@ -377,25 +409,27 @@ func (c *commandList) Populate() {
 			{Long: "ps", Short: 'p'},
 			{Long: "failing", Short: 'f'},
 		},
+		Columns: append([]string{
+			"Instance", "Process", "Process State", "AZ", "IPs", "Deployment",
+			"State", "VM CID", "VM Type", "Disk CIDs", "Agent ID", "Index",
+			"Bootstrap", "Ignore", "DNS A Records",
+		}, vitalsColumns...),
 	}.Insert().Alias("is")
 
 	command{
 		Name: "interpolate",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
-			//TODO: I think this is parsing the paths of a yaml file?
-			{Long: "path", Complete: compNoop},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
+			{Long: "path", Complete: compDocumentPaths},
 			{Long: "var-errs"},
 			{Long: "var-errs-unused"},
 		},
-		Args: []compFunc{compFiles},
+		Args: []compFunc{compManifests},
 	}.Insert().Alias("int")
 
 	command{
@@ -417,8 +451,7 @@ func (c *commandList) Populate() {
 			{Long: "follow", Short: 'f'},
 			{Long: "num", Complete: compNoop},
 			{Long: "quiet", Short: 'q'},
-			//TODO: Jobs on the VM
-			{Long: "job", Complete: compNoop},
+			{Long: "job", Complete: compJobs, Repeatable: true},
 			{Long: "only", Complete: compNoop},
 			{Long: "agent"},
 			{Long: "gw-disable"},
@@ -427,6 +460,9 @@ func (c *commandList) Populate() {
 			{Long: "gw-private-key", Complete: compFiles},
 			{Long: "gw-socks5", Complete: compFiles},
 		},
+		Args: []compFunc{
+			compRequires(compOr(compInstanceGroups, compInstances), epInstances),
+		},
 	}.Insert()
 
 	command{
@@ -441,7 +477,7 @@ func (c *commandList) Populate() {
 	command{
 		Name: "orphan-disk",
 		Args: []compFunc{
-			compNoop, //TODO: disk cids (non-orphaned)
+			compAttachedDisks,
 		},
 	}.Insert()
 
@@ -460,14 +496,20 @@ func (c *commandList) Populate() {
 			{Long: "dry-run"},
 		},
 		Args: []compFunc{
-			compOr(compInstanceGroups, compInstances),
+			compRequires(compOr(compInstanceGroups, compInstances), epInstances),
 		},
 	}.Insert()
 
 	command{
-		Name: "releases",
+		Name:    "releases",
+		Columns: []string{"Name", "Version", "Commit Hash"},
 	}.Insert().Alias("rs")
 
+	command{
+		Name: "recover",
+		Args: []compFunc{compFiles},
+	}.Insert()
+
 	command{
 		Name:  "remove-blob",
 		Flags: []flag{{Long: "dir", Complete: compDirs}},
@@ -479,12 +521,16 @@ func (c *commandList) Populate() {
 	command{
 		Name: "repack-stemcell",
 		Flags: []flag{
-			{Long: "name", Complete: compNoop},
+			{Long: "name", Complete: compStemcellNames},
 			{Long: "cloud-properties", Complete: compNoop},
 			{Long: "empty-image"},
 			{Long: "format", Complete: compNoop},
 			{Long: "version", Complete: compNoop},
 		},
+		Args: []compFunc{
+			compFiles,
+			compFiles,
+		},
 	}.Insert()
 
 	command{
@@ -501,19 +547,22 @@ func (c *commandList) Populate() {
 			{Long: "max-in-flight", Complete: compNoop},
 		},
 		Args: []compFunc{
-			compOr(compInstanceGroups, compInstances),
+			compRequires(compOr(compInstanceGroups, compInstances), epInstances),
 		},
 	}.Insert()
 
 	command{
 		Name: "run-errand",
 		Flags: []flag{
-			{Long: "instance", Complete: compInstances},
+			{Long: "instance", Complete: compInstances, Repeatable: true},
 			{Long: "keep-alive"},
 			{Long: "when-changed"},
 			{Long: "download-logs"},
 			{Long: "logs-dir", Complete: compDirs},
 		},
+		Args: []compFunc{
+			compErrands,
+		},
 	}.Insert()
 
 	command{
@@ -535,9 +584,8 @@ func (c *commandList) Populate() {
 			{Long: "gw-socks5", Complete: compFiles},
 		},
 		Args: []compFunc{
-			compFiles, //TODO: at least instance group/id... maybe use ssh to ls if thats not too slow?
-			//TODO: "or" that with files on the local file system
-			compFiles,
+			compSCPPaths,
+			compSCPPaths,
 		},
 	}.Insert()
 
@@ -561,7 +609,7 @@ func (c *commandList) Populate() {
 			{Long: "gw-socks5", Complete: compFiles},
 		},
 		Args: []compFunc{
-			compInstances,
+			compRequires(compOr(compInstanceGroups, compInstances), epInstances),
 		},
 	}.Insert()
 
@@ -573,12 +621,13 @@ func (c *commandList) Populate() {
 			{Long: "max-in-flight", Complete: compNoop},
 		},
 		Args: []compFunc{
-			compOr(compInstanceGroups, compInstances),
+			compRequires(compOr(compInstanceGroups, compInstances), epInstances),
 		},
 	}.Insert()
 
 	command{
-		Name: "stemcells",
+		Name:    "stemcells",
+		Columns: []string{"Name", "Version", "OS", "CPI", "CID"},
 	}.Insert().Alias("ss")
 
 	command{
@@ -592,7 +641,7 @@ func (c *commandList) Populate() {
 			{Long: "max-in-flight", Complete: compNoop},
 		},
 		Args: []compFunc{
-			compOr(compInstanceGroups, compInstances),
+			compRequires(compOr(compInstanceGroups, compInstances), epInstances),
 		},
 	}.Insert()
 
@@ -618,7 +667,7 @@ func (c *commandList) Populate() {
 			{Long: "all", Short: 'a'},
 		},
 		Args: []compFunc{
-			compNoop, //TODO: Task ids?
+			compTasks,
 		},
 	}.Insert().Alias("t")
 
@@ -628,26 +677,28 @@ func (c *commandList) Populate() {
 			{Long: "recent", Complete: compNoop},
 			{Long: "all", Short: 'a'},
 		},
+		Columns: []string{
+			"ID", "State", "Started At", "Last Activity At", "Finished At", "User",
+			"Deployment", "Description", "Result",
+		},
 	}.Insert().Alias("ts")
 
 	command{
 		Name: "unignore",
 		Args: []compFunc{
-			compInstances,
+			compIgnoredInstances,
 		},
 	}.Insert()
 
 	command{
 		Name: "update-cloud-config",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 		},
 		Args: []compFunc{
 			compFiles,
@@ -657,17 +708,14 @@ func (c *commandList) Populate() {
 	command{
 		Name: "update-config",
 		Flags: []flag{
-			{Long: "type", Complete: compEnum("cloud", "runtime", "cpi")},
-			//TODO: Config names with type --type
-			{Long: "name", Complete: compNoop},
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "type", Complete: compVocabulary("config-types")},
+			{Long: "name", Complete: compSupports(director.FeatureConfigs, compConfigNames)},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 		},
 		Args: []compFunc{
 			compFiles,
@@ -677,14 +725,12 @@ func (c *commandList) Populate() {
 	command{
 		Name: "update-cpi-config",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 			{Long: "no-redact"},
 		},
 		Args: []compFunc{
@@ -695,21 +741,19 @@ func (c *commandList) Populate() {
 	command{
 		Name: "update-resurrection",
 		Args: []compFunc{
-			compEnum("on", "off"),
+			compVocabulary("on-off"),
 		},
 	}.Insert()
 
 	command{
 		Name: "update-runtime-config",
 		Flags: []flag{
-			//TODO: var -> <vars in manifest> = noop
-			{Long: "var", Short: 'v', Complete: compNoop},
-			//TODO: var-file -> <vars in manifest> = path
-			{Long: "var-file", Complete: compNoop},
-			{Long: "vars-file", Short: 'l', Complete: compFiles},
-			{Long: "vars-env", Complete: compNoop},
+			{Long: "var", Short: 'v', Complete: compVars, Repeatable: true},
+			{Long: "var-file", Complete: compVarFiles, Repeatable: true},
+			{Long: "vars-file", Short: 'l', Complete: compVarsFiles, Repeatable: true},
+			{Long: "vars-env", Complete: compNoop, Repeatable: true},
 			{Long: "vars-store", Complete: compFiles},
-			{Long: "ops-file", Short: 'o', Complete: compFiles},
+			{Long: "ops-file", Short: 'o', Complete: compOpsFiles, Repeatable: true},
 			{Long: "no-redact"},
 			//TODO: Runtime config names
 			{Long: "name", Complete: compNoop},
@@ -732,13 +776,13 @@ func (c *commandList) Populate() {
 			{Long: "dir", Complete: compDirs},
 			{Long: "rebase"},
 			{Long: "fix"},
-			{Long: "name", Complete: compNoop},
-			{Long: "version", Complete: compNoop},
-			{Long: "sha1", Complete: compNoop},
-			{Long: "stemcell", Complete: compNoop},
+			{Long: "name", Complete: compReleaseNames},
+			{Long: "version", Complete: compBoshIOReleaseVersions},
+			{Long: "sha1", Complete: compTarballSHAs},
+			{Long: "stemcell", Complete: compSlugs(compStemcellOSVersions)},
 		},
 		Args: []compFunc{
-			compFiles,
+			compOr(compTarballs, compBoshIOReleases),
 		},
 	}.Insert().Alias("ur")
 
@@ -746,12 +790,12 @@ func (c *commandList) Populate() {
 		Name: "upload-stemcell",
 		Flags: []flag{
 			{Long: "fix"},
-			{Long: "name", Complete: compNoop},
-			{Long: "version", Complete: compNoop},
-			{Long: "sha1", Complete: compNoop},
+			{Long: "name", Complete: compStemcellNames},
+			{Long: "version", Complete: compBoshIOStemcellVersions},
+			{Long: "sha1", Complete: compTarballSHAs},
 		},
 		Args: []compFunc{
-			compFiles,
+			compOr(compTarballs, compBoshIOStemcells),
 		},
 	}.Insert().Alias("us")
 
@@ -777,8 +821,15 @@ func (c *commandList) Populate() {
 			{Long: "vitals"},
 			{Long: "cloud-properties"},
 		},
+		Columns: append([]string{
+			"Instance", "Process State", "AZ", "IPs", "VM CID", "VM Type", "Active",
+			"DNS A Records", "Cloud Properties",
+		}, vitalsColumns...),
 	}.Insert()
 
+	insertCLICommands()
+	insertPluginCommands()
+
 	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
 }
 
@@ -787,8 +838,19 @@ var commands commandList
 type command struct {
 	Name    string
 	IsAlias bool
+	//The name of the command that this is an alias of
+	AliasOf string
 	Flags   []flag
 	Args    []compFunc
+	//The headers of the table that the command prints, for --column
+	Columns []string
+}
+
+//The columns that --vitals adds to vms and instances
+var vitalsColumns = []string{
+	"VM Created At", "Uptime", "Load (1m, 5m, 15m)", "CPU Total", "CPU User",
+	"CPU Sys", "CPU Wait", "Memory Usage", "Swap Usage", "System Disk Usage",
+	"Ephemeral Disk Usage", "Persistent Disk Usage",
 }
 
 func (c command) Insert() command {
@@ -797,6 +859,9 @@ func (c command) Insert() command {
 }
 
 func (c command) Alias(alias string) command {
+	if !c.IsAlias {
+		c.AliasOf = c.Name
+	}
 	c.Name = alias
 	c.IsAlias = true
 	return c.Insert()
@@ -806,4 +871,5 @@ func (c command) InsertFlags() {
 	for _, f := range c.Flags {
 		insertFlag(f)
 	}
+	insertCLIFlags(c.Name)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -15,6 +16,9 @@ var dontAddSpace bool
 var dontFilterPrefix bool
 
 type compContext struct {
+	//Done when the completion has run out of time, at which point any requests
+	// still out to the director are abandoned
+	Context      context.Context
 	CurrentToken string
 	Command      string
 	Args         []string
@@ -22,16 +26,41 @@ type compContext struct {
 	CurrentFlag string
 	//Long flag string to value(s)
 	Flags map[string][]string
+	//Long flag string to the env var that its value came from, for flags that
+	// weren't given on the command line
+	FromEnv map[string]string
+}
+
+//FlagValue returns the value that the bosh CLI would use for the given flag.
+// Values typed on the command line come before any inserted from environment
+// variables, so the first value wins
+func (c compContext) FlagValue(flag string) (string, bool) {
+	vals, found := c.Flags[flag]
+	if !found || len(vals) == 0 {
+		return "", false
+	}
+	return vals[0], true
 }
 
 func (c *compContext) InsertIfEnvvar(envvar, flag string) {
 	val := os.Getenv(envvar)
 	if val != "" {
+		if _, given := c.Flags[flag]; !given {
+			c.FromEnv[flag] = envvar
+		}
 		c.Flags[flag] = append(c.Flags[flag], val)
 	}
 }
 
-func (c compContext) Complete() ([]string, error) {
+//FlagSource describes where the value returned by FlagValue came from
+func (c compContext) FlagSource(flag string) string {
+	if envvar, found := c.FromEnv[flag]; found {
+		return "$" + envvar
+	}
+	return flag + " flag"
+}
+
+func (c compContext) Complete() ([]candidate, error) {
 	var compFn compFunc
 
 	log.Write("Current Token: %s", c.CurrentToken)
@@ -64,6 +93,20 @@ func (c compContext) Complete() ([]string, error) {
 		log.Write("No completion registered")
 		compFn = compNoop
 	}
+	if c.Command != "" {
+		compFn = withPlugins(c.Command, compFn)
+	}
+
+	//Only what comes after the last comma of a comma separated list is being
+	// completed. What comes before it gets put back on each candidate
+	listPrefix := ""
+	if f, found := flags[c.CurrentFlag]; found && f.CommaSeparated {
+		if i := strings.LastIndex(c.CurrentToken, ","); i >= 0 {
+			listPrefix = c.CurrentToken[:i+1]
+			c.CurrentToken = c.CurrentToken[i+1:]
+			log.Write("Completing `%s' of comma separated list `%s'", c.CurrentToken, listPrefix)
+		}
+	}
 
 	candidates, err := compFn(c)
 	if err != nil {
@@ -72,27 +115,110 @@ func (c compContext) Complete() ([]string, error) {
 
 	//log.Write("Completion candidates: \n---START---\n%s\n---END---\n", strings.Join(candidates, "\n"))
 
-	ret := []string{}
-	for _, val := range candidates {
-		if strings.ContainsAny(val, " \t\n\r") {
-			val = fmt.Sprintf(`"%s"`, val)
+	//Don't offer up values that were already given to a flag that builds up a
+	// list. Env vars are never inserted for these, so everything here was typed
+	alreadyGiven := map[string]bool{}
+	if f, found := flags[c.CurrentFlag]; found && f.Repeatable {
+		for _, val := range c.Flags[c.CurrentFlag] {
+			alreadyGiven[val] = true
 		}
-		if dontFilterPrefix || strings.HasPrefix(val, c.CurrentToken) {
-			ret = append(ret, val)
+	}
+	for _, val := range strings.Split(strings.TrimSuffix(listPrefix, ","), ",") {
+		if val != "" {
+			alreadyGiven[val] = true
 		}
 	}
 
-	if len(ret) == 1 && !dontAddSpace {
-		ret[0] = fmt.Sprintf("%s ", ret[0])
+	//If the shell handed us the word with its opening quote still on it, that
+	// isn't part of the value we're matching against
+	token := strings.TrimLeft(c.CurrentToken, `"'`)
+
+	ret, loose := []candidate{}, []candidate{}
+	matches := matchModes[matchMode]
+	for _, candidate := range candidates {
+		val := candidate.Value
+		if alreadyGiven[val] {
+			continue
+		}
+		if candidateFilter != nil && !candidateFilter(val) {
+			continue
+		}
+		if listPrefix != "" {
+			candidate = candidate.withValue(listPrefix + val)
+		}
+		switch {
+		case dontFilterPrefix || strings.HasPrefix(val, token):
+			ret = append(ret, candidate)
+		case matches(val, token):
+			loose = append(loose, candidate)
+		}
 	}
 
-	log.Write("Completion return: \n---START---\n%s\n---END---\n", strings.Join(ret, "\n"))
-	return ret, nil
+	return append(ret, loose...), nil
 }
 
-type compFunc func(compContext) ([]string, error)
+type compFunc func(compContext) ([]candidate, error)
 
 func doComplete(boshArgs []string) {
+	if response, answered := completeViaDaemon(boshArgs); answered {
+		fmt.Print(response)
+		return
+	}
+
+	fmt.Print(runCompletion(boshArgs))
+}
+
+//trimToShellWord cuts candidates down to what replaces the word the shell
+// thinks is being completed. Where the shell broke the token up (e.g. at the
+// `=' in `-v az=z1'), it only replaces the last part of it
+func trimToShellWord(candidates []candidate, token, shellWord string) []candidate {
+	if len(shellWord) >= len(token) || !strings.HasSuffix(token, shellWord) {
+		return candidates
+	}
+
+	prefix := token[:len(token)-len(shellWord)]
+	log.Write("Shell is only completing `%s' of `%s'", shellWord, token)
+	ret := make([]candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		ret = append(ret, candidate.withValue(strings.TrimPrefix(candidate.Value, prefix)))
+	}
+
+	return ret
+}
+
+//withFlagPrefix puts the flag back on the front of candidates for the value of
+// a flag given like --flag=value, so that they replace the whole word
+func withFlagPrefix(candidates []candidate, word string) []candidate {
+	eq := strings.Index(word, "=")
+	if !strings.HasPrefix(word, "-") || eq < 0 {
+		return candidates
+	}
+
+	ret := make([]candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		ret = append(ret, candidate.withValue(word[:eq+1]+candidate.Value))
+	}
+
+	return ret
+}
+
+//resetCompletionState puts back everything that a completion run may have
+// changed, so that a long-running daemon can do one after another
+func resetCompletionState() {
+	dontAddSpace = false
+	dontFilterPrefix = false
+	candidateFilter = nil
+	matchMode = defaultMatchMode
+	stats.reset()
+	descriptionWidth = defaultDescriptionWidth
+	flags = map[string]flag{}
+	commands = nil
+	plugins = nil
+}
+
+//runCompletion works out the candidates for the given bosh command line and
+// returns them formatted for the shell
+func runCompletion(boshArgs []string) string {
 	log.Write("in complete")
 	argsString := ""
 	if len(boshArgs) > 0 {
@@ -100,23 +226,128 @@ func doComplete(boshArgs []string) {
 	}
 	log.Write("Bosh args: [%s]", argsString)
 
+	//The shell's own word splitting breaks up words on characters like `='
+	// and `:', and doesn't remove quotes, so prefer the raw command line if
+	// we were given it
+	shellWord := ""
+	if len(boshArgs) > 0 {
+		shellWord = boshArgs[len(boshArgs)-1]
+	}
+	if lineArgs, found := argsFromCompLine(); found {
+		log.Write("Using args from COMP_LINE: [`%s']", strings.Join(lineArgs, "', `"))
+		boshArgs = lineArgs
+	}
+	//Shells that leave the splitting to us (e.g. fish and PowerShell) complete
+	// whole words
+	if shellWord == "" && len(boshArgs) > 0 {
+		shellWord = boshArgs[len(boshArgs)-1]
+	}
+
 	insertGlobalFlags()
 	commands.Populate()
+	boshArgs = withTrailingFlags(boshArgs, wordsAfterCursor())
+	setupFilter(opts.Filter)
+	setupMatchMode()
+	setupDescriptionWidth()
+
+	compContext, ok := parseContext(boshArgs)
+	if !ok {
+		return ""
+	}
+
+	//The shell is waiting, so don't keep it waiting any longer than the budget
+	timeout := completionTimeout()
+	if budget := completionBudget(); budget > 0 && budget < timeout {
+		timeout = budget
+	}
+
+	var cancel context.CancelFunc
+	compContext.Context, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	compContext := parseContext(boshArgs)
 	results, err := compContext.Complete()
+	revalidateInBackground(boshArgs)
+	for _, line := range stats.summary() {
+		log.Write("Timing: %s", line)
+	}
 	if err != nil {
-		log.Write("Completion error: %s", err.Error())
-		return
+		log.Error("Completion error: %s", err.Error())
+		return ""
+	}
+	word := boshArgs[len(boshArgs)-1]
+	results = trimToShellWord(withFlagPrefix(results, word), word, shellWord)
+
+	response := formatCandidates(opts.Shell, results, shellWord)
+	log.Write("Completion return: \n---START---\n%s\n---END---\n", response)
+	return response
+}
+
+//Flags given after the cursor that still say what's being completed, e.g.
+// which director to ask in `bosh -d <TAB> -e prod'
+var trailingFlags = map[string]bool{
+	"--environment":   true,
+	"--deployment":    true,
+	"--config":        true,
+	"--client":        true,
+	"--client-secret": true,
+	"--ca-cert":       true,
+}
+
+//withTrailingFlags puts the values of trailingFlags found in the words after
+// the cursor in with those before it, unless they were already given there.
+// They go in just after the command name, where they can't be mistaken for
+// the value of whatever flag is being completed
+func withTrailingFlags(args, trailing []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+
+	given := map[string]bool{}
+	for _, arg := range args[:len(args)-1] {
+		if f, found := flags[strings.SplitN(arg, "=", 2)[0]]; found {
+			given["--"+f.Long] = true
+		}
+	}
+
+	extra := []string{}
+	for i := 0; i < len(trailing); i++ {
+		parts := strings.SplitN(trailing[i], "=", 2)
+		f, found := flags[parts[0]]
+		if !found || f.Complete == nil {
+			continue
+		}
+
+		val := ""
+		if len(parts) == 2 {
+			val = parts[1]
+		} else if i+1 < len(trailing) {
+			i++
+			val = trailing[i]
+		} else {
+			break
+		}
+
+		long := "--" + f.Long
+		if trailingFlags[long] && !given[long] {
+			log.Write("Using %s `%s' from after the cursor", long, val)
+			extra = append(extra, long, val)
+			given[long] = true
+		}
 	}
 
-	response := strings.Join(results, "\n")
-	fmt.Print(response)
+	if len(extra) == 0 {
+		return args
+	}
+
+	ret := append([]string{args[0]}, extra...)
+	return append(ret, args[1:]...)
 }
 
-func parseContext(args []string) compContext {
+//parseContext works out what's being completed from the given command line.
+// It returns false if there's too little of it to complete anything
+func parseContext(args []string) (compContext, bool) {
 	if len(args) < 2 {
-		os.Exit(0)
+		return compContext{}, false
 	}
 
 	for i := 0; i < len(args); i++ {
@@ -139,8 +370,10 @@ func parseContext(args []string) compContext {
 	}
 
 	ret := compContext{
+		Context:      context.Background(),
 		CurrentToken: args[len(args)-1],
 		Flags:        map[string][]string{},
+		FromEnv:      map[string]string{},
 	}
 
 	//loop over all but last token - the last one is the token
@@ -175,12 +408,19 @@ func parseContext(args []string) compContext {
 
 	//Flags override environment variables, so put in env vars last... they would
 	// become the second flag value, which is typically ignored in the code
-	ret.InsertIfEnvvar("BOSH_ENVIRONMENT", "--environment")
-	ret.InsertIfEnvvar("BOSH_DEPLOYMENT", "--deployment")
-	ret.InsertIfEnvvar("BOSH_CLIENT", "--client")
-	ret.InsertIfEnvvar("BOSH_CLIENT_SECRET", "--client-secret")
-	ret.InsertIfEnvvar("BOSH_NON_INTERACTIVE", "--non-interactive")
-	ret.InsertIfEnvvar("BOSH_CA_CERT", "--ca-cert")
+	ret.insertEnvvars()
 
-	return ret
+	return ret, true
+}
+
+//insertEnvvars adds the values of the bosh CLI's environment variables to the
+// flags that they stand in for
+func (c *compContext) insertEnvvars() {
+	c.InsertIfEnvvar("BOSH_ENVIRONMENT", "--environment")
+	c.InsertIfEnvvar("BOSH_DEPLOYMENT", "--deployment")
+	c.InsertIfEnvvar("BOSH_CLIENT", "--client")
+	c.InsertIfEnvvar("BOSH_CLIENT_SECRET", "--client-secret")
+	c.InsertIfEnvvar("BOSH_NON_INTERACTIVE", "--non-interactive")
+	c.InsertIfEnvvar("BOSH_CA_CERT", "--ca-cert")
+	c.InsertIfEnvvar("BOSH_CONFIG", "--config")
 }
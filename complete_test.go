@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//compWordsArgs is what the bash script hands over for the given COMP_WORDS
+// and COMP_CWORD: the words up to the cursor, and then the one it's in
+func compWordsArgs(words []string, cword int) []string {
+	return append(append([]string{}, words[:cword]...), words[cword])
+}
+
+func TestCompleteLeavesOutWhatWasAlreadyGiven(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+		cword int
+		want  []string
+	}{
+		{
+			name:  "first of a repeatable flag",
+			words: []string{"bosh", "cancel-tasks", "-s", ""},
+			cword: 3,
+			want:  []string{"cancelled", "cancelling", "done", "error", "processing", "queued", "timeout"},
+		},
+		{
+			name:  "repeated states",
+			words: []string{"bosh", "cancel-tasks", "-s", "processing", "--state", "queued", "-s", ""},
+			cword: 7,
+			want:  []string{"cancelled", "cancelling", "done", "error", "timeout"},
+		},
+		{
+			name:  "repeated ops files",
+			words: []string{"bosh", "-d", "cf", "deploy", "manifest.yml", "-o", "scale.yml", "-o", ""},
+			cword: 8,
+			want:  []string{"manifest.yml", "ops/", "tls.yml"},
+		},
+		{
+			name:  "repeated vars",
+			words: []string{"bosh", "-d", "cf", "deploy", "manifest.yml", "-v", "az=z1", "-v", ""},
+			cword: 8,
+			want:  []string{"network="},
+		},
+		{
+			//What comes after the cursor hasn't been given yet, as far as
+			// COMP_CWORD is concerned
+			name:  "cursor before the other values",
+			words: []string{"bosh", "cancel-tasks", "-s", "q", "-s", "queued"},
+			cword: 3,
+			want:  []string{"queued"},
+		},
+		{
+			name:  "comma separated list",
+			words: []string{"bosh", "deployments", "--column=name,team_s,"},
+			cword: 2,
+			want:  []string{"name,team_s,release_s", "name,team_s,stemcell_s"},
+		},
+		{
+			name:  "comma separated list part way through a value",
+			words: []string{"bosh", "deployments", "--column", "stemcell_s,s"},
+			cword: 3,
+			want:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := isolate(t)
+			chdir(t, dir)
+			writeFile(t, dir, "manifest.yml", "name: cf\nazs: [((az))]\nnetworks: [((network))]\n")
+			writeFile(t, dir, "scale.yml", "[]\n")
+			writeFile(t, dir, "tls.yml", "[]\n")
+			writeFile(t, dir, "README.md", "\n")
+			if err := os.Mkdir(dir+"/ops", 0700); err != nil {
+				t.Fatalf("Could not make ops dir: %s", err)
+			}
+
+			resetCompletionState()
+			insertGlobalFlags()
+			commands.Populate()
+			t.Cleanup(resetCompletionState)
+			ctx, ok := parseContext(compWordsArgs(test.words, test.cword))
+			if !ok {
+				t.Fatalf("Could not parse %q", test.words)
+			}
+
+			candidates, err := ctx.Complete()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			got := make([]string, 0, len(candidates))
+			for _, c := range candidates {
+				got = append(got, c.Value)
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
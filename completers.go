@@ -2,14 +2,26 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
 )
 
-func compNoop(ctx compContext) ([]string, error) {
+//How long to wait on prefetching the endpoints a completer needs
+const prefetchTimeout = 5 * time.Second
+
+//endpoint resolves a director path that a completer is going to need. Some
+// paths depend on what has been typed so far (e.g. the deployment)
+type endpoint func(compContext) (string, error)
+
+func compNoop(ctx compContext) ([]candidate, error) {
 	return nil, nil
 }
 
-func compCommandNames(ctx compContext) ([]string, error) {
-	var ret []string
+func compCommandNames(ctx compContext) ([]candidate, error) {
+	var ret []candidate
 	var filterOutAliases bool
 	if ctx.CurrentToken == "" {
 		filterOutAliases = true
@@ -18,225 +30,1105 @@ func compCommandNames(ctx compContext) ([]string, error) {
 		if filterOutAliases && cmd.IsAlias {
 			continue
 		}
-		ret = append(ret, cmd.Name)
+		ret = append(ret, candidate{Value: cmd.Name})
 	}
 
 	return ret, nil
 }
 
-func compFlagNames(ctx compContext) ([]string, error) {
-	var ret []string
+func compFlagNames(ctx compContext) ([]candidate, error) {
+	var ret []candidate
 	for name := range flags {
-		ret = append(ret, name)
+		ret = append(ret, candidate{Value: name, Kind: flagKind})
 	}
 
 	return ret, nil
 }
 
-func compEnvAliases(ctx compContext) ([]string, error) {
+func compEnvAliases(ctx compContext) ([]candidate, error) {
 	conf, err := getBoshConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	ret := []string{}
+	//This only ever reads the local config, so it works without a director
+	ret := []candidate{}
+	seen := map[string]bool{}
 	for _, env := range conf.Environments {
-		ret = append(ret, env.Alias)
+		if env.Alias == "" || seen[env.Alias] {
+			continue
+		}
+		seen[env.Alias] = true
+		ret = append(ret, candidate{Value: env.Alias})
 	}
 
 	return ret, nil
 }
 
-func compEnum(s ...string) func(compContext) ([]string, error) {
-	return func(compContext) ([]string, error) {
-		return s, nil
+//compEnvironments offers everything that -e can be given from the bosh config:
+// the aliases, described with their URLs, and the URLs, described with their
+// aliases
+func compEnvironments(ctx compContext) ([]candidate, error) {
+	conf, err := getBoshConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := []candidate{}
+	urls := []candidate{}
+	seen := map[string]bool{}
+	for _, env := range conf.Environments {
+		if env.Alias != "" && !seen[env.Alias] {
+			seen[env.Alias] = true
+			aliases = append(aliases, describe(env.Alias, env.URL))
+		}
+		if env.URL != "" && !seen[env.URL] {
+			seen[env.URL] = true
+			urls = append(urls, describe(env.URL, env.Alias))
+		}
+	}
+
+	return append(aliases, urls...), nil
+}
+
+func compEnum(s ...string) func(compContext) ([]candidate, error) {
+	return func(compContext) ([]candidate, error) {
+		return values(s), nil
 	}
 }
 
-func compFiles(ctx compContext) ([]string, error) {
-	return walkDirs(ctx.CurrentToken, true)
+//The bosh CLI matches --column against headers with anything that isn't a
+// letter or number turned into an underscore
+var columnKeyRegex = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+//compColumns offers the columns of the table that the command prints
+func compColumns(ctx compContext) ([]candidate, error) {
+	cmd, found := commands.Find(ctx.Command)
+	if !found {
+		return nil, nil
+	}
+
+	ret := make([]candidate, 0, len(cmd.Columns))
+	for _, header := range cmd.Columns {
+		key := strings.Trim(columnKeyRegex.ReplaceAllString(header, "_"), "_")
+		ret = append(ret, describe(strings.ToLower(key), header))
+	}
+
+	return ret, nil
 }
 
-func compDirs(ctx compContext) ([]string, error) {
-	return walkDirs(ctx.CurrentToken, false)
+func compFiles(ctx compContext) ([]candidate, error) {
+	return walkDirs(ctx.CurrentToken, anyFile)
 }
 
-func compDeployments(ctx compContext) ([]string, error) {
-	type deployment struct {
-		Name string `json:"name"`
+//compTarballs offers gzipped tarballs, and directories to find them in. URLs
+// (or what look like the start of them) are left alone
+func compTarballs(ctx compContext) ([]candidate, error) {
+	if strings.Contains(ctx.CurrentToken, ":") {
+		return nil, nil
+	}
+	return walkDirs(ctx.CurrentToken, tarball)
+}
+
+//compTarballSHAs offers the digests of the tarball given as the first
+// argument, as both a SHA1 and a SHA256, for uploads that want one. Tarballs
+// too big to hash while Tab waits (or that take longer than the completion
+// has) get nothing
+func compTarballSHAs(ctx compContext) ([]candidate, error) {
+	if len(ctx.Args) == 0 || strings.Contains(ctx.Args[0], "://") {
+		return nil, nil
 	}
 
-	client, err := getBoshClient(ctx)
+	digest, err := tarballDigests(ctx.Context, ctx.Args[0])
 	if err != nil {
-		return nil, err
+		log.Write("Not completing the digest of `%s': %s", ctx.Args[0], err)
+		return nil, nil
 	}
 
-	deployments := []deployment{}
-	err = client.Get("/deployments", &deployments)
+	return []candidate{
+		{Value: digest.SHA1},
+		{Value: "sha256:" + digest.SHA256},
+	}, nil
+}
+
+//compManifests offers YAML files. If some of those in the directory look like
+// BOSH manifests, the rest are left out
+func compManifests(ctx compContext) ([]candidate, error) {
+	candidates, err := walkDirs(ctx.CurrentToken, yamlFile)
 	if err != nil {
 		return nil, err
 	}
 
-	ret := make([]string, 0, len(deployments))
-	for _, dep := range deployments {
-		ret = append(ret, dep.Name)
+	dirs, manifests := []candidate{}, []candidate{}
+	for _, c := range candidates {
+		path := parseFilepath(c.Value)
+		if path.dir {
+			dirs = append(dirs, c)
+		} else if looksLikeManifest(path.SearchString()) {
+			manifests = append(manifests, c)
+		}
 	}
 
-	return ret, nil
+	if len(manifests) == 0 {
+		return candidates, nil
+	}
+
+	if len(dirs) == 0 && len(manifests) == 1 {
+		dontAddSpace = false
+	}
+	return append(manifests, dirs...), nil
 }
 
-func compInstanceGroups(ctx compContext) ([]string, error) {
-	client, err := getBoshClient(ctx)
-	if err != nil {
-		return nil, err
+//compDocumentPaths offers go-patch paths into the document given as the first
+// argument (for interpolate --path), one segment at a time. No space goes
+// after them, so that the next segment can be Tabbed for straight away
+func compDocumentPaths(ctx compContext) ([]candidate, error) {
+	if len(ctx.Args) == 0 {
+		return nil, nil
 	}
-	instances, err := fetchInstances(client, ctx)
-	if err != nil {
-		return nil, err
+	doc, ok := loadDocument(ctx.Args[0])
+	if !ok {
+		return nil, nil
 	}
-	uniqueMap := map[string]bool{}
-	for _, instance := range instances {
-		uniqueMap[instance.Job] = true
+
+	dontAddSpace = true
+	if !strings.HasPrefix(ctx.CurrentToken, "/") {
+		return []candidate{{Value: "/"}}, nil
 	}
 
-	ret := make([]string, 0, len(uniqueMap))
-	for group := range uniqueMap {
-		ret = append(ret, group)
+	segments := strings.Split(ctx.CurrentToken[1:], "/")
+	parent := "/" + strings.Join(segments[:len(segments)-1], "/")
+	if len(segments) > 1 {
+		parent += "/"
+	}
+
+	ret := []candidate{}
+	for _, segment := range documentPathSegments(doc, segments[:len(segments)-1]) {
+		ret = append(ret, candidate{Value: parent + segment, Display: segment})
 	}
 
 	return ret, nil
 }
 
-func compInstances(ctx compContext) ([]string, error) {
-	client, err := getBoshClient(ctx)
-	if err != nil {
-		return nil, err
-	}
-	instances, err := fetchInstances(client, ctx)
-	if err != nil {
-		return nil, err
+//compOpsFiles offers YAML files, and directories to find them in
+func compOpsFiles(ctx compContext) ([]candidate, error) {
+	return walkDirs(ctx.CurrentToken, yamlFile)
+}
+
+func compDirs(ctx compContext) ([]candidate, error) {
+	return walkDirs(ctx.CurrentToken, nil)
+}
+
+func compDeployments(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "deployments", func(client director.Director) ([]candidate, error) {
+		deployments, err := client.Deployments(ctx.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		//Team admins get shown deployments that they can only read, so leave
+		// those out
+		teams, scoped := director.TokenAdminTeams(client.CurrentAccessToken())
+		scoped = scoped && supports(client, ctx, director.FeatureTeams)
+		ret := make([]candidate, 0, len(deployments))
+		for _, dep := range deployments {
+			if scoped && !sharesTeam(dep.Teams, teams) {
+				continue
+			}
+			ret = append(ret, candidate{Value: dep.Name})
+		}
+
+		return ret, nil
+	})
+}
+
+func sharesTeam(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
 	}
-	ret := make([]string, 0, len(instances))
-	for _, instance := range instances {
-		ret = append(ret, fmt.Sprintf("%s/%s", instance.Job, instance.ID))
-		ret = append(ret, fmt.Sprintf("%s/%d", instance.Job, instance.Index))
+	return false
+}
+
+//compTeams offers the teams that own deployments on the director, along with
+// any that the token is an admin of. The director has no endpoint that lists
+// teams, so a team that owns nothing (yet) only shows up through the token
+func compTeams(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "teams", func(client director.Director) ([]candidate, error) {
+		if !supports(client, ctx, director.FeatureTeams) {
+			return nil, nil
+		}
+
+		deployments, err := client.Deployments(ctx.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		owned := map[string]int{}
+		for _, dep := range deployments {
+			for _, team := range dep.Teams {
+				owned[team]++
+			}
+		}
+		adminOf, _ := director.TokenAdminTeams(client.CurrentAccessToken())
+		for _, team := range adminOf {
+			if _, found := owned[team]; !found {
+				owned[team] = 0
+			}
+		}
+
+		ret := make([]candidate, 0, len(owned))
+		for team, count := range owned {
+			description := fmt.Sprintf("%d deployments", count)
+			if count == 1 {
+				description = "1 deployment"
+			}
+			ret = append(ret, candidate{Value: team, Description: description})
+		}
+
+		return ret, nil
+	})
+}
+
+func compInstanceGroups(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "instance-groups", func(client director.Director) ([]candidate, error) {
+		instances, err := fetchInstances(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+		uniqueMap := map[string]bool{}
+		for _, instance := range instances {
+			uniqueMap[instance.Job] = true
+		}
+
+		ret := make([]candidate, 0, len(uniqueMap))
+		for group := range uniqueMap {
+			ret = append(ret, candidate{Value: group})
+		}
+
+		return ret, nil
+	})
+}
+
+//compInstances offers instances as group/id and group/index. Until a group
+// has been picked by typing the slash after it, only the groups are offered
+// (slash and all), so that a big deployment doesn't list every instance at once
+func compInstances(ctx compContext) ([]candidate, error) {
+	slash := strings.Index(ctx.CurrentToken, "/")
+	if slash < 0 {
+		dontAddSpace = true
+		groups, err := compInstanceGroups(ctx)
+		for i := range groups {
+			groups[i].Value += "/"
+		}
+		return groups, err
 	}
 
-	return ret, nil
+	group := ctx.CurrentToken[:slash]
+	return cachedCandidates(ctx, "instances:"+group, func(client director.Director) ([]candidate, error) {
+		instances, err := fetchInstances(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret := []candidate{}
+		for _, instance := range instances {
+			if instance.Job != group {
+				continue
+			}
+			ret = append(ret, candidate{Value: fmt.Sprintf("%s/%s", instance.Job, instance.ID)})
+			ret = append(ret, candidate{Value: fmt.Sprintf("%s/%d", instance.Job, instance.Index)})
+		}
+
+		return ret, nil
+	})
 }
 
-//func compReleases(ctx compContext) ([]string, error) {
-//client, err := getBoshClient(ctx)
-//if err != nil {
-//return nil, err
-//}
-//releases, err := fetchReleases(client)
-//if err != nil {
-//return nil, err
-//}
-//ret := make([]string, 0)
-//for _, release := range releases {
-//ret = append(ret, release.Name)
-//for _, version := range release.Versions {
-//ret = append(ret, fmt.Sprintf("%s/%s", release.Name, version.Version))
-//}
-//}
-
-//return ret, nil
-//}
-
-func compUnusedStemcells(ctx compContext) ([]string, error) {
-	client, err := getBoshClient(ctx)
-	if err != nil {
-		return nil, err
+//compVMs offers the CIDs of the deployment's VMs, described with the instance
+// they belong to
+func compVMs(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "vms", func(client director.Director) ([]candidate, error) {
+		instances, err := fetchInstances(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(instances))
+		for _, instance := range instances {
+			if instance.CID == "" {
+				continue
+			}
+			ret = append(ret, describe(instance.CID, fmt.Sprintf("%s/%d (%s)", instance.Job, instance.Index, instance.ID)))
+		}
+
+		return ret, nil
+	})
+}
+
+//compSnapshots offers the CIDs of the deployment's snapshots, described with
+// the instance they were taken of and when
+func compSnapshots(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "snapshots", func(client director.Director) ([]candidate, error) {
+		snapshots, err := fetchSnapshots(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			ret = append(ret, describe(snapshot.CID, fmt.Sprintf("%s/%d at %s", snapshot.Job, snapshot.Index, snapshot.CreatedAt)))
+		}
+
+		return ret, nil
+	})
+}
+
+//compJobs offers the names of the jobs running on the deployment's instances,
+// or on just those of the instance group given as the first argument
+func compJobs(ctx compContext) ([]candidate, error) {
+	group := ""
+	if len(ctx.Args) > 0 {
+		group = strings.SplitN(ctx.Args[0], "/", 2)[0]
 	}
-	stemcells, err := fetchStemcells(client)
-	if err != nil {
-		return nil, err
+
+	return cachedCandidates(ctx, "jobs:"+group, func(client director.Director) ([]candidate, error) {
+		instances, err := fetchInstanceDetails(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := []candidate{}
+		for _, instance := range instances {
+			if group != "" && instance.Job != group {
+				continue
+			}
+			for _, process := range instance.Processes {
+				if !seen[process.Name] {
+					seen[process.Name] = true
+					ret = append(ret, candidate{Value: process.Name})
+				}
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+//compIgnoredInstances offers the instances that are currently ignored
+func compIgnoredInstances(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "ignored-instances", func(client director.Director) ([]candidate, error) {
+		instances, err := fetchInstanceDetails(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := []candidate{}
+		for _, instance := range instances {
+			if !instance.Ignore {
+				continue
+			}
+			ret = append(ret, candidate{Value: fmt.Sprintf("%s/%s", instance.Job, instance.ID)})
+			ret = append(ret, candidate{Value: fmt.Sprintf("%s/%d", instance.Job, instance.Index)})
+		}
+
+		return ret, nil
+	})
+}
+
+//compOrphanedDisks offers the CIDs of orphaned disks, described with where
+// they came from
+func compOrphanedDisks(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "orphaned-disks", func(client director.Director) ([]candidate, error) {
+		disks, err := fetchOrphanedDisks(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(disks))
+		for _, disk := range disks {
+			ret = append(ret, describe(disk.CID, fmt.Sprintf("%s/%s", disk.Deployment, disk.Instance)))
+		}
+
+		return ret, nil
+	})
+}
+
+//compAttachedDisks offers the CIDs of the disks attached to the deployment's
+// instances, described with the instance they're attached to
+func compAttachedDisks(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "attached-disks", func(client director.Director) ([]candidate, error) {
+		instances, err := fetchInstanceDetails(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		deployment, _ := ctx.FlagValue("--deployment")
+		ret := make([]candidate, 0, len(instances))
+		for _, instance := range instances {
+			for _, cid := range instance.DiskCIDs {
+				ret = append(ret, describe(cid, fmt.Sprintf("%s/%s/%s", deployment, instance.Job, instance.ID)))
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+func compErrands(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "errands", func(client director.Director) ([]candidate, error) {
+		errands, err := fetchErrands(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(errands))
+		for _, errand := range errands {
+			ret = append(ret, candidate{Value: errand.Name})
+		}
+
+		return ret, nil
+	})
+}
+
+//compTasks offers the IDs of recent tasks, described with what they were
+// doing, since the numbers alone don't mean much to anybody
+func compTasks(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "tasks", func(client director.Director) ([]candidate, error) {
+		tasks, err := fetchTasks(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(tasks))
+		for _, task := range tasks {
+			ret = append(ret, taskCandidate(task))
+		}
+
+		return ret, nil
+	})
+}
+
+//taskCandidate offers a task by its ID, described with what it was doing.
+// The IDs sort as numbers, so that 10 doesn't come before 9
+func taskCandidate(task director.Task) candidate {
+	return candidate{
+		Value:       fmt.Sprintf("%d", task.ID),
+		Description: fmt.Sprintf("%s (%s)", task.Description, task.State),
+		SortKey:     fmt.Sprintf("%020d", task.ID),
 	}
+}
+
+//compCancellableTasks offers the tasks that haven't finished yet, described
+// like compTasks
+func compCancellableTasks(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "unfinished-tasks", func(client director.Director) ([]candidate, error) {
+		tasks, err := fetchUnfinishedTasks(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(tasks))
+		for _, task := range tasks {
+			if task.Finished() {
+				continue
+			}
+			ret = append(ret, taskCandidate(task))
+		}
+
+		return ret, nil
+	})
+}
 
-	unusedStemcells := map[string]bool{}
+//configsKind is the candidate cache kind for configs, which differ by --type
+func configsKind(ctx compContext, kind string) string {
+	configType, _ := ctx.FlagValue("--type")
+	return kind + ":" + configType
+}
 
-	ret := make([]string, 0)
-	for _, stemcell := range stemcells {
-		if _, found := unusedStemcells[stemcell.Name]; !found {
-			unusedStemcells[stemcell.Name] = true
+func compConfigNames(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, configsKind(ctx, "config-names"), func(client director.Director) ([]candidate, error) {
+		configs, err := fetchConfigs(client, ctx)
+		if err != nil {
+			return nil, err
 		}
 
-		if len(stemcell.Deployments) == 0 {
-			ret = append(ret, fmt.Sprintf("%s/%s", stemcell.Name, stemcell.Version))
-		} else {
-			unusedStemcells[stemcell.Name] = false
+		seen := map[string]bool{}
+		ret := make([]candidate, 0, len(configs))
+		for _, config := range configs {
+			if !seen[config.Name] {
+				seen[config.Name] = true
+				ret = append(ret, candidate{Value: config.Name})
+			}
 		}
+
+		return ret, nil
+	})
+}
+
+//compConfigIDs offers the IDs of the current configs, described with their
+// type and name. If a name has been given, only its configs are offered
+func compConfigIDs(ctx compContext) ([]candidate, error) {
+	name, nameGiven := ctx.FlagValue("--name")
+	kind := configsKind(ctx, "config-ids")
+	if nameGiven {
+		kind += ":" + name
 	}
 
-	for name, unused := range unusedStemcells {
-		if unused {
-			ret = append(ret, name)
+	return cachedCandidates(ctx, kind, func(client director.Director) ([]candidate, error) {
+		configs, err := fetchConfigs(client, ctx)
+		if err != nil {
+			return nil, err
 		}
+
+		ret := make([]candidate, 0, len(configs))
+		for _, config := range configs {
+			if nameGiven && config.Name != name {
+				continue
+			}
+			ret = append(ret, describe(config.ID, fmt.Sprintf("%s/%s", config.Type, config.Name)))
+		}
+
+		return ret, nil
+	})
+}
+
+//compConfigRevisions offers the IDs of every revision of the configs, not just
+// the latest, described with what they're a revision of and when it was made
+func compConfigRevisions(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, configsKind(ctx, "config-revisions"), func(client director.Director) ([]candidate, error) {
+		configs, err := fetchConfigHistory(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := make([]candidate, 0, len(configs))
+		for _, config := range configs {
+			ret = append(ret, describe(config.ID, fmt.Sprintf("%s/%s (%s)", config.Type, config.Name, config.CreatedAt)))
+		}
+
+		return ret, nil
+	})
+}
+
+//compVars completes -v name=value: the names of the variables that the
+// manifest still needs (or, without one, the deployment's), and then values
+// for them from the cloud config
+func compVars(ctx compContext) ([]candidate, error) {
+	if strings.Contains(ctx.CurrentToken, "=") {
+		return compSupports(director.FeatureConfigs, compCloudVars)(ctx)
 	}
 
-	return ret, nil
+	//The value comes straight after the name
+	dontAddSpace = true
+	if strings.HasPrefix(ctx.CurrentToken, "/") && credHubEnabled() {
+		return compCredHubNames(ctx)
+	}
+	if names, found := unresolvedVars(ctx); found {
+		return varNameCandidates(names), nil
+	}
+
+	return cachedCandidates(ctx, "variable-names", func(client director.Director) ([]candidate, error) {
+		variables, err := fetchVariables(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		fullNames := make([]string, 0, len(variables))
+		for _, variable := range variables {
+			fullNames = append(fullNames, variable.Name)
+		}
+		//CredHub may well have more than the director has handed out so far
+		if credHubEnabled() {
+			credNames, err := fetchDeploymentCredHubNames(client, ctx)
+			if err != nil {
+				log.Write("Could not get variable names from CredHub: %s", err)
+			}
+			fullNames = append(fullNames, credNames...)
+		}
+
+		//Variables are named by their full path in the config server, but
+		// manifests only know them by the last part of it
+		seen := map[string]bool{}
+		ret := make([]candidate, 0, len(fullNames))
+		for _, fullName := range fullNames {
+			name := fullName[strings.LastIndex(fullName, "/")+1:]
+			if !seen[name] {
+				seen[name] = true
+				ret = append(ret, describe(name+"=", fullName))
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+func varNameCandidates(names []string) []candidate {
+	ret := make([]candidate, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, candidate{Value: name + "="})
+	}
+	return ret
 }
 
-func compSpecificReleases(ctx compContext) ([]string, error) {
-	client, err := getBoshClient(ctx)
+//compVarFiles completes --var-file name=path: the names of the variables the
+// manifest still needs, and then any file
+func compVarFiles(ctx compContext) ([]candidate, error) {
+	parts := strings.SplitN(ctx.CurrentToken, "=", 2)
+	if len(parts) == 1 {
+		dontAddSpace = true
+		names, _ := unresolvedVars(ctx)
+		return varNameCandidates(names), nil
+	}
+
+	paths, err := walkDirs(parts[1], anyFile)
 	if err != nil {
 		return nil, err
 	}
-	releases, err := fetchReleases(client)
+
+	ret := make([]candidate, 0, len(paths))
+	for _, path := range paths {
+		ret = append(ret, path.withValue(parts[0]+"="+path.Value))
+	}
+	return ret, nil
+}
+
+//compVarsFiles offers YAML files, and if there's a manifest, only those that
+// set some of the variables that it still needs
+func compVarsFiles(ctx compContext) ([]candidate, error) {
+	names, found := unresolvedVars(ctx)
+	if !found {
+		return walkDirs(ctx.CurrentToken, yamlFile)
+	}
+
+	needed := map[string]bool{}
+	for _, name := range names {
+		needed[name] = true
+	}
+
+	return walkDirs(ctx.CurrentToken, func(path string) bool {
+		if !yamlFile(path) {
+			return false
+		}
+		for _, name := range varsFileNames(path) {
+			if needed[name] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+//cloudVarKind works out which part of the cloud config a variable given with
+// -v is likely to name, going by the usual names for such variables (az,
+// z1_az, default_vm_type, networks, ...), or returns "" if there's no telling
+func cloudVarKind(name string) string {
+	name = strings.ToLower(strings.Replace(name, "-", "_", -1))
+	switch {
+	case strings.Contains(name, "vm_extension"):
+		return "vm_extensions"
+	case strings.Contains(name, "vm_type"):
+		return "vm_types"
+	case strings.Contains(name, "network"):
+		return "networks"
+	case name == "az" || name == "azs" || strings.HasSuffix(name, "_az") || strings.HasSuffix(name, "_azs"):
+		return "azs"
+	}
+	return ""
+}
+
+//compCloudVars offers values for -v name=value from the cloud config, when
+// the name looks like it's meant for an AZ, VM type, network, or VM extension
+func compCloudVars(ctx compContext) ([]candidate, error) {
+	parts := strings.SplitN(ctx.CurrentToken, "=", 2)
+	if len(parts) != 2 {
+		return nil, nil
+	}
+
+	kind := cloudVarKind(parts[0])
+	if kind == "" {
+		return nil, nil
+	}
+
+	names, err := cachedCandidates(ctx, "cloud-config-"+kind, func(client director.Director) ([]candidate, error) {
+		cloud, err := fetchCloudConfig(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		items := map[string][]cloudConfigItem{
+			"azs":           cloud.AZs,
+			"vm_types":      cloud.VMTypes,
+			"networks":      cloud.Networks,
+			"vm_extensions": cloud.VMExtensions,
+		}[kind]
+
+		seen := map[string]bool{}
+		ret := make([]candidate, 0, len(items))
+		for _, item := range items {
+			if !seen[item.Name] {
+				seen[item.Name] = true
+				ret = append(ret, candidate{Value: item.Name})
+			}
+		}
+
+		return ret, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	ret := make([]string, 0)
-	for _, release := range releases {
-		for _, version := range release.Versions {
-			ret = append(ret, fmt.Sprintf("%s/%s", release.Name, version.Version))
-		}
+
+	ret := make([]candidate, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, name.withValue(parts[0]+"="+name.Value))
 	}
 
 	return ret, nil
 }
 
-func compUnusedReleases(ctx compContext) ([]string, error) {
-	client, err := getBoshClient(ctx)
+//compResolutions offers the resolutions for the problems that the last
+// cloud-check of the deployment found, described with what they'd do. If it
+// found none (or hasn't been run), any resolution will do
+func compResolutions(ctx compContext) ([]candidate, error) {
+	resolutions, err := cachedCandidates(ctx, "resolutions", func(client director.Director) ([]candidate, error) {
+		problems, err := fetchProblems(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := []candidate{}
+		for _, problem := range problems {
+			for _, resolution := range problem.Resolutions {
+				if !seen[resolution.Name] {
+					seen[resolution.Name] = true
+					ret = append(ret, describe(resolution.Name, resolution.Plan))
+				}
+			}
+		}
+
+		return ret, nil
+	})
 	if err != nil {
-		return nil, err
+		log.Write("Could not get cloud-check problems: %s", err)
 	}
-	releases, err := fetchReleases(client)
-	if err != nil {
-		return nil, err
+	if len(resolutions) == 0 {
+		return compVocabulary("resolutions")(ctx)
 	}
-	ret := make([]string, 0)
-	for _, release := range releases {
-		allUnused := true
-		for _, version := range release.Versions {
-			if version.CurrentlyDeployed {
-				allUnused = false
+
+	return resolutions, nil
+}
+
+//compEventUsers offers the users seen in recent events
+func compEventUsers(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "event-users", func(client director.Director) ([]candidate, error) {
+		events, err := fetchEvents(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := []candidate{}
+		for _, event := range events {
+			if event.User != "" && !seen[event.User] {
+				seen[event.User] = true
+				ret = append(ret, candidate{Value: event.User})
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+//compEventObjectNames offers the names of objects seen in recent events, of
+// the given --object-type if there is one
+func compEventObjectNames(ctx compContext) ([]candidate, error) {
+	objectType, _ := ctx.FlagValue("--object-type")
+	return cachedCandidates(ctx, "event-object-names:"+objectType, func(client director.Director) ([]candidate, error) {
+		events, err := fetchEvents(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := []candidate{}
+		for _, event := range events {
+			if objectType != "" && event.ObjectType != objectType {
+				continue
+			}
+			if event.ObjectName != "" && !seen[event.ObjectName] {
+				seen[event.ObjectName] = true
+				ret = append(ret, candidate{Value: event.ObjectName})
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+func compReleaseNames(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "release-names", func(client director.Director) ([]candidate, error) {
+		releases, err := fetchReleases(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]candidate, 0, len(releases))
+		for _, release := range releases {
+			ret = append(ret, candidate{Value: release.Name})
+		}
+
+		return ret, nil
+	})
+}
+
+func compStemcellNames(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "stemcell-names", func(client director.Director) ([]candidate, error) {
+		stemcells, err := fetchStemcells(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := make([]candidate, 0)
+		for _, stemcell := range stemcells {
+			if !seen[stemcell.Name] {
+				seen[stemcell.Name] = true
+				ret = append(ret, candidate{Value: stemcell.Name})
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+//compStemcellOSVersions offers stemcells the way releases are compiled
+// against them, as os/version, described with the stemcell's name. The same
+// stemcell uploaded for more than one CPI is only offered once
+func compStemcellOSVersions(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "stemcell-os-versions", func(client director.Director) ([]candidate, error) {
+		stemcells, err := fetchStemcells(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := make([]candidate, 0, len(stemcells))
+		for _, stemcell := range stemcells {
+			slug := fmt.Sprintf("%s/%s", stemcell.OperatingSystem, stemcell.Version)
+			if stemcell.OperatingSystem == "" || seen[slug] {
+				continue
+			}
+			seen[slug] = true
+			ret = append(ret, describe(slug, stemcell.Name))
+		}
+
+		return ret, nil
+	})
+}
+
+func compUnusedStemcells(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "unused-stemcells", func(client director.Director) ([]candidate, error) {
+		stemcells, err := fetchStemcells(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		unusedStemcells := map[string]bool{}
+
+		ret := make([]candidate, 0)
+		for _, stemcell := range stemcells {
+			if _, found := unusedStemcells[stemcell.Name]; !found {
+				unusedStemcells[stemcell.Name] = true
+			}
+
+			if len(stemcell.Deployments) == 0 {
+				ret = append(ret, candidate{Value: fmt.Sprintf("%s/%s", stemcell.Name, stemcell.Version)})
 			} else {
-				ret = append(ret, fmt.Sprintf("%s/%s", release.Name, version.Version))
+				unusedStemcells[stemcell.Name] = false
 			}
 		}
 
-		if allUnused {
-			ret = append(ret, release.Name)
+		for name, unused := range unusedStemcells {
+			if unused {
+				ret = append(ret, candidate{Value: name})
+			}
 		}
-	}
 
-	return ret, nil
+		return ret, nil
+	})
+}
+
+func compSpecificReleases(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "specific-releases", func(client director.Director) ([]candidate, error) {
+		releases, err := fetchReleases(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]candidate, 0)
+		for _, release := range releases {
+			for _, version := range release.Versions {
+				ret = append(ret, candidate{Value: fmt.Sprintf("%s/%s", release.Name, version.Version)})
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+func compUnusedReleases(ctx compContext) ([]candidate, error) {
+	return cachedCandidates(ctx, "unused-releases", func(client director.Director) ([]candidate, error) {
+		releases, err := fetchReleases(client, ctx)
+		if err != nil {
+			return nil, err
+		}
+		ret := make([]candidate, 0)
+		for _, release := range releases {
+			allUnused := true
+			for _, version := range release.Versions {
+				if version.CurrentlyDeployed {
+					allUnused = false
+				} else {
+					ret = append(ret, candidate{Value: fmt.Sprintf("%s/%s", release.Name, version.Version)})
+				}
+			}
+
+			if allUnused {
+				ret = append(ret, candidate{Value: release.Name})
+			}
+		}
+
+		return ret, nil
+	})
+}
+
+//compSlugs narrows down the name/version slugs offered by fn to a name at a
+// time, so that the versions of a dozen releases don't all come up at once.
+// Until a `/' is typed, only the names are offered: bare if fn offers the
+// name on its own, or else with the `/' on the end. Once the token narrows
+// things down to one name, its versions come along too
+func compSlugs(fn compFunc) compFunc {
+	return func(ctx compContext) ([]candidate, error) {
+		candidates, err := fn(ctx)
+		if err != nil || strings.Contains(ctx.CurrentToken, "/") {
+			return candidates, err
+		}
+
+		token := strings.TrimLeft(ctx.CurrentToken, `"'`)
+		bare := map[string]bool{}
+		slugs := map[string][]candidate{}
+		names := []string{}
+		for _, c := range candidates {
+			name := strings.SplitN(c.Value, "/", 2)[0]
+			if !strings.HasPrefix(name, token) {
+				continue
+			}
+			if !bare[name] && slugs[name] == nil {
+				names = append(names, name)
+			}
+			if name == c.Value {
+				bare[name] = true
+			} else {
+				slugs[name] = append(slugs[name], c)
+			}
+		}
+
+		if len(names) == 1 {
+			name := names[0]
+			if !bare[name] {
+				//Nothing to do with just the name, so head straight for the
+				// versions
+				dontAddSpace = true
+				return slugs[name], nil
+			}
+			return append([]candidate{{Value: name}}, slugs[name]...), nil
+		}
+
+		ret := make([]candidate, 0, len(names))
+		for _, name := range names {
+			if bare[name] {
+				ret = append(ret, candidate{Value: name})
+			} else {
+				ret = append(ret, candidate{Value: name + "/"})
+			}
+		}
+
+		dontAddSpace = true
+		return ret, nil
+	}
 }
 
+//compOr runs each of the given completers in turn and merges their
+// candidates, in the order the completers were given. They run one after
+// another because completers set dontAddSpace and the like as they go; any
+// fetching worth doing in parallel is done up front by compRequires
 func compOr(fns ...compFunc) compFunc {
-	return func(ctx compContext) ([]string, error) {
-		ret := []string{}
+	return func(ctx compContext) ([]candidate, error) {
+		ret := []candidate{}
 		for _, fn := range fns {
-			theseComps, err := fn(ctx)
+			candidates, err := fn(ctx)
 			if err != nil {
 				return nil, err
 			}
 
-			ret = append(ret, theseComps...)
+			ret = append(ret, candidates...)
 		}
 		return ret, nil
 	}
 }
+
+//compRequires fetches all of the endpoints needed by fn in parallel before
+// handing off to it. This keeps the pieces of a compOr from each separately
+// fetching the same endpoint, and lets completers that need several resource
+// types wait on the slowest one instead of all of them back to back
+func compRequires(fn compFunc, endpoints ...endpoint) compFunc {
+	return func(ctx compContext) ([]candidate, error) {
+		client, err := getDirector(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		paths := make([]string, 0, len(endpoints))
+		for _, ep := range endpoints {
+			path, err := ep(ctx)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+		}
+
+		//Whichever completer actually needs a path that failed will run into its
+		// error again when it calls Get itself, and can decide what to do then
+		err = client.GetMany(ctx.Context, paths, prefetchTimeout)
+		if err != nil {
+			log.Write("prefetch incomplete: %s", err)
+		}
+
+		return fn(ctx)
+	}
+}
+
+//compSupports only runs fn against directors that have the given feature, so
+// that completers relying on newer endpoints quietly offer nothing on older
+// directors instead of erroring out
+func compSupports(feature director.Feature, fn compFunc) compFunc {
+	return func(ctx compContext) ([]candidate, error) {
+		client, err := getDirector(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := client.Info(ctx.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.Supports(feature) {
+			log.Write("Director version %s doesn't have %s (new in %s). Skipping completion", info.Version, feature.Name, feature.MinVersion)
+			return nil, nil
+		}
+
+		return fn(ctx)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+	"github.com/thomasmitchell/bosh-complete/director/directortest"
+)
+
+//fakeDirector starts a fake director for the test, and points completions at
+// it with the client and secret that it takes
+func fakeDirector(t *testing.T, auth directortest.Auth) *directortest.Server {
+	t.Helper()
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home+"/cache")
+
+	auth.ClientID, auth.ClientSecret = "ci", "ci-secret"
+	srv := directortest.NewServer(auth)
+	t.Cleanup(srv.Close)
+	t.Setenv("BOSH_ENVIRONMENT", srv.URL)
+	t.Setenv("BOSH_CLIENT", "ci")
+	t.Setenv("BOSH_CLIENT_SECRET", "ci-secret")
+
+	//Clients and candidates from other tests were for other directors
+	forget := func() {
+		boshClients = &clientPool{clients: map[string]*pooledClient{}}
+		candidateCacheLock.Lock()
+		candidateCache = map[candidateKey]candidateEntry{}
+		candidateCacheLock.Unlock()
+	}
+	forget()
+	t.Cleanup(forget)
+
+	return srv
+}
+
+//complete runs fn for the given command line, returning the values of the
+// candidates that it comes up with, sorted
+func complete(t *testing.T, fn compFunc, args ...string) []string {
+	t.Helper()
+	resetCompletionState()
+	insertGlobalFlags()
+	ctx, ok := parseContext(append([]string{"bosh"}, args...))
+	if !ok {
+		t.Fatalf("Could not parse %q", args)
+	}
+
+	candidates, err := fn(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ret = append(ret, c.Value)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestDirectorCompleters(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   compFunc
+		args []string
+		want []string
+	}{
+		{"deployments", compDeployments, []string{"-d", ""}, []string{"cf", "redis"}},
+		{"teams", compTeams, []string{"--team", ""}, []string{"cf-team", "data-team"}},
+		{"instance groups", compInstances, []string{"-d", "cf", "ssh", ""}, []string{"diego-cell/", "router/", "smoke-tests/"}},
+		{"instances", compInstances, []string{"-d", "cf", "ssh", "router/"}, []string{
+			"router/0", "router/0a1b2c3d-0000-0000-0000-000000000000",
+			"router/1", "router/1a1b2c3d-0000-0000-0000-000000000000",
+		}},
+		{"errands", compErrands, []string{"-d", "cf", "run-errand", ""}, []string{"smoke-tests"}},
+		{"orphaned disks", compOrphanedDisks, []string{"delete-disk", ""}, []string{"disk-0"}},
+		{"releases", compReleaseNames, []string{"inspect-release", ""}, []string{"routing"}},
+		{"stemcells", compStemcellNames, []string{"stemcells", ""}, []string{"bosh-warden-boshlite-ubuntu-jammy-go_agent"}},
+		{"missing deployment", compErrands, []string{"-d", "zookeeper", "run-errand", ""}, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeDirector(t, directortest.Auth{})
+			got := complete(t, test.fn, test.args...)
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got  %q\nwant %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompletersAuthenticateThroughUAA(t *testing.T) {
+	srv := fakeDirector(t, directortest.Auth{Type: "uaa"})
+
+	got := complete(t, compDeployments, "-d", "")
+	if strings.Join(got, " ") != "cf redis" {
+		t.Errorf("Expected cf and redis, got %q", got)
+	}
+	if grants := srv.Requests("/oauth/token"); grants != 1 {
+		t.Errorf("Expected the one grant, got %d", grants)
+	}
+}
+
+//A team admin is shown the deployments that their teams own, but can still be
+// offered any team for --team
+func TestCompletersForTeamAdmins(t *testing.T) {
+	fakeDirector(t, directortest.Auth{Type: "uaa", Scopes: []string{"bosh.teams.cf-team.admin"}})
+
+	if got := complete(t, compDeployments, "-d", ""); strings.Join(got, " ") != "cf" {
+		t.Errorf("Expected only cf, got %q", got)
+	}
+	if got := complete(t, compTeams, "--team", ""); strings.Join(got, " ") != "cf-team data-team" {
+		t.Errorf("Expected both teams, got %q", got)
+	}
+}
+
+func TestCompletersCacheCandidates(t *testing.T) {
+	srv := fakeDirector(t, directortest.Auth{})
+
+	for i := 0; i < 3; i++ {
+		complete(t, compDeployments, "-d", "")
+	}
+	if got := srv.Requests(director.DeploymentsPath); got != 1 {
+		t.Errorf("Expected deployments to be fetched once, got %d", got)
+	}
+}
+
+func TestCompTeamsOnOldDirectors(t *testing.T) {
+	srv := fakeDirector(t, directortest.Auth{})
+	srv.Version = "260.0.0"
+
+	if got := complete(t, compTeams, "--team", ""); len(got) != 0 {
+		t.Errorf("Expected no teams from a director without them, got %q", got)
+	}
+	if got := srv.Requests(director.DeploymentsPath); got != 0 {
+		t.Errorf("Expected deployments not to be asked for, got %d requests", got)
+	}
+}
+
+func TestCompOr(t *testing.T) {
+	spaced := func(compContext) ([]candidate, error) {
+		return []candidate{{Value: "release.tgz"}}, nil
+	}
+	unspaced := func(compContext) ([]candidate, error) {
+		dontAddSpace = true
+		return []candidate{{Value: "https://bosh.io/"}}, nil
+	}
+
+	for _, fns := range [][]compFunc{{spaced, unspaced}, {unspaced, spaced}} {
+		resetCompletionState()
+		got, err := compOr(fns...)(compContext{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("Expected both candidates, got %+v", got)
+		}
+		//Whichever order they run in, one not wanting a space wins
+		if !dontAddSpace {
+			t.Errorf("Expected no space after the candidates")
+		}
+	}
+	resetCompletionState()
+}
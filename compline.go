@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+//argsFromCompLine reads COMP_LINE and COMP_POINT from the environment, if
+// the shell set them, and splits the line up to the cursor into words the
+// way the shell would. The last word returned is the (possibly partial) word
+// under the cursor, which is empty if the cursor follows whitespace.
+func argsFromCompLine() ([]string, bool) {
+	line, lineSet := os.LookupEnv("COMP_LINE")
+	if !lineSet {
+		return nil, false
+	}
+
+	point := len(line)
+	if pointStr := os.Getenv("COMP_POINT"); pointStr != "" {
+		var err error
+		point, err = strconv.Atoi(pointStr)
+		if err != nil {
+			log.Write("Could not parse COMP_POINT `%s': %s", pointStr, err)
+			return nil, false
+		}
+		point = compPointOffset(line, point)
+	}
+
+	if point < 0 || point > len(line) {
+		log.Write("COMP_POINT %d is outside of COMP_LINE (length %d)", point, len(line))
+		point = len(line)
+	}
+
+	return splitCompLine(line[:point]), true
+}
+
+//wordsAfterCursor returns the whole words on COMP_LINE after the cursor, for
+// when the user has gone back to fill in something earlier in the line. The
+// rest of the word under the cursor doesn't count
+func wordsAfterCursor() []string {
+	line := os.Getenv("COMP_LINE")
+	point, err := strconv.Atoi(os.Getenv("COMP_POINT"))
+	if err != nil {
+		return nil
+	}
+	point = compPointOffset(line, point)
+	if point < 0 || point >= len(line) {
+		return nil
+	}
+
+	ret := splitCompLine(line[point:])
+	if !strings.ContainsAny(line[point:point+1], " \t\n") {
+		ret = ret[1:]
+	}
+	if len(ret) > 0 && ret[len(ret)-1] == "" {
+		ret = ret[:len(ret)-1]
+	}
+
+	return ret
+}
+
+//Shells whose scripts give COMP_POINT in characters, where bash gives it in
+// bytes
+var compPointInCharacters = map[string]bool{
+	"fish": true,
+	"zsh":  true,
+}
+
+//compPointOffset returns the byte offset into line of the cursor at point,
+// which the shell being completed for may have counted in characters
+func compPointOffset(line string, point int) int {
+	if !compPointInCharacters[opts.Shell] || point < 0 {
+		return point
+	}
+
+	for offset := range line {
+		if point == 0 {
+			return offset
+		}
+		point--
+	}
+	//Anything past the end stays past it
+	return len(line) + point
+}
+
+//splitCompLine splits a (partial) command line into words, honoring single
+// quotes, double quotes, and backslash escapes. Quotes are removed from the
+// returned words. An unterminated quote is treated as running to the end of
+// the line, which is what happens while the user is mid-way through typing a
+// quoted word.
+func splitCompLine(line string) []string {
+	ret := []string{}
+	cur := strings.Builder{}
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				ret = append(ret, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	//Whatever is left is the word under the cursor, even if it is empty
+	ret = append(ret, cur.String())
+	return ret
+}
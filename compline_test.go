@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCompLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string
+	}{
+		{"plain words", "bosh -d cf", []string{"bosh", "-d", "cf"}},
+		{"cursor after a space", "bosh -d ", []string{"bosh", "-d", ""}},
+		{"runs of whitespace", "bosh \t -d\ncf", []string{"bosh", "-d", "cf"}},
+		{"single quotes", "bosh -d 'my dep'", []string{"bosh", "-d", "my dep"}},
+		{"double quotes", `bosh -d "my dep"`, []string{"bosh", "-d", "my dep"}},
+		{"quotes within a word", `bosh -d my'x y'"z"`, []string{"bosh", "-d", "myx yz"}},
+		{"empty quotes", `bosh -d ''`, []string{"bosh", "-d", ""}},
+		{"escaped space", `bosh -d my\ dep`, []string{"bosh", "-d", "my dep"}},
+		{"escaped quote", `bosh -d my\'dep`, []string{"bosh", "-d", "my'dep"}},
+		{"escape in double quotes", `bosh -d "a\"b"`, []string{"bosh", "-d", `a"b`}},
+		{"backslash in single quotes", `bosh -d 'a\b'`, []string{"bosh", "-d", `a\b`}},
+		{"unterminated single quote", "bosh -d 'my de", []string{"bosh", "-d", "my de"}},
+		{"unterminated double quote", `bosh -d "my `, []string{"bosh", "-d", "my "}},
+		{"trailing backslash", `bosh -d my\`, []string{"bosh", "-d", "my"}},
+		{"empty line", "", []string{""}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitCompLine(test.line)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("splitCompLine(%q) = %q, want %q", test.line, got, test.want)
+			}
+		})
+	}
+}
+
+func TestArgsFromCompLine(t *testing.T) {
+	const line = "bosh -d my-deployment ssh"
+	tests := []struct {
+		name  string
+		point string
+		want  []string
+		ok    bool
+	}{
+		{"cursor at the end of the line", "25", []string{"bosh", "-d", "my-deployment", "ssh"}, true},
+		{"no COMP_POINT", "", []string{"bosh", "-d", "my-deployment", "ssh"}, true},
+		{"cursor in the middle of a word", "10", []string{"bosh", "-d", "my"}, true},
+		{"cursor at the start of a word", "8", []string{"bosh", "-d", ""}, true},
+		{"cursor right after a word", "7", []string{"bosh", "-d"}, true},
+		{"cursor past the end", "99", []string{"bosh", "-d", "my-deployment", "ssh"}, true},
+		{"unparseable COMP_POINT", "x", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("COMP_LINE", line)
+			t.Setenv("COMP_POINT", test.point)
+
+			got, ok := argsFromCompLine()
+			if ok != test.ok || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("argsFromCompLine() with COMP_POINT=%q = %q, %t, want %q, %t",
+					test.point, got, ok, test.want, test.ok)
+			}
+		})
+	}
+
+	t.Run("quoted word under the cursor", func(t *testing.T) {
+		t.Setenv("COMP_LINE", `bosh -d "my dep`)
+		t.Setenv("COMP_POINT", "15")
+
+		got, _ := argsFromCompLine()
+		want := []string{"bosh", "-d", "my dep"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("argsFromCompLine() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("no COMP_LINE", func(t *testing.T) {
+		t.Setenv("COMP_LINE", "")
+		os.Unsetenv("COMP_LINE")
+
+		if got, ok := argsFromCompLine(); ok {
+			t.Errorf("argsFromCompLine() = %q, true without COMP_LINE", got)
+		}
+	})
+}
+
+func TestWordsAfterCursor(t *testing.T) {
+	const line = "bosh -d my-deployment ssh web/0"
+	tests := []struct {
+		name  string
+		point string
+		want  []string
+	}{
+		{"cursor at the end of the line", "31", nil},
+		{"cursor in the middle of a word", "10", []string{"ssh", "web/0"}},
+		{"cursor before a space", "7", []string{"my-deployment", "ssh", "web/0"}},
+		{"cursor at the start of a word", "8", []string{"ssh", "web/0"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("COMP_LINE", line)
+			t.Setenv("COMP_POINT", test.point)
+
+			got := wordsAfterCursor()
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wordsAfterCursor() with COMP_POINT=%q = %q, want %q", test.point, got, test.want)
+			}
+		})
+	}
+}
+
+//fish and zsh count the characters up to the cursor, not the bytes
+func TestCompPointInCharacters(t *testing.T) {
+	const line = "bosh -d café ssh"
+	tests := []struct {
+		shell string
+		point string
+		args  []string
+		after []string
+	}{
+		{"bash", "13", []string{"bosh", "-d", "café"}, []string{"ssh"}},
+		{"fish", "12", []string{"bosh", "-d", "café"}, []string{"ssh"}},
+		{"zsh", "12", []string{"bosh", "-d", "café"}, []string{"ssh"}},
+		{"fish", "11", []string{"bosh", "-d", "caf"}, []string{"ssh"}},
+		{"fish", "16", []string{"bosh", "-d", "café", "ssh"}, nil},
+		{"fish", "99", []string{"bosh", "-d", "café", "ssh"}, nil},
+	}
+
+	defer func() { opts.Shell = "" }()
+	for _, test := range tests {
+		t.Run(test.shell+" at "+test.point, func(t *testing.T) {
+			opts.Shell = test.shell
+			t.Setenv("COMP_LINE", line)
+			t.Setenv("COMP_POINT", test.point)
+
+			if got, _ := argsFromCompLine(); !reflect.DeepEqual(got, test.args) {
+				t.Errorf("argsFromCompLine() = %q, want %q", got, test.args)
+			}
+			if got := wordsAfterCursor(); !reflect.DeepEqual(got, test.after) {
+				t.Errorf("wordsAfterCursor() = %q, want %q", got, test.after)
+			}
+		})
+	}
+}
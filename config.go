@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//boshConfig is the config file that the bosh CLI keeps its environments in
+type boshConfig struct {
+	Environments []boshEnvironment `yaml:"environments"`
+	//Problems found with entries in the config that caused them to be skipped
+	Problems []string `yaml:"-"`
+	//Where the config was read from
+	Location string `yaml:"-"`
+}
+
+type boshEnvironment struct {
+	URL             string `yaml:"url"`
+	CACert          string `yaml:"ca_cert"`
+	Alias           string `yaml:"alias"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	AccessToken     string `yaml:"access_token"`
+	AccessTokenType string `yaml:"access_token_type"`
+	RefreshToken    string `yaml:"refresh_token"`
+}
+
+func defaultBoshConfigPath() string {
+	return fmt.Sprintf("%s/.bosh/config", homeDir())
+}
+
+func getBoshConfig(ctx compContext) (*boshConfig, error) {
+	location, found := ctx.FlagValue("--config")
+	if !found {
+		return loadBoshConfig(defaultBoshConfigPath())
+	}
+
+	//Unlike the default location, a config that was asked for by name had
+	// better be there
+	if _, err := os.Stat(location); os.IsNotExist(err) {
+		return nil, fmt.Errorf("bosh config `%s' does not exist", location)
+	}
+
+	return loadBoshConfig(location)
+}
+
+//loadBoshConfig parses the bosh CLI config at the given location. Not having
+// a config at all is fine - it just means that no environments have been
+// set up yet
+func loadBoshConfig(location string) (*boshConfig, error) {
+	ret := &boshConfig{Location: location}
+
+	confFile, err := os.Open(location)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Write("No bosh config found at `%s'", location)
+			return ret, nil
+		}
+		return nil, err
+	}
+
+	defer func() { _ = confFile.Close() }()
+
+	//Decode each environment separately, so that one broken entry doesn't keep
+	// the rest of them from being used
+	raw := struct {
+		Environments []interface{} `yaml:"environments"`
+	}{}
+
+	err = yaml.NewDecoder(confFile).Decode(&raw)
+	//An empty file has no YAML document in it at all
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("Could not parse bosh config at `%s': %s", location, err)
+	}
+
+	for i, rawEnv := range raw.Environments {
+		env, err := parseBoshEnvironment(rawEnv)
+		if err != nil {
+			problem := fmt.Sprintf("environment #%d in `%s' %s", i+1, location, err)
+			log.Write("Skipping %s", problem)
+			ret.Problems = append(ret.Problems, problem)
+			continue
+		}
+
+		ret.Environments = append(ret.Environments, env)
+	}
+
+	return ret, nil
+}
+
+func parseBoshEnvironment(raw interface{}) (boshEnvironment, error) {
+	ret := boshEnvironment{}
+
+	envYAML, err := yaml.Marshal(raw)
+	if err != nil {
+		return ret, fmt.Errorf("could not be read: %s", err)
+	}
+
+	err = yaml.Unmarshal(envYAML, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("is malformed: %s", err)
+	}
+
+	if ret.URL == "" {
+		if ret.Alias != "" {
+			return ret, fmt.Errorf("(alias `%s') has no url", ret.Alias)
+		}
+		return ret, fmt.Errorf("has no url")
+	}
+
+	return ret, nil
+}
+
+//resolveEnvironment figures out the director address for the given
+// environment name, along with the config entry holding its auth info, if
+// there is one. Like the bosh CLI, the name is first looked up as an alias,
+// and then the first environment with the resulting address is used for
+// everything else. A name that isn't an alias is taken to be an address.
+func (c *boshConfig) resolveEnvironment(name string) (string, *boshEnvironment) {
+	addr := name
+	for _, e := range c.Environments {
+		if e.Alias == name {
+			addr = e.URL
+			break
+		}
+	}
+
+	for i := range c.Environments {
+		if c.Environments[i].URL == addr {
+			return addr, &c.Environments[i]
+		}
+	}
+
+	log.Write("No environment in the bosh config for `%s'", name)
+	return addr, nil
+}
+
+//saveTokens writes the tokens from a new UAA grant back into the bosh CLI
+// config for the environment with the given URL, like the bosh CLI does when
+// it refreshes its own tokens. Everything else in the config is left as is.
+func (c *boshConfig) saveTokens(envURL, accessToken, refreshToken string) error {
+	found := false
+	err := c.updateEnvironments(func(env yaml.MapSlice) (yaml.MapSlice, bool) {
+		if found || fmt.Sprintf("%v", mapSliceGet(env, "url")) != envURL {
+			return env, false
+		}
+
+		found = true
+		env = mapSliceSet(env, "access_token", accessToken)
+		env = mapSliceSet(env, "access_token_type", "bearer")
+		env = mapSliceSet(env, "refresh_token", refreshToken)
+		return env, true
+	})
+
+	if err == nil && !found {
+		log.Write("Not saving tokens: no environment for `%s' in the bosh config", envURL)
+	}
+
+	return err
+}
+
+//clearTokens removes any stored tokens for the environment with the given
+// alias or URL, or for all environments if name is empty. It returns the
+// number of environments that had tokens removed
+func (c *boshConfig) clearTokens(name string) (int, error) {
+	cleared := 0
+	err := c.updateEnvironments(func(env yaml.MapSlice) (yaml.MapSlice, bool) {
+		if name != "" &&
+			fmt.Sprintf("%v", mapSliceGet(env, "alias")) != name &&
+			fmt.Sprintf("%v", mapSliceGet(env, "url")) != name {
+			return env, false
+		}
+
+		ret := yaml.MapSlice{}
+		for _, item := range env {
+			switch item.Key {
+			case "access_token", "access_token_type", "refresh_token":
+			default:
+				ret = append(ret, item)
+			}
+		}
+
+		if len(ret) == len(env) {
+			return env, false
+		}
+
+		cleared++
+		return ret, true
+	})
+
+	return cleared, err
+}
+
+//updateEnvironments calls fn with each environment in the config file, which
+// returns the environment as it should be, and whether it changed. If any
+// changed, the config is rewritten. Everything else in the file is left as
+// is, and the file is locked throughout.
+func (c *boshConfig) updateEnvironments(fn func(yaml.MapSlice) (yaml.MapSlice, bool)) error {
+	unlock, err := lockFile(c.Location + ".lock")
+	if err != nil {
+		return fmt.Errorf("Could not lock bosh config: %s", err)
+	}
+	defer unlock()
+
+	//Reread the config now that we hold the lock, in case it has changed
+	contents, err := ioutil.ReadFile(c.Location)
+	if err != nil {
+		return err
+	}
+
+	doc := yaml.MapSlice{}
+	err = yaml.Unmarshal(contents, &doc)
+	if err != nil {
+		return err
+	}
+
+	envs, _ := mapSliceGet(doc, "environments").([]interface{})
+	changed := false
+	for i := range envs {
+		env, isMap := envs[i].(yaml.MapSlice)
+		if !isMap {
+			continue
+		}
+
+		var thisChanged bool
+		envs[i], thisChanged = fn(env)
+		changed = changed || thisChanged
+	}
+
+	if !changed {
+		return nil
+	}
+
+	out, err := yaml.Marshal(mapSliceSet(doc, "environments", envs))
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.Location, out)
+}
+
+func mapSliceGet(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if k, isString := item.Key.(string); isString && k == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func mapSliceSet(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if k, isString := item.Key.(string); isString && k == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
+
+//writeFileAtomic writes to a temp file next to the destination and moves it
+// into place, so that nobody ever reads a half-written file
+func writeFileAtomic(location string, contents []byte) error {
+	return writeFileAtomicMode(location, contents, 0600)
+}
+
+func writeFileAtomicMode(location string, contents []byte, mode os.FileMode) error {
+	tmp, err := ioutil.TempFile(fp.Dir(location), ".bosh-complete-")
+	if err != nil {
+		return err
+	}
+
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpName, location)
+}
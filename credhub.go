@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//credHubEnabled returns whether variable names may be looked up in the
+// director's CredHub. It doesn't unless told to, with credhub: true in the
+// tool config or BOSH_COMPLETE_CREDHUB=true
+func credHubEnabled() bool {
+	return envBool("BOSH_COMPLETE_CREDHUB", getToolConfig().CredHub)
+}
+
+//getCredHub returns a client for the CredHub that the director keeps its
+// variables in, or nil if it has none. Like the credhub CLI, it's told where
+// CredHub is and who to be with $CREDHUB_SERVER, $CREDHUB_CLIENT,
+// $CREDHUB_SECRET, and $CREDHUB_CA_CERT. Without a client, it goes as whoever
+// is asking the director
+func getCredHub(c director.Director, ctx compContext) (*director.CredHub, error) {
+	ret := &director.CredHub{
+		URL:          os.Getenv("CREDHUB_SERVER"),
+		ClientID:     os.Getenv("CREDHUB_CLIENT"),
+		ClientSecret: os.Getenv("CREDHUB_SECRET"),
+		AccessToken:  c.CurrentAccessToken(),
+		AllProxy:     os.Getenv("BOSH_ALL_PROXY"),
+		Offline:      offlineMode(),
+		Logger:       &log,
+	}
+
+	if ret.URL == "" {
+		info, err := c.Info(ctx.Context)
+		if err != nil {
+			return nil, err
+		}
+		url, found := info.CredHubURL()
+		if !found {
+			return nil, nil
+		}
+		ret.URL = url
+	}
+
+	//As far as the network goes, CredHub is wherever the director is. Its
+	// certificate is checked against the system's CAs and the director's CA
+	// cert, unless the director's isn't being checked either
+	if client, isClient := c.(*director.Client); isClient {
+		ret.CACert, ret.AllProxy = client.CACert, client.AllProxy
+		ret.SkipTLSValidation = client.SkipSSLValidation
+	}
+	if caCert := os.Getenv("CREDHUB_CA_CERT"); caCert != "" {
+		var err error
+		ret.CACert, err = director.LoadCACert(caCert)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+//fetchCredHubNames returns the names of the credentials under path in the
+// director's CredHub, or none if it hasn't got one
+func fetchCredHubNames(c director.Director, ctx compContext, path string) ([]string, error) {
+	credhub, err := getCredHub(c, ctx)
+	if err != nil || credhub == nil {
+		return nil, err
+	}
+
+	return credhub.Names(ctx.Context, path)
+}
+
+//fetchDeploymentCredHubNames returns the names of the credentials that CredHub
+// keeps for the deployment, under /<director>/<deployment>/
+func fetchDeploymentCredHubNames(c director.Director, ctx compContext) ([]string, error) {
+	deployment, err := ctxDeployment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := c.Info(ctx.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchCredHubNames(c, ctx, "/"+info.Name+"/"+deployment+"/")
+}
+
+//compCredHubNames offers the full names of credentials in CredHub, as
+// manifests and ops files use them to get at a credential that isn't the
+// deployment's own, e.g. -v /bosh-lite/cf/uaa_admin_secret=... They're offered
+// a segment of the name at a time
+func compCredHubNames(ctx compContext) ([]candidate, error) {
+	dontAddSpace = true
+	dir := ctx.CurrentToken[:strings.LastIndex(ctx.CurrentToken, "/")+1]
+
+	return cachedCandidates(ctx, "credhub-names:"+dir, func(client director.Director) ([]candidate, error) {
+		names, err := fetchCredHubNames(client, ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		seen := map[string]bool{}
+		ret := []candidate{}
+		for _, name := range names {
+			if !strings.HasPrefix(name, dir) {
+				continue
+			}
+
+			c := candidate{Value: name + "=", Display: name[len(dir):]}
+			if i := strings.Index(name[len(dir):], "/"); i >= 0 {
+				c = candidate{Value: name[:len(dir)+i+1], Display: name[len(dir) : len(dir)+i+1]}
+			}
+			if !seen[c.Value] {
+				seen[c.Value] = true
+				ret = append(ret, c)
+			}
+		}
+
+		return ret, nil
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+func TestGetCredHubChecksCertificates(t *testing.T) {
+	directorCA := testCACert(t, "director")
+	credhubCA := testCACert(t, "credhub")
+
+	tests := []struct {
+		name string
+		//What the director client has
+		caCert string
+		skip   bool
+		//$CREDHUB_CA_CERT
+		credhubCACert string
+		wantCACert    string
+		wantSkip      bool
+	}{
+		{name: "without any CA cert"},
+		{name: "with the director's CA cert", caCert: directorCA, wantCACert: directorCA},
+		{name: "with $CREDHUB_CA_CERT", caCert: directorCA, credhubCACert: credhubCA, wantCACert: credhubCA},
+		{name: "when the director isn't checked", skip: true, wantSkip: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			isolate(t)
+			t.Setenv("CREDHUB_SERVER", "https://10.0.0.1:8844")
+			t.Setenv("CREDHUB_CA_CERT", test.credhubCACert)
+
+			c := director.NewClient("https://10.0.0.1:25555", director.Options{})
+			c.CACert, c.SkipSSLValidation = test.caCert, test.skip
+
+			credhub, err := getCredHub(c, compContext{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if credhub.SkipTLSValidation != test.wantSkip {
+				t.Errorf("Expected skipping to be %t", test.wantSkip)
+			}
+			if credhub.CACert != test.wantCACert {
+				t.Errorf("Expected a different CA cert")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import "strings"
+
+//The director API paths worth curling, with placeholders in angle brackets for
+// the parts that pathPlaceholders can fill in
+var directorPaths = []string{
+	"/info",
+	"/cloud_configs",
+	"/configs",
+	"/cpi_configs",
+	"/current_task",
+	"/deployments",
+	"/deployments/<deployment>",
+	"/deployments/<deployment>/errands",
+	"/deployments/<deployment>/instances",
+	"/deployments/<deployment>/problems",
+	"/deployments/<deployment>/snapshots",
+	"/deployments/<deployment>/variables",
+	"/deployments/<deployment>/vms",
+	"/director/certificate_expiry",
+	"/disks",
+	"/events",
+	"/link_consumers",
+	"/link_providers",
+	"/links",
+	"/locks",
+	"/networks",
+	"/orphaned_vms",
+	"/releases",
+	"/releases/<release>",
+	"/runtime_configs",
+	"/stemcells",
+	"/tasks",
+	"/tasks/<task>",
+	"/tasks/<task>/output",
+}
+
+var pathPlaceholders = map[string]compFunc{
+	"<deployment>": compDeployments,
+	"<release>":    compReleaseNames,
+	"<task>":       compTasks,
+}
+
+//compDirectorPaths offers director API paths a segment at a time, filling in
+// the names of deployments and the like from what the director has
+func compDirectorPaths(ctx compContext) ([]candidate, error) {
+	dontAddSpace = true
+	if !strings.HasPrefix(ctx.CurrentToken, "/") {
+		return []candidate{{Value: "/"}}, nil
+	}
+
+	typed := strings.Split(ctx.CurrentToken[1:], "/")
+	done := typed[:len(typed)-1]
+	prefix := "/" + strings.Join(done, "/")
+	if len(done) > 0 {
+		prefix += "/"
+	}
+
+	seen := map[string]bool{}
+	ret := []candidate{}
+	add := func(c candidate) {
+		if !seen[c.Value] {
+			seen[c.Value] = true
+			ret = append(ret, c)
+		}
+	}
+
+	//Segments that only lead to longer paths get a slash on the end
+	deeper := []string{}
+	filled := map[string][]candidate{}
+	for _, template := range directorPaths {
+		segments := strings.Split(template[1:], "/")
+		if len(segments) <= len(done) || !pathMatches(segments[:len(done)], done) {
+			continue
+		}
+
+		next := segments[len(done)]
+		fn, isPlaceholder := pathPlaceholders[next]
+		if !isPlaceholder {
+			if len(segments) == len(done)+1 {
+				add(candidate{Value: prefix + next})
+			} else {
+				deeper = append(deeper, prefix+next)
+			}
+			continue
+		}
+
+		fills, found := filled[next]
+		if !found {
+			var err error
+			fills, err = fn(ctx)
+			if err != nil {
+				log.Write("Could not fill in %s: %s", next, err)
+			}
+			filled[next] = fills
+		}
+		for _, fill := range fills {
+			add(describe(prefix+fill.Value, fill.Description))
+		}
+	}
+
+	for _, path := range deeper {
+		if !seen[path] {
+			add(candidate{Value: path + "/"})
+		}
+	}
+
+	return ret, nil
+}
+
+//pathMatches returns whether the segments of a path template match those
+// typed, with placeholders matching anything
+func pathMatches(template, typed []string) bool {
+	for i := range template {
+		if _, isPlaceholder := pathPlaceholders[template[i]]; !isPlaceholder && template[i] != typed[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//How long the thin client waits to get through to the daemon before doing the
+// completion itself
+const daemonDialTimeout = 50 * time.Millisecond
+
+//How often the daemon refetches what it has cached, so that it's fresh when
+// it's next asked for
+const daemonRefreshInterval = director.DefaultTTL / 2
+
+//Completion uses globals, the environment, and the working directory freely,
+// so the daemon does one completion at a time
+var daemonLock sync.Mutex
+
+type daemonRequest struct {
+	Args []string          `json:"args"`
+	Env  map[string]string `json:"env"`
+	//The caller's working directory, which relative paths on the command line
+	// are relative to
+	Dir    string `json:"dir"`
+	Shell  string `json:"shell"`
+	Filter string `json:"filter"`
+}
+
+type daemonResponse struct {
+	Output string `json:"output"`
+	//Set if the daemon couldn't do the completion, in which case the caller
+	// should do it itself
+	Error string `json:"error,omitempty"`
+}
+
+func daemonSocketPath() string {
+	return fmt.Sprintf("%s/daemon.sock", cacheDir())
+}
+
+//daemonEnvvar returns whether the given environment variable is one that the
+// daemon needs to know about to do a completion the way the caller would. As
+// well as the BOSH_* and COMP_* variables, that's what ~ and the XDG
+// directories resolve against, and where the bosh CLI and plugins are found
+func daemonEnvvar(name string) bool {
+	switch name {
+	case "HOME", "PATH":
+		return true
+	}
+	return strings.HasPrefix(name, "BOSH_") || strings.HasPrefix(name, "COMP_") || strings.HasPrefix(name, "XDG_")
+}
+
+//completeViaDaemon asks a running daemon to do the completion. If there's no
+// daemon (or it isn't answering), it returns false, and the caller should do
+// the completion itself
+func completeViaDaemon(boshArgs []string) (string, bool) {
+	conn, err := net.DialTimeout("unix", daemonSocketPath(), daemonDialTimeout)
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = conn.Close() }()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Write("Could not get working directory for the daemon: %s", err)
+		return "", false
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(completionTimeout()))
+
+	req := daemonRequest{
+		Args:   boshArgs,
+		Env:    map[string]string{},
+		Dir:    dir,
+		Shell:  opts.Shell,
+		Filter: opts.Filter,
+	}
+	for _, kv := range os.Environ() {
+		spl := strings.SplitN(kv, "=", 2)
+		if len(spl) == 2 && daemonEnvvar(spl[0]) {
+			req.Env[spl[0]] = spl[1]
+		}
+	}
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		log.Write("Could not send completion to daemon: %s", err)
+		return "", false
+	}
+
+	resp := daemonResponse{}
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err != nil {
+		log.Write("Could not get completion from daemon: %s", err)
+		return "", false
+	}
+	if resp.Error != "" {
+		log.Write("Daemon could not do the completion: %s", resp.Error)
+		return "", false
+	}
+
+	log.Write("Completion answered by daemon")
+	return resp.Output, true
+}
+
+//doDaemon serves completions over a unix socket, keeping clients, and all that
+// they've cached, warm between them
+func doDaemon() {
+	listener, err := listenDaemon()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	defer func() { _ = listener.Close() }()
+
+	daemonMode = true
+	go refreshDaemonClients()
+
+	err = serveDaemon(listener)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not accept connection: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+//listenDaemon makes the daemon's socket, which only the user can connect to
+func listenDaemon() (net.Listener, error) {
+	err := ensureDir(cacheDir())
+	if err != nil {
+		return nil, fmt.Errorf("Could not make cache dir: %s", err)
+	}
+
+	socketPath := daemonSocketPath()
+	//Anything already there is left over from a daemon that didn't get to clean
+	// up after itself, unless it's still answering
+	if conn, err := net.DialTimeout("unix", socketPath, daemonDialTimeout); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("A daemon is already listening on `%s'", socketPath)
+	}
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not listen on `%s': %s", socketPath, err)
+	}
+
+	err = os.Chmod(socketPath, 0600)
+	if err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("Could not set permissions on `%s': %s", socketPath, err)
+	}
+
+	log.Write("Daemon listening on %s", socketPath)
+	return listener, nil
+}
+
+//serveDaemon answers completions on listener until it's closed
+func serveDaemon(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go serveDaemonConn(conn)
+	}
+}
+
+func serveDaemonConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(completionTimeout()))
+
+	req := daemonRequest{}
+	err := json.NewDecoder(conn).Decode(&req)
+	if err != nil {
+		log.Write("Could not read completion request: %s", err)
+		return
+	}
+
+	resp := completeForCaller(req)
+	err = json.NewEncoder(conn).Encode(resp)
+	if err != nil {
+		log.Write("Could not send completion response: %s", err)
+	}
+}
+
+//completeForCaller does the completion in req as the caller would have done
+// it: with their environment, and from their working directory, so that
+// relative paths are relative to where they are rather than to wherever the
+// daemon was started
+func completeForCaller(req daemonRequest) daemonResponse {
+	daemonLock.Lock()
+	defer daemonLock.Unlock()
+
+	daemonDir, err := os.Getwd()
+	if err != nil {
+		return daemonResponse{Error: fmt.Sprintf("Could not get the daemon's working directory: %s", err)}
+	}
+	if req.Dir == "" {
+		//From a thin client that's older than the daemon, which has no way to
+		// say where it is
+		return daemonResponse{Error: "No working directory given"}
+	}
+	err = os.Chdir(req.Dir)
+	if err != nil {
+		return daemonResponse{Error: fmt.Sprintf("Could not change to `%s': %s", req.Dir, err)}
+	}
+	defer func() {
+		if err := os.Chdir(daemonDir); err != nil {
+			log.Error("Could not change back to `%s': %s", daemonDir, err)
+		}
+	}()
+
+	applyDaemonEnv(req.Env)
+	opts.Shell, opts.Filter = req.Shell, req.Filter
+	resetCompletionState()
+	return daemonResponse{Output: runCompletion(req.Args)}
+}
+
+//applyDaemonEnv makes the daemon's environment look like the caller's, as far
+// as completion is concerned
+func applyDaemonEnv(env map[string]string) {
+	for _, kv := range os.Environ() {
+		name := strings.SplitN(kv, "=", 2)[0]
+		if _, given := env[name]; daemonEnvvar(name) && !given {
+			_ = os.Unsetenv(name)
+		}
+	}
+
+	for name, val := range env {
+		if daemonEnvvar(name) {
+			_ = os.Setenv(name, val)
+		}
+	}
+}
+
+//refreshDaemonClients periodically refetches whatever the daemon's clients
+// have cached that is going stale, so that completions don't have to wait on
+// the director
+func refreshDaemonClients() {
+	for range time.Tick(daemonRefreshInterval) {
+		for _, c := range boshClients.all() {
+			ctx, cancel := context.WithTimeout(context.Background(), completionTimeout())
+			c.Refresh(ctx, daemonRefreshInterval)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//startDaemon serves completions from this process until the test is done
+func startDaemon(t *testing.T) {
+	t.Helper()
+	listener, err := listenDaemon()
+	if err != nil {
+		t.Fatalf("Could not start daemon: %s", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() { _ = serveDaemon(listener) }()
+}
+
+//chdir changes to dir until the test is done
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	prev, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Could not get working directory: %s", err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatalf("Could not change to `%s': %s", dir, err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(prev) })
+}
+
+//manifestProject makes a directory with a manifest and an ops file in a
+// subdirectory of it
+func manifestProject(t *testing.T) string {
+	t.Helper()
+	project := t.TempDir()
+	err := os.Mkdir(project+"/manifests", 0700)
+	if err != nil {
+		t.Fatalf("Could not make manifests dir: %s", err)
+	}
+	writeFile(t, project, "manifests/cf.yml", "name: cf\nreleases: []\n")
+	writeFile(t, project, "manifests/scale.yml", "- type: replace\n  path: /instance_groups/0/instances\n  value: 3\n")
+	return project
+}
+
+func TestDaemonCompletesRelativePathsFromCallersDir(t *testing.T) {
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home)
+	project := manifestProject(t)
+	startDaemon(t)
+
+	//The daemon (which is this process) is somewhere else entirely
+	elsewhere := t.TempDir()
+	chdir(t, elsewhere)
+
+	req := daemonRequest{
+		Args:  []string{"bosh", "deploy", "manifests/"},
+		Env:   map[string]string{},
+		Dir:   project,
+		Shell: "bash",
+	}
+	for _, kv := range os.Environ() {
+		spl := strings.SplitN(kv, "=", 2)
+		if daemonEnvvar(spl[0]) {
+			req.Env[spl[0]] = spl[1]
+		}
+	}
+
+	conn, err := net.DialTimeout("unix", daemonSocketPath(), time.Second)
+	if err != nil {
+		t.Fatalf("Could not connect to daemon: %s", err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	err = json.NewEncoder(conn).Encode(req)
+	if err != nil {
+		t.Fatalf("Could not send request: %s", err)
+	}
+	resp := daemonResponse{}
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err != nil {
+		t.Fatalf("Could not read response: %s", err)
+	}
+
+	if resp.Error != "" {
+		t.Fatalf("Daemon said: %s", resp.Error)
+	}
+	if !strings.Contains(resp.Output, "manifests/cf.yml") {
+		t.Errorf("Expected manifests/cf.yml from `%s', got %q", project, resp.Output)
+	}
+	if strings.Contains(resp.Output, "scale.yml") {
+		t.Errorf("Expected the ops file to be left out, got %q", resp.Output)
+	}
+
+	if dir, _ := os.Getwd(); dir != elsewhere {
+		t.Errorf("Daemon left the working directory at `%s', not `%s'", dir, elsewhere)
+	}
+}
+
+func TestCompleteViaDaemonSendsWorkingDir(t *testing.T) {
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home)
+	project := manifestProject(t)
+	startDaemon(t)
+	chdir(t, project+"/manifests")
+
+	opts.Shell = "bash"
+	defer func() { opts.Shell = "" }()
+
+	output, ok := completeViaDaemon([]string{"bosh", "deploy", "c"})
+	if !ok {
+		t.Fatalf("Daemon didn't answer")
+	}
+	if !strings.Contains(output, "cf.yml") {
+		t.Errorf("Expected cf.yml, got %q", output)
+	}
+}
+
+func TestDaemonRefusesRequestsWithoutDir(t *testing.T) {
+	isolate(t)
+
+	resp := completeForCaller(daemonRequest{Args: []string{"bosh", "deploy", ""}})
+	if resp.Error == "" {
+		t.Errorf("Expected an error without a working directory, got output %q", resp.Output)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+//CREATE_NEW_PROCESS_GROUP, which syscall doesn't give a name to
+const createNewProcessGroup = 0x00000200
+
+//detach makes cmd run in its own process group, so that it isn't taken down
+// with the console that started it
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: createNewProcessGroup}
+}
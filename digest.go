@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	fp "path/filepath"
+)
+
+//Tarballs bigger than this aren't hashed to complete their digests, as
+// reading through gigabytes of stemcell takes longer than anybody wants to
+// wait on Tab
+const defaultMaxDigestSize = 256 << 20
+
+//maxDigestSize is the biggest tarball that gets hashed, which can be set with
+// $BOSH_COMPLETE_MAX_DIGEST_SIZE (e.g. 1G)
+func maxDigestSize() int64 {
+	val := os.Getenv("BOSH_COMPLETE_MAX_DIGEST_SIZE")
+	if val == "" {
+		return defaultMaxDigestSize
+	}
+
+	ret, err := parseSize(val)
+	if err != nil || ret <= 0 {
+		log.Write("Ignoring invalid max digest size: `%s'", val)
+		return defaultMaxDigestSize
+	}
+	return ret
+}
+
+//tarballDigest is what a tarball hashed to, along with what the file looked
+// like at the time, so that it's hashed again if it's been replaced
+type tarballDigest struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+	SHA1    string `json:"sha1"`
+	SHA256  string `json:"sha256"`
+}
+
+func (d tarballDigest) matches(info os.FileInfo) bool {
+	return d.Size == info.Size() && d.ModTime == info.ModTime().UnixNano()
+}
+
+func digestCachePath() string {
+	return fmt.Sprintf("%s/digests.json", cacheDir())
+}
+
+//loadDigests returns the digests worked out before, by absolute path
+func loadDigests() map[string]tarballDigest {
+	ret := map[string]tarballDigest{}
+	contents, err := ioutil.ReadFile(digestCachePath())
+	if err == nil {
+		err = json.Unmarshal(contents, &ret)
+		if err != nil {
+			log.Write("Ignoring unreadable digest cache: %s", err)
+			ret = map[string]tarballDigest{}
+		}
+	}
+	return ret
+}
+
+//saveDigest adds a digest to those kept on disk, throwing out any for files
+// that have since gone away or changed
+func saveDigest(location string, digest tarballDigest) {
+	digests := loadDigests()
+	for other, d := range digests {
+		if info, err := os.Stat(other); err != nil || !d.matches(info) {
+			delete(digests, other)
+		}
+	}
+	digests[location] = digest
+
+	contents, err := json.Marshal(digests)
+	if err != nil {
+		return
+	}
+
+	err = ensureDir(cacheDir())
+	if err == nil {
+		err = writeFileAtomic(digestCachePath(), contents)
+	}
+	if err != nil {
+		log.Write("Could not save digest cache: %s", err)
+	}
+}
+
+//ctxReader stops reading once ctx is done, so that hashing a big file can be
+// given up on partway through
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+//tarballDigests returns the SHA1 and SHA256 of the file at location. They're
+// kept on disk, so a file is only read through again if it has changed.
+// Files bigger than maxDigestSize aren't hashed at all
+func tarballDigests(ctx context.Context, location string) (tarballDigest, error) {
+	if !fp.IsAbs(location) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return tarballDigest{}, err
+		}
+		location = fp.Join(wd, location)
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return tarballDigest{}, err
+	}
+	if info.IsDir() {
+		return tarballDigest{}, fmt.Errorf("`%s' is a directory", location)
+	}
+
+	if cached, found := loadDigests()[location]; found && cached.matches(info) {
+		log.Write("digest cache hit: %s", location)
+		return cached, nil
+	}
+
+	if max := maxDigestSize(); info.Size() > max {
+		return tarballDigest{}, fmt.Errorf("`%s' is bigger than %d bytes (see BOSH_COMPLETE_MAX_DIGEST_SIZE)", location, max)
+	}
+
+	file, err := os.Open(location)
+	if err != nil {
+		return tarballDigest{}, err
+	}
+	defer func() { _ = file.Close() }()
+
+	//Both digests are worked out as the file is read, rather than reading it
+	// twice
+	sha1Hash, sha256Hash := sha1.New(), sha256.New()
+	_, err = io.Copy(io.MultiWriter(sha1Hash, sha256Hash), ctxReader{ctx: ctx, r: file})
+	if err != nil {
+		return tarballDigest{}, err
+	}
+
+	ret := tarballDigest{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		SHA1:    fmt.Sprintf("%x", sha1Hash.Sum(nil)),
+		SHA256:  fmt.Sprintf("%x", sha256Hash.Sum(nil)),
+	}
+	saveDigest(location, ret)
+	return ret, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	//The digests of "hello\n"
+	helloSHA1   = "f572d396fae9206628714fb2ce00f72e94f2258f"
+	helloSHA256 = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+)
+
+func TestTarballDigests(t *testing.T) {
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home+"/cache")
+	tarball := writeFile(t, home, "release.tgz", "hello\n")
+
+	digest, err := tarballDigests(context.Background(), tarball)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if digest.SHA1 != helloSHA1 || digest.SHA256 != helloSHA256 {
+		t.Errorf("Got %s and %s", digest.SHA1, digest.SHA256)
+	}
+
+	t.Run("unchanged files come from the cache", func(t *testing.T) {
+		digests := loadDigests()
+		cached := digests[tarball]
+		cached.SHA1 = "from-the-cache"
+		saveDigest(tarball, cached)
+
+		digest, err := tarballDigests(context.Background(), tarball)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if digest.SHA1 != "from-the-cache" {
+			t.Errorf("Expected the cached digest, got %s", digest.SHA1)
+		}
+	})
+
+	t.Run("changed files are hashed again", func(t *testing.T) {
+		later := time.Now().Add(time.Minute)
+		err := os.Chtimes(tarball, later, later)
+		if err != nil {
+			t.Fatalf("Could not touch %s: %s", tarball, err)
+		}
+
+		digest, err := tarballDigests(context.Background(), tarball)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if digest.SHA1 != helloSHA1 {
+			t.Errorf("Expected %s, got %s", helloSHA1, digest.SHA1)
+		}
+	})
+
+	t.Run("relative paths are cached by where they are", func(t *testing.T) {
+		chdir(t, home)
+		digest, err := tarballDigests(context.Background(), "release.tgz")
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		//Which may not be home as it was given, if it's behind a symlink
+		wd, _ := os.Getwd()
+		if _, found := loadDigests()[wd+"/release.tgz"]; !found || digest.SHA1 != helloSHA1 {
+			t.Errorf("Expected `%s/release.tgz' to be cached as %s", wd, helloSHA1)
+		}
+	})
+
+	t.Run("deleted files are dropped from the cache", func(t *testing.T) {
+		other := writeFile(t, home, "other.tgz", "other\n")
+		_, err := tarballDigests(context.Background(), other)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		_ = os.Remove(other)
+
+		saveDigest(tarball, loadDigests()[tarball])
+		if _, found := loadDigests()[other]; found {
+			t.Errorf("Expected `%s' to be dropped from the cache", other)
+		}
+	})
+}
+
+func TestTarballDigestsTooBig(t *testing.T) {
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home+"/cache")
+	t.Setenv("BOSH_COMPLETE_MAX_DIGEST_SIZE", "4")
+	tarball := writeFile(t, home, "stemcell.tgz", "hello\n")
+
+	if _, err := tarballDigests(context.Background(), tarball); err == nil {
+		t.Errorf("Expected a tarball over the limit not to be hashed")
+	}
+}
+
+func TestTarballDigestsCancelled(t *testing.T) {
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home+"/cache")
+	tarball := writeFile(t, home, "stemcell.tgz", "hello\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tarballDigests(ctx, tarball); err != context.Canceled {
+		t.Errorf("Expected hashing to be cancelled, got %v", err)
+	}
+	if _, found := loadDigests()[tarball]; found {
+		t.Errorf("Expected nothing to be cached for a cancelled hash")
+	}
+}
+
+func TestCompTarballSHAs(t *testing.T) {
+	home := isolate(t)
+	t.Setenv("BOSH_COMPLETE_CACHE_DIR", home+"/cache")
+	tarball := writeFile(t, home, "release.tgz", "hello\n")
+
+	got, err := compTarballSHAs(compContext{Context: context.Background(), Args: []string{tarball}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(got) != 2 || got[0].Value != helloSHA1 || got[1].Value != "sha256:"+helloSHA256 {
+		t.Errorf("Got %+v", got)
+	}
+
+	got, _ = compTarballSHAs(compContext{Context: context.Background(), Args: []string{home + "/missing.tgz"}})
+	if len(got) != 0 {
+		t.Errorf("Expected nothing for a missing tarball, got %+v", got)
+	}
+}
@@ -0,0 +1,334 @@
+package director
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+//The paths here are what responses are cached under, so the same thing asked
+// for two ways should come out as the same path
+
+//WithQuery puts the given query parameters on the end of a director path.
+// Parameters are encoded in a stable order, so the result works as a cache key
+func WithQuery(path string, params url.Values) string {
+	if len(params) == 0 {
+		return path
+	}
+	return path + "?" + params.Encode()
+}
+
+type Deployment struct {
+	Name  string   `json:"name"`
+	Teams []string `json:"teams"`
+}
+
+const DeploymentsPath = "/deployments"
+
+func (c *Client) Deployments(ctx context.Context) ([]Deployment, error) {
+	ret := []Deployment{}
+	err := c.Get(ctx, DeploymentsPath, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Instance struct {
+	AgentID   string `json:"agent_id"`
+	CID       string `json:"cid"`
+	Job       string `json:"job"`
+	Index     int    `json:"index"`
+	ID        string `json:"id"`
+	ExpectsVM bool   `json:"expects_vm"`
+}
+
+func InstancesPath(deployment string) string {
+	return fmt.Sprintf("/deployments/%s/instances", deployment)
+}
+
+func (c *Client) Instances(ctx context.Context, deployment string) ([]Instance, error) {
+	ret := []Instance{}
+	err := c.Get(ctx, InstancesPath(deployment), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//InstanceDetails is what the full instance details have to say beyond the
+// plain instances. Getting them means the director running a task, so the
+// plain instances are better wherever they'll do
+type InstanceDetails struct {
+	Job       string   `json:"job_name"`
+	ID        string   `json:"id"`
+	Index     int      `json:"index"`
+	Ignore    bool     `json:"ignore"`
+	DiskCIDs  []string `json:"disk_cids"`
+	Processes []struct {
+		Name string `json:"name"`
+	} `json:"processes"`
+}
+
+func InstanceDetailsPath(deployment string) string {
+	return WithQuery(InstancesPath(deployment), url.Values{"format": {"full"}})
+}
+
+func (c *Client) InstanceDetails(ctx context.Context, deployment string) ([]InstanceDetails, error) {
+	ret := []InstanceDetails{}
+	err := c.Get(ctx, InstanceDetailsPath(deployment), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type OrphanedDisk struct {
+	CID        string `json:"disk_cid"`
+	Deployment string `json:"deployment_name"`
+	Instance   string `json:"instance_name"`
+}
+
+const OrphanedDisksPath = "/disks?orphaned=true"
+
+func (c *Client) OrphanedDisks(ctx context.Context) ([]OrphanedDisk, error) {
+	ret := []OrphanedDisk{}
+	err := c.Get(ctx, OrphanedDisksPath, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//Problem is a problem found by cloud-check, and the ways it can be dealt with
+type Problem struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Resolutions []struct {
+		Name string `json:"name"`
+		Plan string `json:"plan"`
+	} `json:"resolutions"`
+}
+
+func ProblemsPath(deployment string) string {
+	return fmt.Sprintf("/deployments/%s/problems", deployment)
+}
+
+func (c *Client) Problems(ctx context.Context, deployment string) ([]Problem, error) {
+	ret := []Problem{}
+	err := c.Get(ctx, ProblemsPath(deployment), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Snapshot struct {
+	Job       string `json:"job"`
+	Index     int    `json:"index"`
+	CID       string `json:"snapshot_cid"`
+	CreatedAt string `json:"created_at"`
+}
+
+func SnapshotsPath(deployment string) string {
+	return fmt.Sprintf("/deployments/%s/snapshots", deployment)
+}
+
+func (c *Client) Snapshots(ctx context.Context, deployment string) ([]Snapshot, error) {
+	ret := []Snapshot{}
+	err := c.Get(ctx, SnapshotsPath(deployment), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Variable struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func VariablesPath(deployment string) string {
+	return fmt.Sprintf("/deployments/%s/variables", deployment)
+}
+
+func (c *Client) Variables(ctx context.Context, deployment string) ([]Variable, error) {
+	ret := []Variable{}
+	err := c.Get(ctx, VariablesPath(deployment), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Errand struct {
+	Name string `json:"name"`
+}
+
+func ErrandsPath(deployment string) string {
+	return fmt.Sprintf("/deployments/%s/errands", deployment)
+}
+
+//Errands returns the errands that can be run in the deployment. The director
+// counts both lifecycle: errand instance groups and errand jobs colocated on
+// service instances
+func (c *Client) Errands(ctx context.Context, deployment string) ([]Errand, error) {
+	ret := []Errand{}
+	err := c.Get(ctx, ErrandsPath(deployment), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//Config is a config uploaded to the director, like a cloud or runtime config
+type Config struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+//ConfigsPath is the path for the configs of the given type, or of every type
+// if it's empty. Either only the current configs, or every revision of them
+func ConfigsPath(configType string, latest bool) string {
+	params := url.Values{"latest": {fmt.Sprintf("%t", latest)}}
+	if configType != "" {
+		params.Set("type", configType)
+	}
+
+	return WithQuery("/configs", params)
+}
+
+func (c *Client) Configs(ctx context.Context, configType string, latest bool) ([]Config, error) {
+	ret := []Config{}
+	err := c.Get(ctx, ConfigsPath(configType, latest), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+//TaskFilter narrows down which tasks are asked for
+type TaskFilter struct {
+	Deployment string
+	//How many of the most recent to return
+	Limit int
+	//Only tasks in these states, however long ago they were started
+	States []string
+}
+
+func TasksPath(filter TaskFilter) string {
+	params := url.Values{"verbose": {"1"}}
+	if filter.Limit > 0 {
+		params.Set("limit", fmt.Sprintf("%d", filter.Limit))
+	}
+	if filter.Deployment != "" {
+		params.Set("deployment", filter.Deployment)
+	}
+	if len(filter.States) > 0 {
+		params.Set("state", strings.Join(filter.States, ","))
+	}
+
+	return WithQuery("/tasks", params)
+}
+
+func (c *Client) Tasks(ctx context.Context, filter TaskFilter) ([]Task, error) {
+	ret := []Task{}
+	err := c.Get(ctx, TasksPath(filter), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Event struct {
+	ID         string `json:"id"`
+	User       string `json:"user"`
+	Action     string `json:"action"`
+	ObjectType string `json:"object_type"`
+	ObjectName string `json:"object_name"`
+	Task       string `json:"task"`
+	Deployment string `json:"deployment"`
+	Instance   string `json:"instance"`
+}
+
+//EventsPath is the path for the most recent page of events (the director
+// sends at most 200 at a time), or the page before the given event ID if it
+// isn't empty. They're limited to the deployment if one is given
+func EventsPath(deployment, beforeID string) string {
+	params := url.Values{}
+	if beforeID != "" {
+		params.Set("before_id", beforeID)
+	}
+	if deployment != "" {
+		params.Set("deployment", deployment)
+	}
+
+	return WithQuery("/events", params)
+}
+
+func (c *Client) Events(ctx context.Context, deployment, beforeID string) ([]Event, error) {
+	ret := []Event{}
+	err := c.Get(ctx, EventsPath(deployment, beforeID), &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Release struct {
+	Name     string           `json:"name"`
+	Versions []ReleaseVersion `json:"release_versions"`
+}
+
+type ReleaseVersion struct {
+	Version           string `json:"version"`
+	CurrentlyDeployed bool   `json:"currently_deployed"`
+}
+
+const ReleasesPath = "/releases"
+
+func (c *Client) Releases(ctx context.Context) ([]Release, error) {
+	var ret []Release
+	err := c.Get(ctx, ReleasesPath, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+type Stemcell struct {
+	Name            string `json:"name"`
+	OperatingSystem string `json:"operating_system"`
+	Version         string `json:"version"`
+	Deployments     []struct {
+		Name string `json:"name"`
+	} `json:"deployments"`
+}
+
+const StemcellsPath = "/stemcells"
+
+func (c *Client) Stemcells(ctx context.Context) ([]Stemcell, error) {
+	var ret []Stemcell
+	err := c.Get(ctx, StemcellsPath, &ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
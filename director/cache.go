@@ -0,0 +1,320 @@
+package director
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+//Key identifies a cached response. Responses are kept apart by director and
+// by who they were fetched as, so that what one team can see isn't offered to
+// another
+type Key struct {
+	Director string
+	Identity string
+	Path     string
+}
+
+//Entry is a raw response body from the director
+type Entry struct {
+	Body    []byte
+	Fetched time.Time
+	//Validators from the response, so that the director can be asked whether
+	// the body has changed instead of sending all of it again
+	ETag         string
+	LastModified string
+	ttl          time.Duration
+	lastUsed     time.Time
+}
+
+func (e Entry) fresh() bool {
+	return time.Since(e.Fetched) < e.ttl
+}
+
+func (e Entry) servableStale(maxStaleness time.Duration) bool {
+	return time.Since(e.Fetched) < e.ttl+maxStaleness
+}
+
+//Decode unmarshals the cached body into output, if there's anywhere to put it
+func (e Entry) Decode(output interface{}) error {
+	if output == nil {
+		return nil
+	}
+	return json.NewDecoder(bytes.NewReader(e.Body)).Decode(output)
+}
+
+//waitTurn waits for anybody else who's fetching path to finish first. If
+// somebody was, and what they fetched is in the Store and fresh, it's returned
+// so that it needn't be fetched all over again. unlock must be called either
+// way
+func (c *Client) waitTurn(ctx context.Context, path string) (func(), Entry, bool) {
+	key := c.key(path)
+	unlock, waited, err := c.opts.Lock(ctx, key)
+	if err != nil {
+		c.opts.Logger.Write("Not waiting on whoever else is fetching %s: %s", path, err)
+		return func() {}, Entry{}, false
+	}
+	if !waited {
+		return unlock, Entry{}, false
+	}
+
+	entry, found := c.opts.Store.Load(key)
+	entry.ttl = c.opts.TTL(path)
+	if !found || !entry.fresh() {
+		return unlock, Entry{}, false
+	}
+
+	c.opts.Logger.Write("Somebody else fetched %s while we waited", path)
+	entry.lastUsed = time.Now()
+	c.lock.Lock()
+	c.cache[key] = entry
+	c.evict(c.opts.CacheSize())
+	c.lock.Unlock()
+
+	return unlock, entry, true
+}
+
+//AuthPath is the pseudo path that how a director does auth is cached under,
+// apart from the rest of /info. It's the same for everybody, so it's kept
+// without an identity
+const AuthPath = "/info#auth"
+
+//DefaultAuthTTL is how long how a director does auth is trusted for, unless
+// Options.TTL says otherwise. Directors hardly ever change it, and a grant
+// that fails sends the next run back to /info anyway
+const DefaultAuthTTL = 24 * time.Hour
+
+//authDiscovery is what /info says about how to authenticate
+type authDiscovery struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+//discoverAuth returns how the director does auth, and whether that came from
+// the Store rather than the director. Most runs only need /info to find this
+// out, so it's kept for much longer than /info itself
+func (c *Client) discoverAuth(ctx context.Context) (authDiscovery, bool, error) {
+	key := Key{Director: c.URL, Path: AuthPath}
+
+	c.lock.Lock()
+	info := c.info
+	c.lock.Unlock()
+	if info == nil {
+		entry, found := c.opts.Store.Load(key)
+		ret := authDiscovery{}
+		if found && time.Since(entry.Fetched) < c.opts.TTL(AuthPath) && entry.Decode(&ret) == nil && ret.Type != "" {
+			c.opts.Logger.Write("Director does %s auth (found out %s ago)", ret.Type, time.Since(entry.Fetched))
+			return ret, true, nil
+		}
+	}
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return authDiscovery{}, false, err
+	}
+
+	ret := authDiscovery{Type: info.Auth.Type, URL: info.Auth.Options.URL}
+	body, err := json.Marshal(ret)
+	if err == nil {
+		c.opts.Store.Save(key, Entry{Body: body, Fetched: time.Now()})
+	}
+
+	return ret, false, nil
+}
+
+//forgetAuth makes the next run ask /info how the director does auth, rather
+// than going by what it said before
+func (c *Client) forgetAuth() {
+	c.opts.Logger.Write("Forgetting how the director does auth")
+	c.opts.Store.Save(Key{Director: c.URL, Path: AuthPath}, Entry{Body: []byte("{}")})
+}
+
+//Failure is a request that failed, and when
+type Failure struct {
+	Err    string
+	Failed time.Time
+}
+
+//How long a failed request keeps us from trying the same one again
+const failureTTL = 15 * time.Second
+
+func (f Failure) recent() bool {
+	return time.Since(f.Failed) < failureTTL
+}
+
+//Store keeps responses, and the requests that failed, somewhere that outlasts
+// the Client. It's up to the Store to decide how much it keeps, and for how
+// long. Failing to keep something is the Store's to deal with, as the next
+// Client will just have to fetch it again
+type Store interface {
+	Load(key Key) (Entry, bool)
+	Save(key Key, entry Entry)
+	LoadFailure(key Key) (Failure, bool)
+	SaveFailure(key Key, f Failure)
+	ClearFailure(key Key)
+}
+
+type nopStore struct{}
+
+func (nopStore) Load(Key) (Entry, bool)          { return Entry{}, false }
+func (nopStore) Save(Key, Entry)                 {}
+func (nopStore) LoadFailure(Key) (Failure, bool) { return Failure{}, false }
+func (nopStore) SaveFailure(Key, Failure)        {}
+func (nopStore) ClearFailure(Key)                {}
+
+//cached returns the response cached for path, from memory or else from the
+// Store, whether or not it's still fresh
+func (c *Client) cached(path string) (Entry, bool) {
+	key := c.key(path)
+	c.lock.Lock()
+	entry, found := c.cache[key]
+	if found {
+		entry.lastUsed = time.Now()
+		c.cache[key] = entry
+	}
+	c.lock.Unlock()
+	if found {
+		return entry, true
+	}
+
+	entry, found = c.opts.Store.Load(key)
+	if !found {
+		return Entry{}, false
+	}
+	entry.ttl = c.opts.TTL(path)
+
+	c.opts.Logger.Write("disk cache hit: %s (fetched %s ago)", path, time.Since(entry.Fetched))
+	entry.lastUsed = time.Now()
+	c.lock.Lock()
+	c.cache[key] = entry
+	c.evict(c.opts.CacheSize())
+	c.lock.Unlock()
+
+	return entry, true
+}
+
+//store caches the response for path, both in memory and in the Store for the
+// next run to make use of
+func (c *Client) store(path string, entry Entry) {
+	key := c.key(path)
+	entry.ttl = c.opts.TTL(path)
+	entry.lastUsed = time.Now()
+	c.lock.Lock()
+	c.cache[key] = entry
+	c.evict(c.opts.CacheSize())
+	c.lock.Unlock()
+
+	c.opts.Store.Save(key, entry)
+}
+
+//evict throws out the least recently used responses until what's cached in
+// memory fits in limit. The lock must be held
+func (c *Client) evict(limit int64) {
+	var total int64
+	keys := make([]Key, 0, len(c.cache))
+	for key, entry := range c.cache {
+		total += int64(len(entry.Body))
+		keys = append(keys, key)
+	}
+
+	if total <= limit {
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return c.cache[keys[i]].lastUsed.Before(c.cache[keys[j]].lastUsed)
+	})
+
+	for _, key := range keys {
+		if total <= limit {
+			break
+		}
+		c.opts.Logger.Write("Evicting %s from the cache", key.Path)
+		total -= int64(len(c.cache[key].Body))
+		delete(c.cache, key)
+	}
+}
+
+//recentFailure returns the failure from the last attempt at fetching path,
+// if that was recent enough that trying again is likely to fail the same way
+func (c *Client) recentFailure(path string) (*RecentFailureError, bool) {
+	key := c.key(path)
+	c.lock.Lock()
+	f, found := c.failures[key]
+	c.lock.Unlock()
+	if !found {
+		f, found = c.opts.Store.LoadFailure(key)
+	}
+
+	if !found || !f.recent() {
+		return nil, false
+	}
+
+	return &RecentFailureError{Path: path, Err: f.Err, Failed: f.Failed}, true
+}
+
+//recordFailure remembers that fetching path failed with err. Auth failures
+// aren't kept, since the next attempt gets new credentials anyway, and nor is
+// giving up because the user moved on or time ran out, or not having tried
+// because of being offline. The http client wraps those first two in errors
+// of its own
+func (c *Client) recordFailure(path string, err error) {
+	if IsUnauthorized(err) || IsOffline(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	key := c.key(path)
+	f := Failure{Err: err.Error(), Failed: time.Now()}
+	c.lock.Lock()
+	c.failures[key] = f
+	c.lock.Unlock()
+
+	c.opts.Store.SaveFailure(key, f)
+}
+
+func (c *Client) clearFailure(path string) {
+	key := c.key(path)
+	c.lock.Lock()
+	_, found := c.failures[key]
+	delete(c.failures, key)
+	c.lock.Unlock()
+
+	if found {
+		c.opts.Store.ClearFailure(key)
+	}
+}
+
+func (c *Client) key(path string) Key {
+	return Key{Director: c.URL, Identity: c.Identity(), Path: path}
+}
+
+//Identity is who requests to the director are made as, which cached responses
+// are kept apart by. It's worked out on first use, since it shouldn't change
+// as tokens get refreshed
+func (c *Client) Identity() string {
+	c.identityOnce.Do(func() {
+		c.identity = c.authIdentity()
+		c.opts.Logger.Write("caching responses as `%s'", c.identity)
+	})
+	return c.identity
+}
+
+func (c *Client) authIdentity() string {
+	if c.ClientID != "" {
+		return "client:" + c.ClientID
+	}
+	if c.Username != "" {
+		return "user:" + c.Username
+	}
+
+	for _, token := range []string{c.AccessToken, c.RefreshToken} {
+		if identity := tokenIdentity(token); identity != "" {
+			return identity
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,90 @@
+package director
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//readPEM takes PEM the way the bosh CLI accepts it - either inline or the
+// path to a file holding it - and returns the PEM itself
+func readPEM(value, what string) (string, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return value, nil
+	}
+
+	contents, err := ioutil.ReadFile(value)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s file `%s' does not exist", what, value)
+		}
+		return "", fmt.Errorf("Could not read %s file `%s': %s", what, value, err)
+	}
+
+	return string(contents), nil
+}
+
+//LoadCACert reads a CA cert given inline or by path, and checks that there's
+// actually a certificate in it
+func LoadCACert(value string) (string, error) {
+	pem, err := readPEM(value, "CA cert")
+	if err != nil {
+		return "", err
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(pem)) {
+		return "", fmt.Errorf("No valid PEM encoded certificates found in CA cert")
+	}
+
+	return pem, nil
+}
+
+//LoadClientCert reads a client certificate and its private key, each given
+// inline or by path, and checks that they go together
+func LoadClientCert(certValue, keyValue string) (string, string, error) {
+	if certValue == "" || keyValue == "" {
+		return "", "", fmt.Errorf("A client certificate and key must be given together")
+	}
+
+	cert, err := readPEM(certValue, "client certificate")
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := readPEM(keyValue, "client key")
+	if err != nil {
+		return "", "", err
+	}
+
+	_, err = tls.X509KeyPair([]byte(cert), []byte(key))
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid client certificate or key: %s", err)
+	}
+
+	return cert, key, nil
+}
+
+//newTLSConfig validates against the system's CAs, and the given PEM encoded CA
+// cert(s) if any, unless skipValidation says not to validate at all
+func newTLSConfig(caCert string, skipValidation bool) (*tls.Config, error) {
+	ret := &tls.Config{
+		InsecureSkipVerify: skipValidation,
+	}
+
+	if caCert != "" {
+		//Not every platform will hand over its CAs, in which case the CA cert
+		// is all there is to go on
+		ret.RootCAs, _ = x509.SystemCertPool()
+		if ret.RootCAs == nil {
+			ret.RootCAs = x509.NewCertPool()
+		}
+		if !ret.RootCAs.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("Could not parse CA certificate")
+		}
+	}
+
+	return ret, nil
+}
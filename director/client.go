@@ -0,0 +1,916 @@
+//Package director is a client for the BOSH director's API, which handles
+// authenticating (with basic auth or through UAA), caching responses, and
+// waiting out the tasks that some requests turn into
+package director
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Client talks to a single director, as a single user or client. The exported
+// fields are how to reach and authenticate to it, and are set before the
+// first request
+type Client struct {
+	URL                  string
+	DefaultPort          int
+	Username             string
+	Password             string
+	ClientID             string
+	ClientSecret         string
+	AccessToken          string
+	RefreshToken         string
+	Passcode             string
+	CACert               string
+	ClientCertificate    string
+	ClientKey            string
+	SkipSSLValidation    bool
+	UAACACert            string
+	UAASkipSSLValidation bool
+	UAAClientID          string
+	UAAClientSecret      string
+	//The jumpbox to go through, if any, like BOSH_ALL_PROXY
+	AllProxy string
+	//Called with the tokens from a UAA grant made on behalf of a user, so
+	// that they can be kept for next time
+	SaveTokens func(accessToken, refreshToken string) error
+
+	opts         Options
+	isBasic      bool
+	identity     string
+	identityOnce sync.Once
+	cache        map[Key]Entry
+	failures     map[Key]Failure
+	info         *Info
+	//Made on first use, and shared by every request so that connections to
+	// the director get reused
+	httpClient *http.Client
+	//Guards the caches, which may be hit from concurrent fetches
+	lock sync.Mutex
+	//Keeps concurrent fetches from all trying to authenticate at once
+	authLock sync.Mutex
+}
+
+//NewClient makes a client for the director at the given address, which may
+// leave off the scheme (https) and the port (25555)
+func NewClient(address string, opts Options) *Client {
+	return &Client{
+		URL:      address,
+		opts:     opts.withDefaults(),
+		cache:    map[Key]Entry{},
+		failures: map[Key]Failure{},
+	}
+}
+
+//Info is what the director says about itself at /info
+type Info struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Auth    struct {
+		Type    string `json:"type"`
+		Options struct {
+			URL string `json:"url"`
+		} `json:"options"`
+	} `json:"user_authentication"`
+	Features struct {
+		//Where the director keeps its variables, if it's set up to
+		ConfigServer struct {
+			Status bool `json:"status"`
+			Extras struct {
+				URLs []string `json:"urls"`
+			} `json:"extras"`
+		} `json:"config_server"`
+	} `json:"features"`
+}
+
+var schemeRegex = regexp.MustCompile("^(http|https)://")
+
+//The port that the director listens on, unless told otherwise
+const DefaultPort = 25555
+
+//path makes the URL for the given director path, which may have a query
+// string on the end of it
+func (c *Client) path(path string) string {
+	query := ""
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path, query = path[:idx], path[idx+1:]
+	}
+
+	uStr := c.URL
+	if !schemeRegex.MatchString(uStr) {
+		uStr = "https://" + uStr
+	}
+
+	u, err := url.Parse(uStr)
+	if err != nil {
+		ret := c.URL + path
+		if query != "" {
+			ret = ret + "?" + query
+		}
+		return ret
+	}
+
+	port := c.DefaultPort
+	if port == 0 {
+		port = DefaultPort
+	}
+
+	//A director behind a load balancer on 443 doesn't need the port spelled
+	// out, and some proxies in front of those care about the Host header
+	if u.Port() == "" && !(u.Scheme == "https" && port == 443) {
+		u.Host = fmt.Sprintf("%s:%d", u.Host, port)
+	}
+
+	u.Path = path
+	u.RawPath = path
+	u.RawQuery = query
+	return u.String()
+}
+
+func (c *Client) basicAuthHeader() string {
+	//Like the bosh CLI, a client and secret are used as the username and
+	// password for directors that do basic auth
+	username, password := c.Username, c.Password
+	if c.ClientID != "" {
+		username, password = c.ClientID, c.ClientSecret
+	}
+
+	return fmt.Sprintf("Basic %s",
+		base64.StdEncoding.EncodeToString(
+			[]byte(fmt.Sprintf("%s:%s", username, password)),
+		),
+	)
+}
+
+//CurrentAccessToken returns the access token that requests are being sent
+// with, if there is one
+func (c *Client) CurrentAccessToken() string {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+	return c.AccessToken
+}
+
+//IsBasic returns whether the director has turned out to do basic auth. It's
+// only known once something has been authenticated
+func (c *Client) IsBasic() bool {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+	return c.isBasic
+}
+
+func (c *Client) accessTokenHeader() string {
+	return fmt.Sprintf("Bearer %s", c.AccessToken)
+}
+
+//Authenticate makes sure that there's a way to authenticate requests, doing
+// a UAA grant if there's no usable access token. Requests authenticate on
+// their own as needed, so this is only for finding out up front
+func (c *Client) Authenticate(ctx context.Context) error {
+	_, err := c.fetchAuthHeader(ctx)
+	return err
+}
+
+func (c *Client) fetchAuthHeader(ctx context.Context) (string, error) {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+
+	if c.AccessToken != "" {
+		if !tokenExpired(c.AccessToken) || !c.canReauth() {
+			return c.accessTokenHeader(), nil
+		}
+
+		//No sense in sending a request that's just going to get a 401
+		c.opts.Logger.Write("Access token has expired. Getting a new one")
+		c.AccessToken = ""
+	}
+
+	if c.isBasic {
+		return c.basicAuthHeader(), nil
+	}
+
+	if !c.canReauth() {
+		return "", fmt.Errorf("No authorization options. Need to log in")
+	}
+
+	//Check out /info for the type of auth, unless it's known from before
+	auth, cachedAuth, err := c.discoverAuth(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	header := ""
+	switch auth.Type {
+	case "basic":
+		c.isBasic = true
+		header = c.basicAuthHeader()
+	case "uaa":
+		uaac := UAA{
+			URL:               auth.URL,
+			CACert:            c.UAACACert,
+			SkipTLSValidation: c.UAASkipSSLValidation,
+			AllProxy:          c.AllProxy,
+			Offline:           c.opts.Offline(),
+			Logger:            c.opts.Logger,
+		}
+
+		var authResp *Token
+		start := time.Now()
+		if c.ClientID != "" {
+			c.opts.Logger.Write("Performing client credentials grant UAA auth")
+			authResp, err = uaac.ClientCredentials(ctx, c.ClientID, c.ClientSecret)
+		} else if c.RefreshToken != "" {
+			c.opts.Logger.Write("Performing refresh token grant UAA auth")
+			authResp, err = uaac.Refresh(ctx, c.UAAClientID, c.UAAClientSecret, c.RefreshToken)
+		} else if c.Passcode != "" {
+			c.opts.Logger.Write("Performing passcode grant UAA auth")
+			authResp, err = uaac.Passcode(ctx, c.UAAClientID, c.UAAClientSecret, c.Passcode)
+			//Passcodes only work once, whether or not the grant succeeded
+			c.Passcode = ""
+		} else {
+			c.opts.Logger.Write("Performing password grant UAA auth")
+			c.opts.Logger.Write("with username `%s'", c.Username)
+			authResp, err = uaac.Password(ctx, c.UAAClientID, c.UAAClientSecret, c.Username, c.Password)
+		}
+		c.opts.Observer.Authed(time.Since(start))
+
+		//UAA may well have moved since the director last said where it was
+		if err != nil && cachedAuth {
+			c.forgetAuth()
+		}
+
+		if err == nil {
+			c.AccessToken = authResp.AccessToken
+			header = c.accessTokenHeader()
+
+			//Client credentials tokens aren't kept by the bosh CLI either
+			if c.ClientID == "" {
+				if authResp.RefreshToken != "" {
+					c.RefreshToken = authResp.RefreshToken
+				}
+				c.persistTokens()
+			}
+		}
+
+	default:
+		err = fmt.Errorf("Unknown auth type: `%s'", auth.Type)
+	}
+
+	return header, err
+}
+
+func (c *Client) persistTokens() {
+	if c.SaveTokens == nil {
+		return
+	}
+
+	err := c.SaveTokens(c.AccessToken, c.RefreshToken)
+	if err != nil {
+		c.opts.Logger.Write("Could not save tokens: %s", err)
+	}
+}
+
+//Info returns the director's /info, which doesn't require auth. It is only
+// ever fetched once per client
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	c.lock.Lock()
+	info := c.info
+	c.lock.Unlock()
+	if info != nil {
+		return info, nil
+	}
+
+	info = &Info{}
+	var err error
+	offline := c.opts.Offline()
+	if !offline {
+		var req *http.Request
+		req, err = http.NewRequest("GET", c.path("/info"), nil)
+		if err != nil {
+			return nil, err
+		}
+		err = c.Do(ctx, req, "/info", info)
+	}
+
+	//Without the director (or the time to wait on it), the /info fetched last
+	// time is as good as it gets
+	if offline || (err != nil && ctx.Err() != nil) {
+		entry, cached := c.cached("/info")
+		if !cached {
+			if err == nil {
+				err = &OfflineError{Path: "/info"}
+			}
+			return nil, err
+		}
+		info = &Info{}
+		err = entry.Decode(info)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.opts.Logger.Write("Director version: %s", info.Version)
+	if _, ok := parseDirectorVersion(info.Version); !ok {
+		c.opts.Logger.Write("Could not parse director version `%s'", info.Version)
+	}
+
+	c.lock.Lock()
+	c.info = info
+	c.lock.Unlock()
+
+	return info, nil
+}
+
+var directorVersionRegex = regexp.MustCompile(`^\s*(\d+)(?:\.(\d+))?(?:\.(\d+))?`)
+
+//parseDirectorVersion pulls the numeric parts out of a director version
+// string, like "270.2.0 (00000000)"
+func parseDirectorVersion(version string) ([3]int, bool) {
+	ret := [3]int{}
+	matches := directorVersionRegex.FindStringSubmatch(version)
+	if matches == nil {
+		return ret, false
+	}
+
+	for i := range ret {
+		if matches[i+1] != "" {
+			ret[i], _ = strconv.Atoi(matches[i+1])
+		}
+	}
+
+	return ret, true
+}
+
+//VersionAtLeast returns whether the director is at least the given version.
+// If the director's version can't be made sense of, it's assumed to be new
+// enough, since asking an unexpected director is no worse than before
+func (i Info) VersionAtLeast(min string) bool {
+	have, ok := parseDirectorVersion(i.Version)
+	if !ok {
+		return true
+	}
+
+	want, ok := parseDirectorVersion(min)
+	if !ok {
+		panic("Could not parse minimum director version: " + min)
+	}
+
+	for j := range have {
+		if have[j] != want[j] {
+			return have[j] > want[j]
+		}
+	}
+
+	return true
+}
+
+//Get fetches the given path into output, by way of the cache. Responses that
+// have gone stale may be handed out while they're revalidated, and whatever
+// is cached is used in place of a response that there wasn't time to wait for
+func (c *Client) Get(ctx context.Context, path string, output interface{}) error {
+	log := c.opts.Logger
+	entry, cacheHit := c.cached(path)
+	if cacheHit && entry.fresh() {
+		log.Write("http cache hit: %s", path)
+		c.opts.Observer.Hit(path)
+		return entry.Decode(output)
+	}
+
+	//However old it is, what's cached is all there is while offline
+	if c.opts.Offline() {
+		if cacheHit {
+			log.Write("offline cache hit: %s (fetched %s ago)", path, time.Since(entry.Fetched))
+			c.opts.Observer.Hit(path)
+			return entry.Decode(output)
+		}
+		return &OfflineError{Path: path}
+	}
+
+	//Hand out what we have now, and get it up to date for next time
+	if cacheHit && entry.servableStale(c.opts.MaxStaleness) && c.opts.StaleWhileRevalidate() {
+		log.Write("http cache stale hit: %s (fetched %s ago)", path, time.Since(entry.Fetched))
+		c.opts.Revalidate(path)
+		c.opts.Observer.Hit(path)
+		return entry.Decode(output)
+	}
+	log.Write("http cache miss: %s", path)
+
+	//Don't make the user sit through the same failure on every Tab
+	if recentErr, failed := c.recentFailure(path); failed {
+		if cacheHit {
+			log.Write("%s. Using the stale cached response", recentErr)
+			return entry.Decode(output)
+		}
+		return recentErr
+	}
+
+	//Other completions may be after the same thing, and whoever is already
+	// fetching it can fetch it for everybody
+	unlock, fetched, fetchedElsewhere := c.waitTurn(ctx, path)
+	defer unlock()
+	if fetchedElsewhere {
+		c.opts.Observer.Hit(path)
+		return fetched.Decode(output)
+	}
+
+	authHeader, err := c.fetch(ctx, path, output)
+	if IsUnauthorized(err) && c.dropAccessToken(authHeader) {
+		//Most likely, the token that we had (possibly one the bosh CLI left in
+		// its config) has expired
+		log.Write("Access token was rejected. Reauthenticating")
+		_, err = c.fetch(ctx, path, output)
+	}
+
+	if err == nil {
+		c.clearFailure(path)
+		return nil
+	}
+
+	//Running out of time isn't the director's fault. What's cached will have
+	// to do for now, and the background can wait for the rest
+	if ctx.Err() != nil {
+		c.opts.Revalidate(path)
+		if cacheHit {
+			log.Write("Out of time fetching %s. Using the stale cached response", path)
+			c.opts.Observer.Hit(path)
+			return entry.Decode(output)
+		}
+		return err
+	}
+
+	c.recordFailure(path, err)
+
+	//Old candidates are better than none, unless the director says that
+	// they're gone
+	if cacheHit && (IsTooLarge(err) || (c.opts.StaleOnError() && !IsNotFound(err))) {
+		log.Write("%s. Using the stale cached response (fetched %s ago)", err, time.Since(entry.Fetched))
+		c.opts.Observer.Hit(path)
+		return entry.Decode(output)
+	}
+
+	return err
+}
+
+//Refetch fetches path from the director and caches it, whether or not what's
+// cached already is still fresh
+func (c *Client) Refetch(ctx context.Context, path string) error {
+	//Anything fetched while we waited is as fresh as we'd get it
+	unlock, _, fetchedElsewhere := c.waitTurn(ctx, path)
+	defer unlock()
+	if fetchedElsewhere {
+		return nil
+	}
+
+	authHeader, err := c.fetch(ctx, path, nil)
+	if IsUnauthorized(err) && c.dropAccessToken(authHeader) {
+		_, err = c.fetch(ctx, path, nil)
+	}
+	if err != nil {
+		c.recordFailure(path, err)
+		return err
+	}
+
+	c.clearFailure(path)
+	return nil
+}
+
+//Refresh refetches every path cached in memory that will have gone stale
+// within the given time, so that it won't have to be waited on when it's next
+// asked for
+func (c *Client) Refresh(ctx context.Context, within time.Duration) {
+	paths := []string{}
+	c.lock.Lock()
+	for key, entry := range c.cache {
+		if time.Since(entry.Fetched)+within >= entry.ttl {
+			paths = append(paths, key.Path)
+		}
+	}
+	c.lock.Unlock()
+
+	if len(paths) == 0 || c.opts.Offline() {
+		return
+	}
+
+	//Get would hand back the cached response if it's still fresh, so go
+	// around it
+	for _, path := range paths {
+		err := c.Refetch(ctx, path)
+		if err != nil {
+			c.opts.Logger.Write("Could not refresh %s: %s", path, err)
+		}
+	}
+}
+
+//fetch makes an authenticated request for the given path, returning the
+// Authorization header that it used
+func (c *Client) fetch(ctx context.Context, path string, output interface{}) (string, error) {
+	authHeader, err := c.fetchAuthHeader(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", c.path(path), nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", authHeader)
+
+	//If we already have a body for this, even a stale one, it may well still
+	// be good
+	if entry, cached := c.cached(path); cached {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	return authHeader, c.Do(ctx, req, path, output)
+}
+
+//canReauth returns whether there's any way to get a new access token
+func (c *Client) canReauth() bool {
+	return c.Username != "" || c.Password != "" || c.RefreshToken != "" || c.Passcode != "" || c.ClientID != ""
+}
+
+//dropAccessToken throws away the access token that was sent in the given
+// (rejected) Authorization header, so that the next request gets a new one.
+// Returns false if there's no way to get a new token, and so no point in
+// trying again.
+func (c *Client) dropAccessToken(rejectedHeader string) bool {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+
+	if !strings.HasPrefix(rejectedHeader, "Bearer ") {
+		return false
+	}
+
+	if !c.canReauth() {
+		return false
+	}
+
+	//Another request may have already replaced it
+	if c.accessTokenHeader() == rejectedHeader {
+		c.AccessToken = ""
+	}
+
+	return true
+}
+
+//getHTTPClient returns the http client that requests to the director go
+// through, making it the first time around
+func (c *Client) getHTTPClient() (*http.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.httpClient != nil {
+		return c.httpClient, nil
+	}
+
+	tlsConfig, err := newTLSConfig(c.CACert, c.SkipSSLValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	//For directors behind load balancers that want mutual TLS
+	if c.ClientCertificate != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCertificate), []byte(c.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	c.httpClient, err = newHTTPClient(tlsConfig, c.AllProxy, c.opts.Logger)
+	return c.httpClient, err
+}
+
+//Do sends req, which is for path on the director, and decodes the response
+// into output (if it isn't nil), keeping the body in the cache
+func (c *Client) Do(ctx context.Context, req *http.Request, path string, output interface{}) error {
+	start := time.Now()
+	resp, err := c.send(ctx, req, path, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified {
+		c.opts.Observer.Fetched(path, 0, time.Since(start))
+		return c.revalidated(path, output)
+	}
+
+	//Decode as the body comes in, rather than waiting on all of it first, and
+	// keep a copy of it for the cache on the way through
+	buf := &bytes.Buffer{}
+	tee := io.TeeReader(newLimitedReader(resp.Body, path, c.opts.MaxResponseSize()), buf)
+	if output != nil {
+		err = json.NewDecoder(tee).Decode(output)
+		if err != nil {
+			return err
+		}
+	}
+
+	//Whatever the decoder didn't need still belongs in the cache
+	_, err = io.Copy(ioutil.Discard, tee)
+	if err != nil {
+		return err
+	}
+
+	c.opts.Observer.Fetched(path, int64(buf.Len()), time.Since(start))
+
+	c.opts.Logger.Write("Inserting to cache: %s", path)
+	c.store(path, Entry{
+		Body:         buf.Bytes(),
+		Fetched:      time.Now(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+
+	return nil
+}
+
+//revalidated handles the director saying that the body cached for path hasn't
+// changed, by treating it as freshly fetched
+func (c *Client) revalidated(path string, output interface{}) error {
+	c.opts.Logger.Write("Cached body for %s is still good", path)
+	entry, cached := c.cached(path)
+	if !cached {
+		return fmt.Errorf("Director said %s was not modified, but it isn't cached", path)
+	}
+
+	entry.Fetched = time.Now()
+	c.store(path, entry)
+
+	return entry.Decode(output)
+}
+
+//readCloser is a reader that needs more than closing the reader itself to
+// clean up after it
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+//How many redirects to follow before deciding that the director is going in
+// circles
+const maxRedirects = 10
+
+//send makes the request and returns the response, whose body the caller must
+// close. The body is already decompressed. Redirects to a task are waited out,
+// and the task's result is returned in place of the body. A 304 is returned
+// as is, for the caller to deal with
+func (c *Client) send(ctx context.Context, req *http.Request, path string, redirects int) (*http.Response, error) {
+	log := c.opts.Logger
+	if c.opts.Offline() {
+		return nil, &OfflineError{Path: path}
+	}
+
+	client, err := c.getHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.WithContext(ctx)
+	//Big deployments make for multi-megabyte responses, which compress well
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	if log.Tracing() {
+		dump, err := httputil.DumpRequestOut(req, true)
+		if err == nil {
+			log.Write("%s", string(dump))
+		}
+	}
+
+	retries := c.opts.Retries()
+	resp, err := client.Do(req)
+	for retry := 1; retry <= retries && shouldRetry(req, resp, err); retry++ {
+		if err != nil {
+			log.Write("Request to %s failed: %s", path, err)
+		} else {
+			log.Write("Request to %s got status %d", path, resp.StatusCode)
+			_ = resp.Body.Close()
+		}
+
+		wait := retryBackoff(retry)
+		log.Write("Retrying in %s (%d/%d)", wait, retry, retries)
+		err = sleepContext(ctx, wait)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw := resp.Body
+	ret := readCloser{Reader: raw, close: raw.Close}
+
+	//Having set Accept-Encoding ourselves, it's on us to decompress
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(raw)
+		if err != nil {
+			_ = raw.Close()
+			return nil, fmt.Errorf("Could not decompress response from %s: %s", path, err)
+		}
+
+		ret = readCloser{Reader: gz, close: func() error {
+			_ = gz.Close()
+			return raw.Close()
+		}}
+		resp.Body = ret
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+	}
+
+	//Dumping the body means reading all of it, so only do it if it's going
+	// to be seen
+	if log.Tracing() {
+		dump, err := httputil.DumpResponse(resp, true)
+		if err == nil {
+			log.Write("%s", string(dump))
+		}
+		ret.Reader = resp.Body
+	}
+
+	resp.Body = ret
+	if resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	if resp.StatusCode >= 300 {
+		defer func() { _ = ret.Close() }()
+	}
+
+	if isRedirect(resp.StatusCode) {
+		if redirects >= maxRedirects {
+			return nil, fmt.Errorf("Too many redirects fetching %s", path)
+		}
+
+		return c.followRedirect(ctx, req, resp, path, redirects+1)
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, newDirectorError(path, resp)
+	}
+
+	return resp, nil
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+//followRedirect fetches wherever resp points to. The director answers
+// requests that it has to do some work for with a redirect to the task doing
+// it, in which case the task is waited on
+func (c *Client) followRedirect(ctx context.Context, req *http.Request, resp *http.Response, path string, redirects int) (*http.Response, error) {
+	location, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("Bad redirect from %s: %s", path, err)
+	}
+
+	//Credentials only go back to the host that they're meant for
+	if location.Host != req.URL.Host {
+		return nil, fmt.Errorf("Not following redirect from %s to another host: %s", path, location.Host)
+	}
+
+	if matches := taskPathRegex.FindStringSubmatch(location.Path); matches != nil {
+		c.opts.Logger.Write("%s redirected to task %s", path, matches[1])
+		return c.waitForTask(ctx, req.Header.Get("Authorization"), matches[1], redirects)
+	}
+
+	c.opts.Logger.Write("%s redirected to %s", path, location.Path)
+	newReq, err := http.NewRequest("GET", location.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	newReq.Header.Set("Authorization", req.Header.Get("Authorization"))
+	for _, header := range []string{"If-None-Match", "If-Modified-Since"} {
+		if val := req.Header.Get(header); val != "" {
+			newReq.Header.Set(header, val)
+		}
+	}
+
+	return c.send(ctx, newReq, location.Path, redirects)
+}
+
+//How many requests GetMany and RefetchMany will have out to the director at
+// once
+const maxConcurrentFetches = 4
+
+//GetMany fetches the given paths concurrently, a few at a time, so that
+// subsequent calls to Get for them are served from the cache. It gives up
+// waiting after timeout. Giving up doesn't cancel the requests - only ctx
+// being done does. The errors from any that failed are returned together.
+func (c *Client) GetMany(ctx context.Context, paths []string, timeout time.Duration) error {
+	type result struct {
+		path string
+		took time.Duration
+		err  error
+	}
+
+	log := c.opts.Logger
+	start := time.Now()
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+
+	done := make(chan result, len(unique))
+	slots := make(chan struct{}, maxConcurrentFetches)
+	for _, path := range unique {
+		go func(path string) {
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			reqStart := time.Now()
+			err := c.Get(ctx, path, nil)
+			done <- result{path: path, took: time.Since(reqStart), err: err}
+		}(path)
+	}
+
+	var serial time.Duration
+	errs := FetchErrors{}
+	deadline := time.After(timeout)
+	for range unique {
+		select {
+		case res := <-done:
+			serial += res.took
+			if res.err != nil {
+				log.Write("prefetch of %s failed: %s", res.path, res.err)
+				errs[res.path] = res.err
+			}
+		case <-deadline:
+			log.Write("gave up prefetching %d endpoints after %s", len(unique), timeout)
+			return fmt.Errorf("Timed out after %s fetching from the director", timeout)
+		case <-ctx.Done():
+			log.Write("gave up prefetching %d endpoints: %s", len(unique), ctx.Err())
+			return ctx.Err()
+		}
+	}
+
+	log.Write("prefetched %d endpoints in %s (%s back to back)", len(unique), time.Since(start), serial)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//RefetchMany refetches the given paths, a few at a time, returning the errors
+// from any that couldn't be
+func (c *Client) RefetchMany(ctx context.Context, paths []string) FetchErrors {
+	errs := FetchErrors{}
+	errsLock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, maxConcurrentFetches)
+	for _, path := range paths {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			err := c.Refetch(ctx, path)
+			if err != nil {
+				errsLock.Lock()
+				errs[path] = err
+				errsLock.Unlock()
+			}
+		}(path)
+	}
+	wg.Wait()
+
+	return errs
+}
@@ -0,0 +1,370 @@
+package director_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+	"github.com/thomasmitchell/bosh-complete/director/directortest"
+)
+
+//fetches is an Observer that keeps how many bytes each fetch of a path got,
+// which is 0 for a 304
+type fetches struct {
+	lock  sync.Mutex
+	bytes map[string][]int64
+}
+
+func (f *fetches) Fetched(path string, bytes int64, _ time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.bytes[path] = append(f.bytes[path], bytes)
+}
+
+func (f *fetches) Hit(string)           {}
+func (f *fetches) Authed(time.Duration) {}
+
+func (f *fetches) of(path string) []int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]int64{}, f.bytes[path]...)
+}
+
+func TestAuthentication(t *testing.T) {
+	user := directortest.Auth{Type: "uaa", Username: "admin", Password: "admin-password"}
+	client := directortest.Auth{Type: "uaa", ClientID: "ci", ClientSecret: "ci-secret"}
+
+	tests := []struct {
+		name string
+		auth directortest.Auth
+		//Sets up the client with whatever it has to authenticate with
+		setup func(c *director.Client, srv *directortest.Server)
+		//How many times UAA should be asked for a token
+		grants int
+		//Whether the tokens should be handed to SaveTokens
+		saved bool
+		fails bool
+		//Whether it fails with a 401 from the director, rather than at UAA
+		unauthorized bool
+	}{
+		{
+			name: "basic auth",
+			auth: directortest.Auth{Username: "admin", Password: "admin-password"},
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.Username, c.Password = "admin", "admin-password"
+			},
+		},
+		{
+			name: "basic auth with a client",
+			auth: directortest.Auth{ClientID: "ci", ClientSecret: "ci-secret"},
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.ClientID, c.ClientSecret = "ci", "ci-secret"
+			},
+		},
+		{
+			name: "basic auth with the wrong password",
+			auth: directortest.Auth{Username: "admin", Password: "admin-password"},
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.Username, c.Password = "admin", "wrong"
+			},
+			fails:        true,
+			unauthorized: true,
+		},
+		{
+			name: "password grant",
+			auth: user,
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.Username, c.Password = "admin", "admin-password"
+			},
+			grants: 1,
+			saved:  true,
+		},
+		{
+			name: "client credentials grant",
+			auth: client,
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.ClientID, c.ClientSecret = "ci", "ci-secret"
+			},
+			grants: 1,
+		},
+		{
+			name: "passcode grant",
+			auth: user,
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.Passcode = "admin-password"
+			},
+			grants: 1,
+			saved:  true,
+		},
+		{
+			name: "access token from before",
+			auth: user,
+			setup: func(c *director.Client, srv *directortest.Server) {
+				c.AccessToken = srv.Token(nil)
+			},
+		},
+		{
+			name: "expired access token",
+			auth: user,
+			setup: func(c *director.Client, srv *directortest.Server) {
+				c.AccessToken = srv.Token(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})
+				c.RefreshToken = srv.Token(nil)
+			},
+			grants: 1,
+			saved:  true,
+		},
+		{
+			name: "access token that the director has forgotten",
+			auth: user,
+			setup: func(c *director.Client, srv *directortest.Server) {
+				c.AccessToken = srv.Token(nil)
+				srv.Reset()
+				c.Username, c.Password = "admin", "admin-password"
+			},
+			grants: 1,
+			saved:  true,
+		},
+		{
+			name: "forgotten access token and no way to get another",
+			auth: user,
+			setup: func(c *director.Client, srv *directortest.Server) {
+				c.AccessToken = srv.Token(nil)
+				srv.Reset()
+			},
+			fails:        true,
+			unauthorized: true,
+		},
+		{
+			name: "password grant with the wrong password",
+			auth: user,
+			setup: func(c *director.Client, _ *directortest.Server) {
+				c.Username, c.Password = "admin", "wrong"
+			},
+			grants: 1,
+			fails:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := directortest.NewServer(test.auth)
+			defer srv.Close()
+
+			c := director.NewClient(srv.URL, director.Options{})
+			c.UAAClientID = "bosh_cli"
+			saved := false
+			c.SaveTokens = func(string, string) error {
+				saved = true
+				return nil
+			}
+			test.setup(c, srv)
+
+			deployments, err := c.Deployments(context.Background())
+			switch {
+			case test.unauthorized && !director.IsUnauthorized(err):
+				t.Errorf("Expected a 401, got %v", err)
+			case test.fails && err == nil:
+				t.Errorf("Expected an error")
+			case !test.fails && err != nil:
+				t.Errorf("Unexpected error: %s", err)
+			case !test.fails && len(deployments) != 2:
+				t.Errorf("Expected the canned deployments, got %+v", deployments)
+			}
+
+			if got := srv.Requests("/oauth/token"); got != test.grants {
+				t.Errorf("Expected %d grants, got %d", test.grants, got)
+			}
+			if saved != test.saved {
+				t.Errorf("Expected tokens saved to be %t, got %t", test.saved, saved)
+			}
+		})
+	}
+}
+
+func TestAuthenticatesOnce(t *testing.T) {
+	srv := directortest.NewServer(directortest.Auth{Type: "uaa", ClientID: "ci", ClientSecret: "ci-secret"})
+	defer srv.Close()
+
+	c := director.NewClient(srv.URL, director.Options{})
+	c.ClientID, c.ClientSecret = "ci", "ci-secret"
+
+	ctx := context.Background()
+	for _, fetch := range []func() error{
+		func() error { _, err := c.Deployments(ctx); return err },
+		func() error { _, err := c.Instances(ctx, "cf"); return err },
+		func() error { _, err := c.Stemcells(ctx); return err },
+	} {
+		if err := fetch(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	if got := srv.Requests("/oauth/token"); got != 1 {
+		t.Errorf("Expected the one grant, got %d", got)
+	}
+	if got := srv.Requests("/info"); got != 1 {
+		t.Errorf("Expected /info once, got %d", got)
+	}
+}
+
+func TestCaching(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		//Changes what the director has between the first fetch and the second
+		change bool
+		//What the observer should see for each fetch that reaches the
+		// director: -1 for a whole body, 0 for a 304
+		want []int64
+		//How many deployments the second fetch should get
+		deployments int
+	}{
+		{name: "fresh responses come from the cache", ttl: time.Hour, want: []int64{-1}, deployments: 2},
+		{name: "stale responses are revalidated", want: []int64{-1, 0}, deployments: 2},
+		{name: "changed responses are fetched again", change: true, want: []int64{-1, -1}, deployments: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := directortest.NewServer(directortest.Auth{Username: "admin", Password: "admin-password"})
+			defer srv.Close()
+
+			observer := &fetches{bytes: map[string][]int64{}}
+			c := director.NewClient(srv.URL, director.Options{
+				Observer: observer,
+				TTL:      func(string) time.Duration { return test.ttl },
+			})
+			c.Username, c.Password = "admin", "admin-password"
+
+			ctx := context.Background()
+			_, err := c.Deployments(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if test.change {
+				srv.Handle(director.DeploymentsPath, []director.Deployment{{Name: "zookeeper"}})
+			}
+			deployments, err := c.Deployments(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if len(deployments) != test.deployments {
+				t.Errorf("Expected %d deployments, got %+v", test.deployments, deployments)
+			}
+			if got := srv.Requests(director.DeploymentsPath); got != len(test.want) {
+				t.Errorf("Expected %d requests, got %d", len(test.want), got)
+			}
+			got := observer.of(director.DeploymentsPath)
+			if len(got) != len(test.want) {
+				t.Fatalf("Expected %d fetches, got %v", len(test.want), got)
+			}
+			for i := range got {
+				if (test.want[i] == 0) != (got[i] == 0) {
+					t.Errorf("Fetch %d got %d bytes, expected %s", i+1, got[i], map[bool]string{true: "a 304", false: "a body"}[test.want[i] == 0])
+				}
+			}
+		})
+	}
+}
+
+func TestTaskResults(t *testing.T) {
+	srv := directortest.NewServer(directortest.Auth{Username: "admin", Password: "admin-password"})
+	defer srv.Close()
+
+	c := director.NewClient(srv.URL, director.Options{})
+	c.Username, c.Password = "admin", "admin-password"
+
+	details, err := c.InstanceDetails(context.Background(), "cf")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(details) != len(directortest.CannedInstanceDetails) {
+		t.Fatalf("Expected %d instances, got %+v", len(directortest.CannedInstanceDetails), details)
+	}
+	for i, instance := range details {
+		if instance.ID != directortest.CannedInstanceDetails[i].ID {
+			t.Errorf("Expected instance %s, got %s", directortest.CannedInstanceDetails[i].ID, instance.ID)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	srv := directortest.NewServer(directortest.Auth{Username: "admin", Password: "admin-password"})
+	defer srv.Close()
+
+	c := director.NewClient(srv.URL, director.Options{})
+	c.Username, c.Password = "admin", "admin-password"
+
+	_, err := c.Instances(context.Background(), "zookeeper")
+	if !director.IsNotFound(err) {
+		t.Errorf("Expected a 404, got %v", err)
+	}
+}
+
+//Running out of time says nothing about the director, so the next request
+// should still go to it
+func TestTimeoutsAreNotFailures(t *testing.T) {
+	srv := directortest.NewServer(directortest.Auth{Username: "admin", Password: "admin-password"})
+	defer srv.Close()
+
+	c := director.NewClient(srv.URL, director.Options{Retries: func() int { return 0 }})
+	c.Username, c.Password = "admin", "admin-password"
+
+	for _, giveUp := range []func() (context.Context, context.CancelFunc){
+		func() (context.Context, context.CancelFunc) {
+			return context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		},
+		func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		},
+	} {
+		ctx, cancel := giveUp()
+		err := c.Refetch(ctx, director.DeploymentsPath)
+		cancel()
+		if err == nil {
+			t.Fatalf("Expected giving up to fail")
+		}
+
+		_, err = c.Deployments(context.Background())
+		if err != nil {
+			t.Errorf("Unexpected error after giving up: %s", err)
+		}
+	}
+}
+
+func TestCertificateValidation(t *testing.T) {
+	srv := directortest.NewTLSServer(directortest.Auth{Username: "admin", Password: "admin-password"})
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		caCert string
+		skip   bool
+		fails  bool
+	}{
+		//It's self-signed, so no system CA will vouch for it
+		{name: "without its CA cert", fails: true},
+		{name: "with its CA cert", caCert: srv.CACert()},
+		{name: "without checking", skip: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := director.NewClient(srv.URL, director.Options{Retries: func() int { return 0 }})
+			c.Username, c.Password = "admin", "admin-password"
+			c.CACert, c.SkipSSLValidation = test.caCert, test.skip
+
+			_, err := c.Deployments(context.Background())
+			if test.fails && err == nil {
+				t.Errorf("Expected a self-signed certificate to be turned away")
+			} else if !test.fails && err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package director
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//CredHub lists the credentials in the CredHub that a director keeps its
+// variables in
+type CredHub struct {
+	URL               string
+	CACert            string
+	SkipTLSValidation bool
+	//The jumpbox to go through, if any
+	AllProxy string
+	//The UAA client to authenticate as. Without one, AccessToken is sent
+	// instead (e.g. the director's own, which CredHub takes if it has the
+	// scopes for it)
+	ClientID     string
+	ClientSecret string
+	AccessToken  string
+	//Fail every request instead of going to the network
+	Offline bool
+	Logger  Logger
+}
+
+//CredHubURL returns where the director's CredHub is, going by its /info, or
+// false if it doesn't use one
+func (i Info) CredHubURL() (string, bool) {
+	server := i.Features.ConfigServer
+	if !server.Status || len(server.Extras.URLs) == 0 {
+		return "", false
+	}
+
+	//The director is told where CredHub's API is, which is under /api
+	return strings.TrimSuffix(strings.TrimRight(server.Extras.URLs[0], "/"), "/api"), true
+}
+
+//Names returns the names of the credentials under path, e.g.
+// /<director>/<deployment>/, however far down they are
+func (c CredHub) Names(ctx context.Context, path string) ([]string, error) {
+	base := strings.TrimRight(c.URL, "/")
+	if c.Offline {
+		return nil, &OfflineError{Path: base + "/api/v1/data"}
+	}
+
+	tlsConfig, err := newTLSConfig(c.CACert, c.SkipTLSValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newHTTPClient(tlsConfig, c.AllProxy, c.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.token(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := struct {
+		Credentials []struct {
+			Name string `json:"name"`
+		} `json:"credentials"`
+	}{}
+	err = c.get(ctx, client, "/api/v1/data?path="+url.QueryEscape(path), token, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(resp.Credentials))
+	for _, credential := range resp.Credentials {
+		ret = append(ret, credential.Name)
+	}
+	return ret, nil
+}
+
+//token returns the access token to send, granting one to the client if
+// there is one. The UAA to ask is whichever CredHub says it trusts
+func (c CredHub) token(ctx context.Context, client *http.Client) (string, error) {
+	if c.ClientID == "" {
+		if c.AccessToken == "" {
+			return "", fmt.Errorf("No credentials to authenticate to CredHub with")
+		}
+		return c.AccessToken, nil
+	}
+
+	info := struct {
+		AuthServer struct {
+			URL string `json:"url"`
+		} `json:"auth-server"`
+	}{}
+	err := c.get(ctx, client, "/info", "", &info)
+	if err != nil {
+		return "", err
+	}
+
+	uaac := UAA{
+		URL:               info.AuthServer.URL,
+		CACert:            c.CACert,
+		SkipTLSValidation: c.SkipTLSValidation,
+		AllProxy:          c.AllProxy,
+		Logger:            c.Logger,
+	}
+	token, err := uaac.ClientCredentials(ctx, c.ClientID, c.ClientSecret)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+func (c CredHub) get(ctx context.Context, client *http.Client, path, token string, output interface{}) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(c.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("CredHub returned status %d for %s", resp.StatusCode, strings.SplitN(path, "?", 2)[0])
+	}
+
+	err = json.NewDecoder(LimitReader(resp.Body, path, defaultMaxResponseSize)).Decode(output)
+	if err != nil {
+		return fmt.Errorf("Could not parse CredHub response for %s: %s", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package director
+
+import (
+	"context"
+	"time"
+)
+
+//Director is what completions need from a director. Client is the real thing,
+// but anything that can answer these will do
+type Director interface {
+	//Address is where the director is, for telling directors apart
+	Address() string
+	//Identity is who the director is being asked as, for keeping what one user
+	// can see away from another
+	Identity() string
+	CurrentAccessToken() string
+	Info(ctx context.Context) (*Info, error)
+	//GetMany gets the given paths ready for the calls that will need them
+	GetMany(ctx context.Context, paths []string, timeout time.Duration) error
+
+	Deployments(ctx context.Context) ([]Deployment, error)
+	Instances(ctx context.Context, deployment string) ([]Instance, error)
+	InstanceDetails(ctx context.Context, deployment string) ([]InstanceDetails, error)
+	OrphanedDisks(ctx context.Context) ([]OrphanedDisk, error)
+	Problems(ctx context.Context, deployment string) ([]Problem, error)
+	Snapshots(ctx context.Context, deployment string) ([]Snapshot, error)
+	Variables(ctx context.Context, deployment string) ([]Variable, error)
+	Errands(ctx context.Context, deployment string) ([]Errand, error)
+	Configs(ctx context.Context, configType string, latest bool) ([]Config, error)
+	Tasks(ctx context.Context, filter TaskFilter) ([]Task, error)
+	Events(ctx context.Context, deployment, beforeID string) ([]Event, error)
+	Releases(ctx context.Context) ([]Release, error)
+	Stemcells(ctx context.Context) ([]Stemcell, error)
+}
+
+var _ Director = (*Client)(nil)
+
+//Address is the director's URL, as the client was given it
+func (c *Client) Address() string {
+	return c.URL
+}
@@ -0,0 +1,176 @@
+package directortest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//authorized returns whether the request has credentials that the director
+// would take
+func (s *Server) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if s.Auth.Type == "basic" {
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		return (username == s.Auth.Username && password == s.Auth.Password) ||
+			(s.Auth.ClientID != "" && username == s.Auth.ClientID && password == s.Auth.ClientSecret)
+	}
+
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+	s.lock.Lock()
+	issued := s.tokens[token]
+	s.lock.Unlock()
+
+	return issued && !expired(token)
+}
+
+//serveToken is a UAA that knows the one user and the one client, and the bosh
+// CLI's own UAA client that grants are made for users through
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 0, err.Error())
+		return
+	}
+
+	clientID, clientSecret, _ := r.BasicAuth()
+	claims := map[string]interface{}{}
+	switch r.PostForm.Get("grant_type") {
+	case "client_credentials":
+		if s.Auth.ClientID == "" || clientID != s.Auth.ClientID || clientSecret != s.Auth.ClientSecret {
+			writeError(w, http.StatusUnauthorized, 0, "Bad client credentials")
+			return
+		}
+		claims["client_id"] = clientID
+		claims["sub"] = clientID
+
+	case "password":
+		if clientID != "bosh_cli" {
+			writeError(w, http.StatusUnauthorized, 0, "Unknown UAA client")
+			return
+		}
+		//Passcodes are taken as the password, as there's no SSO to get one from
+		given := r.PostForm.Get("password")
+		if passcode := r.PostForm.Get("passcode"); passcode != "" {
+			given = passcode
+		} else if r.PostForm.Get("username") != s.Auth.Username {
+			writeError(w, http.StatusUnauthorized, 0, "Bad credentials")
+			return
+		}
+		if given != s.Auth.Password {
+			writeError(w, http.StatusUnauthorized, 0, "Bad credentials")
+			return
+		}
+		claims["user_name"] = s.Auth.Username
+
+	case "refresh_token":
+		s.lock.Lock()
+		issued := s.tokens[r.PostForm.Get("refresh_token")]
+		s.lock.Unlock()
+		if !issued {
+			writeError(w, http.StatusUnauthorized, 0, "Bad refresh token")
+			return
+		}
+		claims["user_name"] = s.Auth.Username
+
+	default:
+		writeError(w, http.StatusBadRequest, 0, "Unsupported grant type")
+		return
+	}
+
+	scopes := s.Auth.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"bosh.admin"}
+	}
+	claims["scope"] = scopes
+	claims["exp"] = time.Now().Add(s.Auth.TokenTTL).Unix()
+
+	accessToken := makeToken(claims)
+	ret := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"expires_in":   int(s.Auth.TokenTTL / time.Second),
+	}
+
+	s.lock.Lock()
+	s.tokens[accessToken] = true
+	//Like the real UAA, clients don't get refresh tokens
+	if _, isUser := claims["user_name"]; isUser {
+		refreshToken := randomString()
+		s.tokens[refreshToken] = true
+		ret["refresh_token"] = refreshToken
+	}
+	s.lock.Unlock()
+
+	body, _ := json.Marshal(ret)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+//makeToken makes a JWT with the given claims. It isn't signed, but nothing
+// that asks the fake director checks
+func makeToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	//A nonce, so that tokens made in the same second don't come out the same
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "." + randomString()
+}
+
+//Token makes a token as this director's UAA would, with the given claims on
+// top of the usual ones, for handing to a client as though it had been kept
+// from an earlier grant
+func (s *Server) Token(claims map[string]interface{}) string {
+	all := map[string]interface{}{
+		"user_name": s.Auth.Username,
+		"scope":     []string{"bosh.admin"},
+		"exp":       time.Now().Add(s.Auth.TokenTTL).Unix(),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	token := makeToken(all)
+	s.lock.Lock()
+	s.tokens[token] = true
+	s.lock.Unlock()
+	return token
+}
+
+func expired(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return true
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return true
+	}
+
+	claims := struct {
+		Exp int64 `json:"exp"`
+	}{}
+	if json.Unmarshal(payload, &claims) != nil {
+		return true
+	}
+
+	return time.Now().Unix() >= claims.Exp
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,66 @@
+package directortest
+
+import (
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//Canned is what a new Server answers with, by path: a director with cf and
+// redis deployed, and a little history. Changing it changes what servers made
+// afterwards start with
+var Canned = map[string]interface{}{
+	director.DeploymentsPath: []director.Deployment{
+		{Name: "cf", Teams: []string{"cf-team"}},
+		{Name: "redis", Teams: []string{"data-team"}},
+	},
+	director.InstancesPath("cf"): []director.Instance{
+		{AgentID: "agent-0", CID: "vm-0", Job: "router", Index: 0, ID: "0a1b2c3d-0000-0000-0000-000000000000", ExpectsVM: true},
+		{AgentID: "agent-1", CID: "vm-1", Job: "router", Index: 1, ID: "1a1b2c3d-0000-0000-0000-000000000000", ExpectsVM: true},
+		{AgentID: "agent-2", CID: "vm-2", Job: "diego-cell", Index: 0, ID: "2a1b2c3d-0000-0000-0000-000000000000", ExpectsVM: true},
+		{Job: "smoke-tests", Index: 0, ID: "3a1b2c3d-0000-0000-0000-000000000000"},
+	},
+	director.InstancesPath("redis"): []director.Instance{
+		{AgentID: "agent-3", CID: "vm-3", Job: "redis", Index: 0, ID: "4a1b2c3d-0000-0000-0000-000000000000", ExpectsVM: true},
+	},
+	director.ErrandsPath("cf"):    []director.Errand{{Name: "smoke-tests"}},
+	director.ErrandsPath("redis"): []director.Errand{},
+	director.VariablesPath("cf"): []director.Variable{
+		{ID: "1", Name: "/fake-director/cf/admin_password"},
+		{ID: "2", Name: "/fake-director/cf/router_tls"},
+	},
+	director.SnapshotsPath("cf"): []director.Snapshot{},
+	director.ProblemsPath("cf"):  []director.Problem{},
+	director.OrphanedDisksPath: []director.OrphanedDisk{
+		{CID: "disk-0", Deployment: "redis", Instance: "redis/4a1b2c3d-0000-0000-0000-000000000000"},
+	},
+	director.ReleasesPath: []director.Release{
+		{Name: "routing", Versions: []director.ReleaseVersion{
+			{Version: "0.280.0", CurrentlyDeployed: true},
+			{Version: "0.279.0"},
+		}},
+	},
+	director.StemcellsPath: []director.Stemcell{
+		{Name: "bosh-warden-boshlite-ubuntu-jammy-go_agent", OperatingSystem: "ubuntu-jammy", Version: "1.200"},
+	},
+	director.ConfigsPath("", true): []director.Config{
+		{ID: "1", Name: "default", Type: "cloud", Content: "azs: [{name: z1}]\nvm_types: [{name: default}]\nnetworks: [{name: default}]\n"},
+		{ID: "2", Name: "dns", Type: "runtime", Content: "addons: []\n"},
+	},
+	director.ConfigsPath("cloud", true): []director.Config{
+		{ID: "1", Name: "default", Type: "cloud", Content: "azs: [{name: z1}]\nvm_types: [{name: default}]\nnetworks: [{name: default}]\n"},
+	},
+	director.TasksPath(director.TaskFilter{Limit: 100}): []director.Task{
+		{ID: 2, State: "processing", Description: "create deployment"},
+		{ID: 1, State: "done", Description: "create deployment"},
+	},
+	director.EventsPath("", ""): []director.Event{
+		{ID: "1", User: "admin", Action: "create", ObjectType: "deployment", ObjectName: "cf", Task: "1", Deployment: "cf"},
+	},
+}
+
+//CannedInstanceDetails is what /deployments/cf/instances?format=full answers
+// with, by way of a task
+var CannedInstanceDetails = []director.InstanceDetails{
+	{Job: "router", ID: "0a1b2c3d-0000-0000-0000-000000000000", Index: 0, DiskCIDs: []string{}},
+	{Job: "router", ID: "1a1b2c3d-0000-0000-0000-000000000000", Index: 1, DiskCIDs: []string{}},
+	{Job: "diego-cell", ID: "2a1b2c3d-0000-0000-0000-000000000000", Index: 0, DiskCIDs: []string{"disk-1"}},
+}
@@ -0,0 +1,287 @@
+//Package directortest is a fake BOSH director, for trying completions and the
+// director client against without a real BOSH. It answers with canned
+// responses, does basic or UAA auth the way a director would, and counts the
+// requests that it gets so that caching can be checked
+package directortest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Auth is how the fake director wants to be authenticated to
+type Auth struct {
+	//basic or uaa
+	Type     string
+	Username string
+	Password string
+	//For client credentials grants, or as the username and password with basic
+	// auth
+	ClientID     string
+	ClientSecret string
+	//The scopes put in tokens that UAA hands out. Tokens for director admins
+	// get bosh.admin if this is empty
+	Scopes []string
+	//How long tokens from UAA are good for
+	TokenTTL time.Duration
+}
+
+//Server is a fake director, with a fake UAA alongside it at /oauth/token when
+// it does UAA auth
+type Server struct {
+	*httptest.Server
+	Auth Auth
+	//The version given in /info
+	Version string
+
+	lock      sync.Mutex
+	responses map[string]response
+	requests  map[string]int
+	tokens    map[string]bool
+	nextTask  int
+}
+
+type response struct {
+	body []byte
+	//Answered with a redirect to a task, whose result is the body
+	task bool
+}
+
+//NewServer starts a fake director that does the given auth, serving Canned
+// until told otherwise with Handle. It needs closing when done with
+func NewServer(auth Auth) *Server {
+	s := newServer(auth)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+//NewTLSServer is NewServer, but over TLS with a certificate that the client
+// will need CACert to trust
+func NewTLSServer(auth Auth) *Server {
+	s := newServer(auth)
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func newServer(auth Auth) *Server {
+	if auth.Type == "" {
+		auth.Type = "basic"
+	}
+	if auth.TokenTTL == 0 {
+		auth.TokenTTL = time.Hour
+	}
+
+	s := &Server{
+		Auth:      auth,
+		Version:   "270.2.0 (00000000)",
+		responses: map[string]response{},
+		requests:  map[string]int{},
+		tokens:    map[string]bool{},
+		nextTask:  1,
+	}
+	for path, body := range Canned {
+		s.Handle(path, body)
+	}
+	s.HandleTask("/deployments/cf/instances?format=full", CannedInstanceDetails)
+
+	return s
+}
+
+//CACert is the PEM of the certificate that a TLS server presents
+func (s *Server) CACert() string {
+	if s.Certificate() == nil {
+		return ""
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}))
+}
+
+//Handle has the fake director answer path (query string and all) with body,
+// marshaled to JSON. A nil body takes the path away, so that it's a 404
+func (s *Server) Handle(path string, body interface{}) {
+	s.handle(path, body, false)
+}
+
+//HandleTask has the fake director answer path the way it answers requests
+// that it has to do work for: with a redirect to a task, whose result is a
+// JSON document per line, for each element of body
+func (s *Server) HandleTask(path string, body interface{}) {
+	s.handle(path, body, true)
+}
+
+func (s *Server) handle(path string, body interface{}, task bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if body == nil {
+		delete(s.responses, path)
+		return
+	}
+
+	contents, err := json.Marshal(body)
+	if err != nil {
+		panic(fmt.Sprintf("Could not marshal canned response for %s: %s", path, err))
+	}
+	s.responses[path] = response{body: contents, task: task}
+}
+
+//Requests returns how many times path (query string and all) has been asked
+// for, including those answered with a 304 or an auth failure
+func (s *Server) Requests(path string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[path]
+}
+
+//Reset forgets the requests had so far, and the tokens handed out
+func (s *Server) Reset() {
+	s.lock.Lock()
+	s.requests = map[string]int{}
+	s.tokens = map[string]bool{}
+	s.lock.Unlock()
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+
+	s.lock.Lock()
+	s.requests[path]++
+	s.lock.Unlock()
+
+	switch {
+	case r.URL.Path == "/info":
+		s.serveInfo(w)
+		return
+	case r.URL.Path == "/oauth/token" && s.Auth.Type == "uaa":
+		s.serveToken(w, r)
+		return
+	}
+
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, 0, "Not authorized")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/tasks/") {
+		s.serveTask(w, r)
+		return
+	}
+
+	s.lock.Lock()
+	resp, found := s.responses[path]
+	var taskID int
+	if found && resp.task {
+		taskID = s.nextTask
+		s.nextTask++
+		s.responses[fmt.Sprintf("/tasks/%d/output?type=result", taskID)] = response{body: taskResult(resp.body)}
+	}
+	s.lock.Unlock()
+
+	if !found {
+		writeError(w, http.StatusNotFound, 100, fmt.Sprintf("No canned response for %s", path))
+		return
+	}
+
+	if resp.task {
+		http.Redirect(w, r, fmt.Sprintf("/tasks/%d", taskID), http.StatusFound)
+		return
+	}
+
+	writeBody(w, r, resp.body)
+}
+
+func (s *Server) serveInfo(w http.ResponseWriter) {
+	info := map[string]interface{}{
+		"name":    "fake-director",
+		"uuid":    "00000000-0000-0000-0000-000000000000",
+		"version": s.Version,
+		"user_authentication": map[string]interface{}{
+			"type":    s.Auth.Type,
+			"options": map[string]interface{}{},
+		},
+	}
+	if s.Auth.Type == "uaa" {
+		info["user_authentication"].(map[string]interface{})["options"] = map[string]interface{}{"url": s.URL}
+	}
+
+	body, _ := json.Marshal(info)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+//serveTask answers for the tasks that redirects point to, which are always
+// already done
+func (s *Server) serveTask(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("type") == "result" {
+		s.lock.Lock()
+		resp, found := s.responses[r.URL.Path+"?"+r.URL.RawQuery]
+		s.lock.Unlock()
+		if !found {
+			writeError(w, http.StatusNotFound, 10001, "Task not found")
+			return
+		}
+
+		_, _ = w.Write(resp.body)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, 10001, "Task not found")
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":          id,
+		"state":       "done",
+		"description": "retrieve vm-stats",
+		"result":      "",
+	})
+	_, _ = w.Write(body)
+}
+
+//taskResult turns a JSON array into a JSON document per line, like the
+// director's task results. Anything else is left as is
+func taskResult(body []byte) []byte {
+	elements := []json.RawMessage{}
+	if json.Unmarshal(body, &elements) != nil {
+		return body
+	}
+
+	lines := make([]string, 0, len(elements))
+	for _, element := range elements {
+		lines = append(lines, string(element))
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+//writeBody sends body, or a 304 if the client already has it
+func writeBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status, code int, description string) {
+	body, _ := json.Marshal(map[string]interface{}{"code": code, "description": description})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
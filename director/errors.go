@@ -0,0 +1,137 @@
+package director
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+//The most of an error response that's worth reading
+const maxErrorBodySize = 64 * 1024
+
+//DirectorError is what comes back from a request that the director answered
+// with something other than a 2xx
+type DirectorError struct {
+	Path       string
+	StatusCode int
+	//The director's own error code and description, when it gave them
+	Code        int
+	Description string
+}
+
+func (e *DirectorError) Error() string {
+	msg := fmt.Sprintf("Director returned %d %s for %s", e.StatusCode, http.StatusText(e.StatusCode), e.Path)
+	if e.Description != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Description)
+		if e.Code != 0 {
+			msg = fmt.Sprintf("%s (code %d)", msg, e.Code)
+		}
+	}
+	return msg
+}
+
+//newDirectorError makes a DirectorError out of a non-2xx response, pulling
+// the description out of the body, which looks like
+// {"code": 70000, "description": "Deployment 'foo' doesn't exist"}
+func newDirectorError(path string, resp *http.Response) *DirectorError {
+	ret := &DirectorError{Path: path, StatusCode: resp.StatusCode}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return ret
+	}
+
+	var errBody struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(body, &errBody) == nil {
+		ret.Code, ret.Description = errBody.Code, errBody.Description
+	}
+
+	return ret
+}
+
+//ResponseTooLargeError is returned when a response goes past the most that
+// the client is willing to keep in memory
+type ResponseTooLargeError struct {
+	Path  string
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("Response for %s is larger than the limit of %d bytes", e.Path, e.Limit)
+}
+
+func IsTooLarge(err error) bool {
+	_, tooLarge := err.(*ResponseTooLargeError)
+	return tooLarge
+}
+
+//RecentFailureError is returned instead of trying a request that failed only
+// a moment ago
+type RecentFailureError struct {
+	Path   string
+	Err    string
+	Failed time.Time
+}
+
+func (e *RecentFailureError) Error() string {
+	return fmt.Sprintf("Not retrying %s, which failed %s ago: %s", e.Path, time.Since(e.Failed).Round(time.Millisecond), e.Err)
+}
+
+func IsRecentFailure(err error) bool {
+	_, recent := err.(*RecentFailureError)
+	return recent
+}
+
+//OfflineError is returned instead of going to the network in offline mode
+type OfflineError struct {
+	Path string
+}
+
+func (e *OfflineError) Error() string {
+	return fmt.Sprintf("Not fetching %s while offline", e.Path)
+}
+
+func IsOffline(err error) bool {
+	_, offline := err.(*OfflineError)
+	return offline
+}
+
+//FetchErrors are the errors from fetching several paths at once, by path
+type FetchErrors map[string]error
+
+func (e FetchErrors) Error() string {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	msgs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", path, e[path]))
+	}
+
+	return fmt.Sprintf("%d requests failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+//IsStatus returns whether err is a DirectorError with the given status code
+func IsStatus(err error, statusCode int) bool {
+	dErr, isDirectorErr := err.(*DirectorError)
+	return isDirectorErr && dErr.StatusCode == statusCode
+}
+
+func IsUnauthorized(err error) bool {
+	return IsStatus(err, http.StatusUnauthorized)
+}
+
+func IsNotFound(err error) bool {
+	return IsStatus(err, http.StatusNotFound)
+}
@@ -0,0 +1,29 @@
+package director
+
+//Feature is something that directors only have from some version on
+type Feature struct {
+	Name       string
+	MinVersion string
+}
+
+var (
+	//Configs of any type, at /configs. Older directors only have cloud,
+	// runtime, and CPI configs, each at its own endpoint
+	FeatureConfigs = Feature{Name: "generic configs", MinVersion: "263.0.0"}
+	//The variables that deployments have got from the config server
+	FeatureVariables = Feature{Name: "deployment variables", MinVersion: "262.0.0"}
+	//Deployments owned by teams, which tokens can be scoped to
+	FeatureTeams = Feature{Name: "teams", MinVersion: "261.0.0"}
+	//The event log, at /events
+	FeatureEvents = Feature{Name: "events", MinVersion: "256.0.0"}
+)
+
+//Features is every feature that's checked for, oldest first
+var Features = []Feature{FeatureEvents, FeatureTeams, FeatureVariables, FeatureConfigs}
+
+//Supports returns whether the director has the given feature. Like
+// VersionAtLeast, directors with versions that can't be made sense of are
+// assumed to have everything
+func (i Info) Supports(f Feature) bool {
+	return i.VersionAtLeast(f.MinVersion)
+}
@@ -0,0 +1,78 @@
+package director
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	dialTimeout           = 5 * time.Second
+	tlsHandshakeTimeout   = 5 * time.Second
+	responseHeaderTimeout = 10 * time.Second
+	//Enough to keep a connection around for each of the requests that are
+	// made at once
+	maxIdleConnsPerHost = 8
+)
+
+//newHTTPClient makes an http client that won't wait forever on a director (or
+// UAA) that has stopped answering. Connections go through the jumpbox in
+// allProxy if there is one, and otherwise through the usual $HTTPS_PROXY,
+// $HTTP_PROXY, and $NO_PROXY
+func newHTTPClient(tlsConfig *tls.Config, allProxy string, log Logger) (*http.Client, error) {
+	if log == nil {
+		log = nopLogger{}
+	}
+
+	dial, err := allProxyDialer(allProxy, log)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	} else {
+		//Like the bosh CLI, the jumpbox takes the place of any other proxy
+		proxy = nil
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			DialContext:           dial,
+			TLSClientConfig:       tlsConfig,
+			MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   tlsHandshakeTimeout,
+			ResponseHeaderTimeout: responseHeaderTimeout,
+			//Setting our own dialer and TLS config turns HTTP/2 off unless asked
+			// for. Load balancers that speak it let concurrent requests share one
+			// connection
+			ForceAttemptHTTP2: true,
+		},
+		//Redirects from the director are mostly to tasks, which need waiting on
+		// rather than just fetching, so those are left to the caller
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
+
+//sleepContext waits for d, or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
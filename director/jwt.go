@@ -0,0 +1,102 @@
+package director
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+//Tokens expiring within this long are treated as already expired, so that
+// they don't lapse while a request is in flight
+const tokenExpiryLeeway = 30 * time.Second
+
+type jwtClaims struct {
+	Exp      *float64 `json:"exp"`
+	UserName string   `json:"user_name"`
+	ClientID string   `json:"client_id"`
+	Subject  string   `json:"sub"`
+	Scope    []string `json:"scope"`
+}
+
+//tokenClaims reads the claims out of a JWT. The signature isn't checked - the
+// director will do that - we just want to know what's in it
+func tokenClaims(token string) (jwtClaims, bool) {
+	claims := jwtClaims{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims, false
+	}
+
+	err = json.Unmarshal(payload, &claims)
+	return claims, err == nil
+}
+
+//tokenExpiry reads the exp claim out of a JWT, so we know if it's worth sending
+func tokenExpiry(token string) (time.Time, bool) {
+	claims, ok := tokenClaims(token)
+	if !ok || claims.Exp == nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(*claims.Exp), 0), true
+}
+
+//tokenIdentity returns who the token was issued to, or "" if that can't be
+// told from it
+func tokenIdentity(token string) string {
+	claims, ok := tokenClaims(token)
+	switch {
+	case !ok:
+		return ""
+	case claims.UserName != "":
+		return "user:" + claims.UserName
+	case claims.Subject != "":
+		return "sub:" + claims.Subject
+	case claims.ClientID != "":
+		return "client:" + claims.ClientID
+	}
+	return ""
+}
+
+//tokenExpired returns true if the token is known to be expired (or about to
+// be). Tokens that can't be decoded are given the benefit of the doubt.
+func tokenExpired(token string) bool {
+	expiry, ok := tokenExpiry(token)
+	if !ok {
+		return false
+	}
+
+	return time.Now().Add(tokenExpiryLeeway).After(expiry)
+}
+
+//TokenAdminTeams returns the teams that the token can administer through
+// bosh.teams.<team>.admin scopes. It returns false if the token isn't limited to
+// teams, because it's a director admin or has no team scopes at all
+func TokenAdminTeams(token string) ([]string, bool) {
+	claims, ok := tokenClaims(token)
+	if !ok {
+		return nil, false
+	}
+
+	teams := []string{}
+	for _, scope := range claims.Scope {
+		parts := strings.Split(scope, ".")
+		switch {
+		case scope == "bosh.admin":
+			return nil, false
+		//i.e. bosh.<director uuid>.admin
+		case len(parts) == 3 && parts[0] == "bosh" && parts[2] == "admin":
+			return nil, false
+		case len(parts) == 4 && parts[0] == "bosh" && parts[1] == "teams" && parts[3] == "admin":
+			teams = append(teams, parts[2])
+		}
+	}
+
+	return teams, len(teams) > 0
+}
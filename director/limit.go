@@ -0,0 +1,34 @@
+package director
+
+import (
+	"io"
+)
+
+//limitedReader reads up to limit bytes, and then errors out instead of
+// pretending that the body ended there
+type limitedReader struct {
+	r     io.Reader
+	path  string
+	limit int64
+	read  int64
+}
+
+//LimitReader reads the response for path from r, failing with a
+// ResponseTooLargeError once it goes past limit bytes
+func LimitReader(r io.Reader, path string, limit int64) io.Reader {
+	return newLimitedReader(r, path, limit)
+}
+
+func newLimitedReader(r io.Reader, path string, limit int64) *limitedReader {
+	return &limitedReader{r: io.LimitReader(r, limit+1), path: path, limit: limit}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return 0, &ResponseTooLargeError{Path: l.path, Limit: l.limit}
+	}
+
+	return n, err
+}
@@ -0,0 +1,131 @@
+package director
+
+import (
+	"context"
+	"time"
+)
+
+//How long a response is considered good for, unless Options.TTL says
+// otherwise
+const DefaultTTL = 30 * time.Second
+
+//How long past its TTL a cached response may still be handed out while a
+// fresh one is fetched, unless Options.MaxStaleness says otherwise
+const DefaultMaxStaleness = 10 * time.Minute
+
+const (
+	defaultCacheSize       = 64 * 1024 * 1024
+	defaultMaxResponseSize = 32 * 1024 * 1024
+	defaultRetries         = 2
+)
+
+//Logger is where a Client says what it's up to
+type Logger interface {
+	Write(format string, args ...interface{})
+	//Whether whole requests and responses should be written out
+	Tracing() bool
+}
+
+//Observer is told what each request cost, for working out where the time
+// went
+type Observer interface {
+	Fetched(path string, bytes int64, took time.Duration)
+	Hit(path string)
+	Authed(took time.Duration)
+}
+
+//Options are how a Client caches and retries, and who it reports to. Anything
+// left unset gets a sensible default, so the zero value caches in memory only,
+// never serves stale responses, and logs nothing. The funcs are asked every
+// time, so that what they return can change over the life of the Client
+type Options struct {
+	Logger   Logger
+	Observer Observer
+	//Where responses and failures are kept between runs
+	Store Store
+	//How long the response for path is good for (AuthPath included)
+	TTL func(path string) time.Duration
+	//How long past its TTL a response may be served while it's revalidated
+	MaxStaleness time.Duration
+	//Whether to serve stale responses, and leave it to Revalidate to get them
+	// up to date
+	StaleWhileRevalidate func() bool
+	//Called with each path that was served stale, or that there wasn't time to
+	// fetch, so that it can be fetched again later
+	Revalidate func(path string)
+	//Whether to fall back on whatever's cached for a path, however old, when
+	// the director (or authenticating with it) fails
+	StaleOnError func() bool
+	//Waits for anybody else (a Client in another process, say) who's fetching
+	// key to finish first, so that only one of them asks the director. It
+	// returns how to let the next one go, and whether it had to wait
+	Lock func(ctx context.Context, key Key) (unlock func(), waited bool, err error)
+	//Whether to go without the network entirely, and make do with the Store
+	Offline func() bool
+	//How much room cached responses get in memory
+	CacheSize func() int64
+	//The most of a single response that will be read
+	MaxResponseSize func() int64
+	//How many times a failed request may be sent again
+	Retries func() int
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Write(string, ...interface{}) {}
+func (nopLogger) Tracing() bool                { return false }
+
+type nopObserver struct{}
+
+func (nopObserver) Fetched(string, int64, time.Duration) {}
+func (nopObserver) Hit(string)                           {}
+func (nopObserver) Authed(time.Duration)                 {}
+
+//withDefaults fills in whatever wasn't given
+func (o Options) withDefaults() Options {
+	if o.Logger == nil {
+		o.Logger = nopLogger{}
+	}
+	if o.Observer == nil {
+		o.Observer = nopObserver{}
+	}
+	if o.Store == nil {
+		o.Store = nopStore{}
+	}
+	if o.TTL == nil {
+		o.TTL = func(path string) time.Duration {
+			if path == AuthPath {
+				return DefaultAuthTTL
+			}
+			return DefaultTTL
+		}
+	}
+	if o.MaxStaleness == 0 {
+		o.MaxStaleness = DefaultMaxStaleness
+	}
+	if o.StaleWhileRevalidate == nil {
+		o.StaleWhileRevalidate = func() bool { return false }
+	}
+	if o.StaleOnError == nil {
+		o.StaleOnError = func() bool { return false }
+	}
+	if o.Revalidate == nil {
+		o.Revalidate = func(string) {}
+	}
+	if o.Lock == nil {
+		o.Lock = func(context.Context, Key) (func(), bool, error) { return func() {}, false, nil }
+	}
+	if o.Offline == nil {
+		o.Offline = func() bool { return false }
+	}
+	if o.CacheSize == nil {
+		o.CacheSize = func() int64 { return defaultCacheSize }
+	}
+	if o.MaxResponseSize == nil {
+		o.MaxResponseSize = func() int64 { return defaultMaxResponseSize }
+	}
+	if o.Retries == nil {
+		o.Retries = func() int { return defaultRetries }
+	}
+	return o
+}
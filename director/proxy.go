@@ -0,0 +1,209 @@
+package director
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+//The connection to each jumpbox is made on first use, and then shared by every
+// request that goes through it until it stops working
+var jumpboxClients = map[string]*ssh.Client{}
+var jumpboxLock sync.Mutex
+
+//allProxyDialer returns a dialer that tunnels through the jumpbox given, the
+// same way that the bosh CLI does with $BOSH_ALL_PROXY, or nil if none is
+// given. It looks like ssh+socks5://user@host:port?private-key=/path/to/key,
+// or socks5://host:port for a SOCKS5 proxy that's already there
+func allProxyDialer(allProxy string, log Logger) (dialFunc, error) {
+	if allProxy == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(allProxy)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse BOSH_ALL_PROXY: %s", err)
+	}
+
+	switch u.Scheme {
+	case "ssh+socks5":
+	case "socks5", "socks5h":
+		return socks5Dialer(u, log), nil
+	default:
+		return nil, fmt.Errorf("Unsupported BOSH_ALL_PROXY scheme `%s'. Only ssh+socks5 and socks5 are supported", u.Scheme)
+	}
+
+	keyPath := u.Query().Get("private-key")
+	if keyPath == "" {
+		return nil, fmt.Errorf("BOSH_ALL_PROXY needs a private-key")
+	}
+
+	keyBytes, err := ioutil.ReadFile(expandHome(keyPath))
+	if err != nil {
+		return nil, fmt.Errorf("Could not read BOSH_ALL_PROXY private key: %s", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse BOSH_ALL_PROXY private key: %s", err)
+	}
+
+	jumpbox := u.Host
+	if u.Port() == "" {
+		jumpbox = jumpbox + ":22"
+	}
+
+	config := &ssh.ClientConfig{
+		User: u.User.Username(),
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		//The bosh CLI doesn't check the jumpbox's host key either
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
+	}
+
+	log.Write("Tunneling through jumpbox `%s' as `%s'", jumpbox, config.User)
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, err := getJumpboxClient(ctx, jumpbox, config)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := dialThrough(ctx, client, network, addr)
+		if err == nil || ctx.Err() != nil {
+			return conn, err
+		}
+
+		//The connection to the jumpbox may well have dropped since it was made
+		// (an idle timeout, or a change of network), so make a new one and try
+		// once more
+		log.Write("Could not reach `%s' through jumpbox `%s': %s. Reconnecting", addr, jumpbox, err)
+		dropJumpboxClient(jumpbox, config, client)
+		client, err = getJumpboxClient(ctx, jumpbox, config)
+		if err != nil {
+			return nil, err
+		}
+		return dialThrough(ctx, client, network, addr)
+	}, nil
+}
+
+func jumpboxKey(jumpbox string, config *ssh.ClientConfig) string {
+	return config.User + "@" + jumpbox
+}
+
+//getJumpboxClient returns the connection to the jumpbox, connecting if there
+// isn't one yet
+func getJumpboxClient(ctx context.Context, jumpbox string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	jumpboxLock.Lock()
+	defer jumpboxLock.Unlock()
+
+	key := jumpboxKey(jumpbox, config)
+	if client, found := jumpboxClients[key]; found {
+		return client, nil
+	}
+
+	client, err := dialJumpbox(ctx, jumpbox, config)
+	if err != nil {
+		return nil, err
+	}
+
+	jumpboxClients[key] = client
+	return client, nil
+}
+
+//dropJumpboxClient throws away a connection to the jumpbox that has stopped
+// working, unless it has already been replaced
+func dropJumpboxClient(jumpbox string, config *ssh.ClientConfig, client *ssh.Client) {
+	jumpboxLock.Lock()
+	defer jumpboxLock.Unlock()
+
+	key := jumpboxKey(jumpbox, config)
+	if jumpboxClients[key] == client {
+		delete(jumpboxClients, key)
+	}
+	_ = client.Close()
+}
+
+//dialJumpbox connects to the jumpbox, giving up when ctx is done
+func dialJumpbox(ctx context.Context, jumpbox string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", jumpbox)
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to jumpbox `%s': %s", jumpbox, err)
+	}
+
+	//The SSH handshake doesn't know about ctx, so the connection under it is
+	// closed to stop it
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, jumpbox, config)
+	close(stop)
+	<-stopped
+	if ctx.Err() != nil {
+		if err == nil {
+			_ = sshConn.Close()
+		}
+		_ = conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("Could not connect to jumpbox `%s': %s", jumpbox, err)
+	}
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+//dialThrough opens a connection to addr through the jumpbox, giving up when
+// ctx is done
+func dialThrough(ctx context.Context, client *ssh.Client, network, addr string) (net.Conn, error) {
+	type dialed struct {
+		conn net.Conn
+		err  error
+	}
+
+	done := make(chan dialed, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		done <- dialed{conn: conn, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.conn, result.err
+	case <-ctx.Done():
+		//Whatever it comes up with in the end is of no use to anybody
+		go func() {
+			if result := <-done; result.conn != nil {
+				_ = result.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+//expandHome turns a leading ~/ into the home directory, as the private key's
+// path isn't run through a shell that would do it
+func expandHome(location string) string {
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(location, "~/") {
+		return home + location[1:]
+	}
+	return location
+}
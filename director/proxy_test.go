@@ -0,0 +1,272 @@
+package director
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+//jumpbox is an SSH server that forwards direct-tcpip channels, like a bosh
+// jumpbox does for the bosh CLI, and can hang up on everybody connected to it
+type jumpbox struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	lock  sync.Mutex
+	conns []net.Conn
+	//How many SSH connections have been made to it
+	handshakes int
+}
+
+func newJumpbox(t *testing.T, clientKey ssh.PublicKey) *jumpbox {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not make host key: %s", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("Could not make host signer: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, fmt.Errorf("Unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	j := &jumpbox{listener: listener, config: config}
+	t.Cleanup(func() {
+		_ = listener.Close()
+		j.hangUp()
+	})
+
+	go j.serve()
+	return j
+}
+
+func (j *jumpbox) serve() {
+	for {
+		conn, err := j.listener.Accept()
+		if err != nil {
+			return
+		}
+		j.lock.Lock()
+		j.conns = append(j.conns, conn)
+		j.lock.Unlock()
+
+		go j.handle(conn)
+	}
+}
+
+func (j *jumpbox) handle(conn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, j.config)
+	if err != nil {
+		return
+	}
+	j.lock.Lock()
+	j.handshakes++
+	j.lock.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		target := struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}{}
+		if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "No")
+			continue
+		}
+
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, channelReqs, err := newChannel.Accept()
+		if err != nil {
+			_ = upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(channelReqs)
+		go func() {
+			_, _ = io.Copy(channel, upstream)
+			_ = channel.Close()
+		}()
+		go func() {
+			_, _ = io.Copy(upstream, channel)
+			_ = upstream.Close()
+		}()
+	}
+}
+
+//hangUp drops every connection to the jumpbox, as an idle timeout would
+func (j *jumpbox) hangUp() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, conn := range j.conns {
+		_ = conn.Close()
+	}
+	j.conns = nil
+}
+
+func (j *jumpbox) handshakeCount() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.handshakes
+}
+
+//echoServer answers each connection with a line, for checking that a tunnel
+// got somewhere
+func echoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("hello\n"))
+			_ = conn.Close()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+//writeJumpboxKey writes a private key for the jumpbox to know, returning
+// where it is and its public half
+func writeJumpboxKey(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not make key: %s", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("Could not marshal key: %s", err)
+	}
+	location := t.TempDir() + "/jumpbox.key"
+	err = ioutil.WriteFile(location, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("Could not write key: %s", err)
+	}
+
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatalf("Could not make public key: %s", err)
+	}
+	return location, sshPublic
+}
+
+func readHello(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	got, err := ioutil.ReadAll(conn)
+	if err != nil || string(got) != "hello\n" {
+		t.Errorf("Expected hello through the tunnel, got %q (%v)", got, err)
+	}
+}
+
+func TestAllProxyReconnectsToJumpbox(t *testing.T) {
+	keyPath, publicKey := writeJumpboxKey(t)
+	j := newJumpbox(t, publicKey)
+	target := echoServer(t)
+
+	dial, err := allProxyDialer(fmt.Sprintf("ssh+socks5://jumpbox@%s?private-key=%s", j.listener.Addr(), keyPath), nopLogger{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	ctx := context.Background()
+	conn, err := dial(ctx, "tcp", target)
+	if err != nil {
+		t.Fatalf("Could not dial through the jumpbox: %s", err)
+	}
+	readHello(t, conn)
+
+	//The connection is kept for the next request
+	conn, err = dial(ctx, "tcp", target)
+	if err != nil {
+		t.Fatalf("Could not dial through the jumpbox again: %s", err)
+	}
+	readHello(t, conn)
+	if got := j.handshakeCount(); got != 1 {
+		t.Errorf("Expected the one connection to the jumpbox, got %d", got)
+	}
+
+	j.hangUp()
+	conn, err = dial(ctx, "tcp", target)
+	if err != nil {
+		t.Fatalf("Could not dial through the jumpbox after it hung up: %s", err)
+	}
+	readHello(t, conn)
+	if got := j.handshakeCount(); got != 2 {
+		t.Errorf("Expected a new connection to the jumpbox, got %d", got)
+	}
+}
+
+func TestAllProxyGivesUpWithContext(t *testing.T) {
+	keyPath, _ := writeJumpboxKey(t)
+
+	//Takes the connection, and then never says anything
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not listen: %s", err)
+	}
+	defer func() { _ = listener.Close() }()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+
+	dial, err := allProxyDialer(fmt.Sprintf("ssh+socks5://jumpbox@%s?private-key=%s", listener.Addr(), keyPath), nopLogger{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = dial(ctx, "tcp", "127.0.0.1:1")
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("Took %s to give up", took)
+	}
+}
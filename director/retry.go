@@ -0,0 +1,35 @@
+package director
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = time.Second
+)
+
+//shouldRetry returns whether the outcome of sending req looks like it could
+// go better the next time around. Only requests that are safe to send twice
+// get retried
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+
+	return err != nil || resp.StatusCode >= 500
+}
+
+//retryBackoff is how long to wait before the given retry (counting from 1).
+// The delay doubles each time up to a cap, and the actual wait is picked at
+// random below that so that concurrent requests don't retry in lockstep
+func retryBackoff(retry int) time.Duration {
+	delay := retryBaseDelay << uint(retry-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(delay))) + time.Millisecond
+}
@@ -0,0 +1,160 @@
+package director
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+//What SOCKS5 proxies say when they couldn't make a connection, by reply code
+var socks5Failures = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+//socks5Dialer returns a dialer that connects through the SOCKS5 proxy in u,
+// like a tunnel to a jumpbox that `ssh -D' or the like already has open.
+// Names are left for the proxy to look up, since they may only mean
+// something on the far side of it
+func socks5Dialer(u *url.URL, log Logger) dialFunc {
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		proxyAddr = proxyAddr + ":1080"
+	}
+	username := u.User.Username()
+	password, _ := u.User.Password()
+
+	log.Write("Going through SOCKS5 proxy `%s'", proxyAddr)
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{Timeout: dialTimeout}).DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("Could not connect to SOCKS5 proxy `%s': %s", proxyAddr, err)
+		}
+
+		_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+		err = socks5Connect(conn, addr, username, password)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("SOCKS5 proxy `%s' could not connect to `%s': %s", proxyAddr, addr, err)
+		}
+		_ = conn.SetDeadline(time.Time{})
+
+		return conn, nil
+	}
+}
+
+//socks5Connect has the proxy at the other end of conn connect it to addr,
+// logging in first if it wants a username and password
+func socks5Connect(conn net.Conn, addr, username, password string) error {
+	methods := []byte{0x00}
+	if username != "" {
+		methods = append(methods, 0x02)
+	}
+	_, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != 5 {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		if len(username) > 255 || len(password) > 255 {
+			return fmt.Errorf("username or password too long")
+		}
+		login := append([]byte{1, byte(len(username))}, username...)
+		login = append(append(login, byte(len(password))), password...)
+		_, err = conn.Write(login)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(conn, reply)
+		if err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("username and password were rejected")
+		}
+	default:
+		return fmt.Errorf("proxy wants a kind of authentication that isn't supported")
+	}
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port `%s'", portStr)
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else if len(host) <= 255 {
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else {
+		return fmt.Errorf("host name too long")
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	if err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		if failure, known := socks5Failures[header[1]]; known {
+			return fmt.Errorf("%s", failure)
+		}
+		return fmt.Errorf("failed with code %d", header[1])
+	}
+
+	//What the proxy bound to on its side isn't of any use, but it has to be
+	// read past
+	boundLen := 0
+	switch header[3] {
+	case 1:
+		boundLen = net.IPv4len
+	case 4:
+		boundLen = net.IPv6len
+	case 3:
+		_, err = io.ReadFull(conn, reply[:1])
+		if err != nil {
+			return err
+		}
+		boundLen = int(reply[0])
+	default:
+		return fmt.Errorf("unknown address type %d in reply", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, boundLen+2))
+	return err
+}
@@ -0,0 +1,134 @@
+package director
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	taskPollInitial = 250 * time.Millisecond
+	taskPollMax     = 2 * time.Second
+)
+
+var taskPathRegex = regexp.MustCompile(`^/tasks/(\d+)/?$`)
+
+//Task is a piece of work that the director is doing, or has done
+type Task struct {
+	ID          int    `json:"id"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Result      string `json:"result"`
+}
+
+//Finished returns whether the task is done with, however it turned out
+func (t Task) Finished() bool {
+	switch t.State {
+	case "queued", "processing", "cancelling":
+		return false
+	}
+	return true
+}
+
+//waitForTask polls the given task until it finishes, and then returns its
+// result output. Task results are a JSON document per line, so they're handed
+// back as a JSON array of those documents, which is what responses that
+// didn't need a task look like anyway
+func (c *Client) waitForTask(ctx context.Context, authHeader, id string, redirects int) (*http.Response, error) {
+	taskPath := fmt.Sprintf("/tasks/%s", id)
+	wait := taskPollInitial
+	for {
+		task := Task{}
+		err := c.getWithHeader(ctx, authHeader, taskPath, &task, redirects)
+		if err != nil {
+			return nil, err
+		}
+
+		if task.Finished() {
+			if task.State != "done" {
+				return nil, fmt.Errorf("Task %s %s: %s", id, task.State, task.Result)
+			}
+			break
+		}
+
+		c.opts.Logger.Write("Task %s is %s. Checking again in %s", id, task.State, wait)
+		err = sleepContext(ctx, wait)
+		if err != nil {
+			return nil, err
+		}
+
+		wait *= 2
+		if wait > taskPollMax {
+			wait = taskPollMax
+		}
+	}
+
+	outputPath := taskPath + "/output?type=result"
+	req, err := http.NewRequest("GET", c.path(outputPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authHeader)
+
+	resp, err := c.send(ctx, req, outputPath, redirects)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	//Task results are never the same twice, so there's nothing to revalidate
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(taskResultToArray(result))),
+	}, nil
+}
+
+//getWithHeader does an uncached GET with the given Authorization header,
+// decoding the response into output
+func (c *Client) getWithHeader(ctx context.Context, authHeader, path string, output interface{}, redirects int) error {
+	req, err := http.NewRequest("GET", c.path(path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authHeader)
+
+	resp, err := c.send(ctx, req, path, redirects)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	return json.NewDecoder(resp.Body).Decode(output)
+}
+
+//taskResultToArray joins the lines of a task result into a JSON array
+func taskResultToArray(result []byte) []byte {
+	ret := bytes.NewBufferString("[")
+	first := true
+	for _, line := range bytes.Split(result, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if !first {
+			ret.WriteString(",")
+		}
+		first = false
+		ret.Write(line)
+	}
+	ret.WriteString("]")
+
+	return ret.Bytes()
+}
@@ -0,0 +1,107 @@
+package director
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//UAA gets tokens from the UAA that a director delegates its auth to
+type UAA struct {
+	URL               string
+	CACert            string
+	SkipTLSValidation bool
+	//The jumpbox to go through, if any
+	AllProxy string
+	//Fail every grant instead of going to the network
+	Offline bool
+	Logger  Logger
+}
+
+//Token is what UAA hands back from a grant
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func (u UAA) ClientCredentials(ctx context.Context, clientID, clientSecret string) (*Token, error) {
+	return u.token(ctx, clientID, clientSecret, url.Values{
+		"grant_type": {"client_credentials"},
+	})
+}
+
+func (u UAA) Password(ctx context.Context, clientID, clientSecret, username, password string) (*Token, error) {
+	return u.token(ctx, clientID, clientSecret, url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	})
+}
+
+//Passcode trades a one time passcode, as handed out by UAA's /passcode page to
+// users who log in through SSO, for tokens
+func (u UAA) Passcode(ctx context.Context, clientID, clientSecret, passcode string) (*Token, error) {
+	return u.token(ctx, clientID, clientSecret, url.Values{
+		"grant_type": {"password"},
+		"passcode":   {passcode},
+	})
+}
+
+func (u UAA) Refresh(ctx context.Context, clientID, clientSecret, refreshToken string) (*Token, error) {
+	return u.token(ctx, clientID, clientSecret, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func (u UAA) token(ctx context.Context, clientID, clientSecret string, params url.Values) (*Token, error) {
+	if u.Offline {
+		return nil, &OfflineError{Path: strings.TrimRight(u.URL, "/") + "/oauth/token"}
+	}
+
+	req, err := http.NewRequest("POST",
+		strings.TrimRight(u.URL, "/")+"/oauth/token",
+		strings.NewReader(params.Encode()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(clientID, clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	tlsConfig, err := newTLSConfig(u.CACert, u.SkipTLSValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newHTTPClient(tlsConfig, u.AllProxy, u.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("UAA %s grant failed with status %d", params.Get("grant_type"), resp.StatusCode)
+	}
+
+	ret := &Token{}
+	err = json.NewDecoder(resp.Body).Decode(ret)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse UAA token response: %s", err)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//diskEntry is a director.Entry as it is kept on disk, between runs
+type diskEntry struct {
+	Director     string    `json:"director"`
+	Identity     string    `json:"identity"`
+	Path         string    `json:"path"`
+	Body         []byte    `json:"body"`
+	Fetched      time.Time `json:"fetched"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+//diskCacheEnabled returns whether responses should be kept on disk. It can be
+// turned off with disk_cache: false in the tool config or
+// BOSH_COMPLETE_DISK_CACHE=false
+func diskCacheEnabled() bool {
+	return envBool("BOSH_COMPLETE_DISK_CACHE", orDefault(getToolConfig().DiskCache, true))
+}
+
+func responseCacheDir() string {
+	return fmt.Sprintf("%s/responses", cacheDir())
+}
+
+//diskCachePath is where the response for the given key is kept. Paths can
+// have all sorts in them, so the file is named for a hash of the key
+func diskCachePath(key director.Key) string {
+	sum := sha256.Sum256([]byte(key.Director + "\x00" + key.Identity + "\x00" + key.Path))
+	return fmt.Sprintf("%s/%s.json", responseCacheDir(), hex.EncodeToString(sum[:]))
+}
+
+//loadDiskEntry returns the response cached on disk for the given key, if there
+// is one. It's up to the caller to decide if it's fresh enough
+func loadDiskEntry(key director.Key) (director.Entry, bool) {
+	if !diskCacheEnabled() {
+		return director.Entry{}, false
+	}
+
+	location := diskCachePath(key)
+	entry := diskEntry{}
+	err := readCacheFile(location, &entry)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Write("Could not read disk cache for %s: %s", key.Path, err)
+		}
+		return director.Entry{}, false
+	}
+
+	//Guard against the (astronomically unlikely) hash collision too
+	if entry.key() != key {
+		log.Write("Ignoring unusable disk cache entry for %s", key.Path)
+		return director.Entry{}, false
+	}
+
+	//The modification time is when the entry was last used, for eviction
+	now := time.Now()
+	_ = os.Chtimes(location, now, now)
+
+	return director.Entry{
+		Body:         entry.Body,
+		Fetched:      entry.Fetched,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+	}, true
+}
+
+//saveDiskEntry writes the response for the given key to disk. Failing to is
+// only worth logging - the next run will just have to fetch it
+func saveDiskEntry(key director.Key, entry director.Entry) {
+	if !diskCacheEnabled() {
+		return
+	}
+
+	err := ensureDir(responseCacheDir())
+	if err != nil {
+		log.Write("Could not make cache dir: %s", err)
+		return
+	}
+
+	err = writeCacheFile(diskCachePath(key), diskEntry{
+		Director:     key.Director,
+		Identity:     key.Identity,
+		Path:         key.Path,
+		Body:         entry.Body,
+		Fetched:      entry.Fetched,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+	})
+	if err != nil {
+		log.Write("Could not write disk cache entry for %s: %s", key.Path, err)
+		return
+	}
+
+	evictDiskCache(maxCacheSize())
+}
+
+//evictDiskCache removes the least recently used responses from disk until
+// what's left fits in limit
+func evictDiskCache(limit int64) {
+	dir := responseCacheDir()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Write("Could not list cache dir: %s", err)
+		return
+	}
+
+	var total int64
+	for _, file := range files {
+		total += file.Size()
+	}
+
+	if total <= limit {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, file := range files {
+		if total <= limit {
+			break
+		}
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		err = os.Remove(fmt.Sprintf("%s/%s", dir, file.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			log.Write("Could not evict `%s' from the disk cache: %s", file.Name(), err)
+			continue
+		}
+		total -= file.Size()
+	}
+}
+
+//The longest that a completion waits on another that's fetching the same
+// thing, before fetching it itself
+const fetchLockWait = 2 * time.Second
+
+func fetchLockDir() string {
+	return fmt.Sprintf("%s/locks", cacheDir())
+}
+
+//lockFetch waits for any other completion (in another shell, say, or from
+// another press of Tab) that's fetching key to finish, so that a crowd of
+// them doesn't all ask the director for the same thing at once. Nobody waits
+// past the completion's deadline
+func lockFetch(ctx context.Context, key director.Key) (func(), bool, error) {
+	if !diskCacheEnabled() {
+		//Nobody else would see what was fetched anyway
+		return func() {}, false, nil
+	}
+
+	err := ensureDir(fetchLockDir())
+	if err != nil {
+		return nil, false, err
+	}
+
+	wait := fetchLockWait
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) < wait {
+		wait = time.Until(deadline)
+	}
+
+	location := strings.Replace(diskCachePath(key), responseCacheDir(), fetchLockDir(), 1)
+	return lockFileWithin(strings.TrimSuffix(location, ".json")+".lock", wait)
+}
+
+//diskFailure records a request that failed, so that the next few runs don't
+// sit through the same failure
+type diskFailure struct {
+	Director string    `json:"director"`
+	Identity string    `json:"identity"`
+	Path     string    `json:"path"`
+	Error    string    `json:"error"`
+	Failed   time.Time `json:"failed"`
+}
+
+func failureCacheDir() string {
+	return fmt.Sprintf("%s/failures", cacheDir())
+}
+
+func failureCachePath(key director.Key) string {
+	return strings.Replace(diskCachePath(key), responseCacheDir(), failureCacheDir(), 1)
+}
+
+//loadDiskFailure returns when the request for key last failed, and why
+func loadDiskFailure(key director.Key) (director.Failure, bool) {
+	if !diskCacheEnabled() {
+		return director.Failure{}, false
+	}
+
+	entry := diskFailure{}
+	err := readCacheFile(failureCachePath(key), &entry)
+	if err != nil || entry.Director != key.Director || entry.Identity != key.Identity || entry.Path != key.Path {
+		return director.Failure{}, false
+	}
+
+	return director.Failure{Err: entry.Error, Failed: entry.Failed}, true
+}
+
+func saveDiskFailure(key director.Key, f director.Failure) {
+	if !diskCacheEnabled() {
+		return
+	}
+
+	err := ensureDir(failureCacheDir())
+	if err != nil {
+		log.Write("Could not make cache dir: %s", err)
+		return
+	}
+
+	err = writeCacheFile(failureCachePath(key), diskFailure{
+		Director: key.Director,
+		Identity: key.Identity,
+		Path:     key.Path,
+		Error:    f.Err,
+		Failed:   f.Failed,
+	})
+	if err != nil {
+		log.Write("Could not write failure for %s: %s", key.Path, err)
+	}
+}
+
+func clearDiskFailure(key director.Key) {
+	if !diskCacheEnabled() {
+		return
+	}
+
+	err := os.Remove(failureCachePath(key))
+	if err != nil && !os.IsNotExist(err) {
+		log.Write("Could not clear failure for %s: %s", key.Path, err)
+	}
+}
+
+//readCacheFile reads the cache file at location into v, decrypting it if
+// need be
+func readCacheFile(location string, v interface{}) error {
+	contents, err := ioutil.ReadFile(location)
+	if err != nil {
+		return err
+	}
+
+	contents, err = openCacheFile(contents)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+//writeCacheFile writes v to the cache file at location, encrypting it if
+// cache encryption is on
+func writeCacheFile(location string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	contents, err = sealCacheFile(contents)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(location, contents)
+}
+
+func (e diskEntry) key() director.Key {
+	return director.Key{Director: e.Director, Identity: e.Identity, Path: e.Path}
+}
+
+//diskStore is where clients keep responses and failures between runs
+type diskStore struct{}
+
+func (diskStore) Load(key director.Key) (director.Entry, bool) {
+	start := time.Now()
+	entry, found := loadDiskEntry(key)
+	stats.readDisk(time.Since(start))
+	return entry, found
+}
+
+func (diskStore) Save(key director.Key, entry director.Entry) {
+	saveDiskEntry(key, entry)
+}
+
+func (diskStore) LoadFailure(key director.Key) (director.Failure, bool) {
+	return loadDiskFailure(key)
+}
+
+func (diskStore) SaveFailure(key director.Key, f director.Failure) {
+	saveDiskFailure(key, f)
+}
+
+func (diskStore) ClearFailure(key director.Key) {
+	clearDiskFailure(key)
+}
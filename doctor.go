@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//doctor prints the outcome of each check as it goes, and remembers whether
+// any of them failed
+type doctor struct {
+	failed bool
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Printf("[ ok ] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) info(format string, args ...interface{}) {
+	fmt.Printf("[info] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(format string, args ...interface{}) {
+	fmt.Printf("[warn] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) fail(format string, args ...interface{}) {
+	d.failed = true
+	fmt.Printf("[FAIL] %s\n", fmt.Sprintf(format, args...))
+}
+
+//doDoctor checks everything that completions depend on, from the bosh CLI to
+// the director for the given environment (or $BOSH_ENVIRONMENT), so that
+// users can work out for themselves why Tab isn't doing anything
+func doDoctor(args []string) {
+	ctx := compContext{
+		Context: context.Background(),
+		Flags:   map[string][]string{},
+		FromEnv: map[string]string{},
+	}
+	if len(args) > 0 {
+		ctx.Flags["--environment"] = []string{args[0]}
+	}
+	ctx.insertEnvvars()
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithTimeout(ctx.Context, completionTimeout())
+	defer cancel()
+
+	d := &doctor{}
+	d.checkCLI()
+	d.checkHook()
+	d.checkToolConfig()
+	d.checkCache()
+	if cfg := d.checkConfig(ctx); cfg != nil {
+		if d.checkEnvironment(ctx, cfg) {
+			d.checkDeployment(ctx)
+			if offlineMode() {
+				d.warn("Offline mode is on, so completions only use what's cached. Not checking the director")
+			} else {
+				d.checkDirector(ctx)
+			}
+		}
+	}
+
+	if d.failed {
+		os.Exit(1)
+	}
+}
+
+func (d *doctor) checkCLI() {
+	path, err := exec.LookPath("bosh")
+	if err != nil {
+		d.warn("No bosh CLI on the PATH. Completions will work, but won't learn anything from its help")
+		return
+	}
+
+	output, _ := runCLI(path, "--version")
+	matches := cliVersionRegex.FindSubmatch(output)
+	if matches == nil {
+		d.fail("bosh CLI at `%s' didn't say what version it is", path)
+		return
+	}
+
+	d.ok("bosh CLI %s at `%s'", matches[1], path)
+	if !cliHelpEnabled() {
+		d.warn("Learning from the bosh CLI's help is turned off")
+	}
+}
+
+//rcFiles are where each shell's hook is usually installed
+var rcFiles = []string{
+	".bashrc",
+	".bash_profile",
+	".profile",
+	".zshrc",
+	".zprofile",
+	".config/fish/completions/bosh.fish",
+	".config/fish/config.fish",
+	".config/powershell/Microsoft.PowerShell_profile.ps1",
+}
+
+//checkHook looks for the shell hook in the usual startup files. It can't tell
+// if the shell running right now has actually loaded it
+func (d *doctor) checkHook() {
+	found := []string{}
+	for _, rcFile := range rcFiles {
+		contents, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", homeDir(), rcFile))
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(contents), "bosh-complete") {
+			found = append(found, "~/"+rcFile)
+		}
+	}
+
+	if len(found) == 0 {
+		d.fail("No shell hook found in any of ~/%s. See `bosh-complete init'", strings.Join(rcFiles, ", ~/"))
+		return
+	}
+
+	d.ok("Shell hook installed in %s", strings.Join(found, ", "))
+}
+
+func (d *doctor) checkToolConfig() {
+	cfg := getToolConfig()
+	if len(cfg.Problems) == 0 {
+		return
+	}
+	for _, problem := range cfg.Problems {
+		d.fail("Tool config `%s' is being ignored: %s", toolConfigPath(), problem)
+	}
+}
+
+func (d *doctor) checkCache() {
+	if !diskCacheEnabled() {
+		d.warn("Disk cache is turned off, so every completion asks the director")
+	}
+
+	dir := cacheDir()
+	err := ensureDir(dir)
+	if err == nil {
+		var probe *os.File
+		probe, err = ioutil.TempFile(dir, ".doctor")
+		if err == nil {
+			_ = probe.Close()
+			_ = os.Remove(probe.Name())
+		}
+	}
+	if err != nil {
+		d.fail("Cache directory `%s' isn't writable: %s", dir, err)
+		return
+	}
+
+	entries, _ := ioutil.ReadDir(responseCacheDir())
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size()
+	}
+	d.ok("Cache directory `%s' holds %d response(s) (%d bytes)", dir, len(entries), size)
+
+	failures, _ := ioutil.ReadDir(failureCacheDir())
+	if len(failures) > 0 {
+		d.warn("%d recent director failure(s) are being remembered. `bosh-complete flush-cache' forgets them", len(failures))
+	}
+
+	conn, err := net.DialTimeout("unix", daemonSocketPath(), daemonDialTimeout)
+	if err == nil {
+		_ = conn.Close()
+		d.ok("Daemon is listening at `%s'", daemonSocketPath())
+	}
+}
+
+func (d *doctor) checkConfig(ctx compContext) *boshConfig {
+	cfg, err := getBoshConfig(ctx)
+	if err != nil {
+		d.fail("Could not read the bosh config: %s", err)
+		return nil
+	}
+
+	for _, problem := range cfg.Problems {
+		d.warn("bosh config `%s': %s", cfg.Location, problem)
+	}
+	d.ok("bosh config `%s' has %d environment(s)", cfg.Location, len(cfg.Environments))
+
+	return cfg
+}
+
+//checkEnvironment returns whether there's an environment to go on and check
+// the director of
+func (d *doctor) checkEnvironment(ctx compContext, cfg *boshConfig) bool {
+	envName, found := ctx.FlagValue("--environment")
+	if !found {
+		d.fail("No environment given. Set BOSH_ENVIRONMENT or pass one to `bosh-complete doctor'")
+		return false
+	}
+
+	envAddr, env := cfg.resolveEnvironment(envName)
+	if login, err := getLogin(envAddr); err != nil {
+		d.warn("Could not read logins: %s", err)
+	} else if login != nil {
+		d.ok("Environment `%s' (from %s) has been logged in to with `bosh-complete login'", envName, ctx.FlagSource("--environment"))
+		return true
+	}
+	if env == nil {
+		d.warn("Environment `%s' (from %s) isn't in the bosh config, so there's no login to use", envName, ctx.FlagSource("--environment"))
+		return true
+	}
+
+	d.ok("Environment `%s' (from %s) is %s", envName, ctx.FlagSource("--environment"), envAddr)
+	return true
+}
+
+//checkDeployment says which deployment instances, errands, and the like will
+// be completed from, if any
+func (d *doctor) checkDeployment(ctx compContext) {
+	deployment, found := ctx.FlagValue("--deployment")
+	if !found {
+		d.warn("No deployment given, so instances, errands, and variables won't complete without -d. Set BOSH_DEPLOYMENT to change that")
+		return
+	}
+
+	d.ok("Deployment `%s' (from %s)", deployment, ctx.FlagSource("--deployment"))
+}
+
+func (d *doctor) checkDirector(ctx compContext) {
+	c, err := getBoshClient(ctx)
+	if err != nil {
+		d.fail("Could not make a client for the director: %s", err)
+		return
+	}
+
+	info, err := c.Info(ctx.Context)
+	if err != nil {
+		d.fail("Could not reach the director at `%s': %s", c.URL, err)
+		return
+	}
+	d.ok("Director %s at `%s' uses %s auth", info.Version, c.URL, info.Auth.Type)
+	switch {
+	case strings.HasPrefix(c.URL, "http://"):
+	case c.SkipSSLValidation:
+		d.warn("The director's certificate isn't checked, because $BOSH_COMPLETE_SKIP_SSL_VALIDATION or skip_ssl_validation in the config says not to. Give its CA cert with `bosh alias-env --ca-cert' or $BOSH_CA_CERT instead")
+	case c.CACert != "":
+		d.ok("The director's certificate is checked against its CA cert")
+	default:
+		d.ok("The director's certificate is checked against the system's CAs, as there's no CA cert for it")
+	}
+	for _, feature := range director.Features {
+		if !info.Supports(feature) {
+			d.warn("Director %s doesn't have %s (new in %s), so completions go without them", info.Version, feature.Name, feature.MinVersion)
+		}
+	}
+
+	if info.Auth.Type == "uaa" {
+		uaa := director.UAA{
+			URL:               info.Auth.Options.URL,
+			CACert:            c.UAACACert,
+			SkipTLSValidation: c.UAASkipSSLValidation,
+			AllProxy:          c.AllProxy,
+		}
+		_, err = uaa.ClientCredentials(ctx.Context, "", "")
+		//Any answer at all, even turning away a client with no name, means
+		// that UAA is there
+		if err != nil && !strings.Contains(err.Error(), "failed with status") {
+			d.fail("Could not reach UAA at `%s': %s", info.Auth.Options.URL, err)
+			return
+		}
+		d.ok("UAA at `%s' is reachable", info.Auth.Options.URL)
+	}
+
+	err = c.Refetch(ctx.Context, director.DeploymentsPath)
+	if err != nil {
+		d.fail("Could not authenticate to the director: %s", err)
+		return
+	}
+	d.ok("Authenticated to the director")
+
+	for _, line := range stats.summary() {
+		d.info("%s", line)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+//Marks a cache file as encrypted, and with which scheme
+var encryptedCacheMagic = []byte("bosh-complete-aes-gcm-1\n")
+
+//Key derivation happens on every run, so it can't take too long. This is
+// about 30ms on a laptop
+const (
+	scryptN      = 1 << 14
+	scryptR      = 8
+	scryptP      = 1
+	cacheKeySize = 32
+)
+
+//What everything bosh-complete keeps in the OS keychain is filed under, and
+// the account that the cache key is kept as
+const (
+	keychainService = "bosh-complete"
+	keychainAccount = "cache"
+)
+
+var cacheKey []byte
+var cacheKeyErr error
+var cacheKeyOnce sync.Once
+
+//cacheEncryption returns how cache files are to be encrypted, from
+// $BOSH_COMPLETE_CACHE_ENCRYPTION: "keychain", "passphrase", or "" for not at
+// all
+func cacheEncryption() string {
+	return strings.ToLower(os.Getenv("BOSH_COMPLETE_CACHE_ENCRYPTION"))
+}
+
+//getCacheKey returns the key that cache files are encrypted with, deriving it
+// the first time
+func getCacheKey() ([]byte, error) {
+	cacheKeyOnce.Do(func() {
+		var secret string
+		switch mode := cacheEncryption(); mode {
+		case "passphrase":
+			secret = os.Getenv("BOSH_COMPLETE_CACHE_PASSPHRASE")
+			if secret == "" {
+				cacheKeyErr = fmt.Errorf("Cache encryption by passphrase needs $BOSH_COMPLETE_CACHE_PASSPHRASE")
+				return
+			}
+		case "keychain":
+			secret, cacheKeyErr = keychainSecret()
+			if cacheKeyErr != nil {
+				return
+			}
+		default:
+			cacheKeyErr = fmt.Errorf("Unknown cache encryption `%s'", mode)
+			return
+		}
+
+		salt, err := cacheKeySalt()
+		if err != nil {
+			cacheKeyErr = err
+			return
+		}
+
+		cacheKey, cacheKeyErr = scrypt.Key([]byte(secret), salt, scryptN, scryptR, scryptP, cacheKeySize)
+	})
+
+	return cacheKey, cacheKeyErr
+}
+
+//cacheKeySalt returns the salt for deriving the cache key, making one up the
+// first time around
+func cacheKeySalt() ([]byte, error) {
+	location := fmt.Sprintf("%s/key.salt", cacheDir())
+	salt, err := ioutil.ReadFile(location)
+	if err == nil && len(salt) > 0 {
+		return salt, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	err = ensureDir(cacheDir())
+	if err != nil {
+		return nil, err
+	}
+
+	salt = make([]byte, 16)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return salt, writeFileAtomic(location, salt)
+}
+
+//keychainSecret gets the secret for the cache key out of the OS keychain,
+// putting a random one there if there isn't one yet
+func keychainSecret() (string, error) {
+	secret, found, err := keychainGet(keychainAccount)
+	if err != nil {
+		return "", fmt.Errorf("%s. Use a passphrase instead", err)
+	}
+	if found {
+		return secret, nil
+	}
+
+	raw := make([]byte, 32)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	secret = hex.EncodeToString(raw)
+
+	err = keychainSet(keychainAccount, secret)
+	if err != nil {
+		return "", fmt.Errorf("Could not store cache key: %s", err)
+	}
+
+	log.Write("Stored a new cache key in the keychain")
+	return secret, nil
+}
+
+//sealCacheFile encrypts the contents of a cache file, if cache encryption is
+// turned on
+func sealCacheFile(plain []byte) ([]byte, error) {
+	if cacheEncryption() == "" {
+		return plain, nil
+	}
+
+	gcm, err := cacheCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := append([]byte{}, encryptedCacheMagic...)
+	ret = append(ret, nonce...)
+	return gcm.Seal(ret, nonce, plain, encryptedCacheMagic), nil
+}
+
+//openCacheFile decrypts the contents of a cache file, if it's encrypted.
+// Encrypted files can't be read with encryption turned off, and unencrypted
+// ones aren't trusted with it turned on
+func openCacheFile(contents []byte) ([]byte, error) {
+	encrypted := bytes.HasPrefix(contents, encryptedCacheMagic)
+	if cacheEncryption() == "" {
+		if encrypted {
+			return nil, fmt.Errorf("Cache file is encrypted, but cache encryption is off")
+		}
+		return contents, nil
+	}
+
+	if !encrypted {
+		return nil, fmt.Errorf("Cache file isn't encrypted")
+	}
+
+	gcm, err := cacheCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := contents[len(encryptedCacheMagic):]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Cache file is truncated")
+	}
+
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, encryptedCacheMagic)
+}
+
+func cacheCipher() (cipher.AEAD, error) {
+	key, err := getCacheKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
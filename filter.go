@@ -0,0 +1,104 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+//Narrows the final candidate list down to those matching a user-provided
+// pattern. nil if no (valid) pattern was given
+var candidateFilter func(string) bool
+
+//parseFilter turns a pattern into a candidate filter. Patterns wrapped in
+// slashes (e.g. /^cf-.*$/) are treated as regular expressions. Anything else
+// is treated as a glob, where * matches any run of characters and ? matches
+// any single character. Globs must match the whole candidate.
+func parseFilter(pattern string) (func(string) bool, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	reStr := regexp.QuoteMeta(pattern)
+	reStr = strings.Replace(reStr, `\*`, ".*", -1)
+	reStr = strings.Replace(reStr, `\?`, ".", -1)
+	re, err := regexp.Compile("^" + reStr + "$")
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+func setupFilter(pattern string) {
+	if pattern == "" {
+		return
+	}
+
+	var err error
+	candidateFilter, err = parseFilter(pattern)
+	if err != nil {
+		log.Write("Could not parse filter `%s': %s. Not filtering", pattern, err)
+		candidateFilter = nil
+		return
+	}
+
+	log.Write("Filtering candidates with pattern `%s'", pattern)
+}
+
+//How the word being completed is matched against candidates. Whatever the
+// mode, candidates that it's a prefix of come first
+var matchModes = map[string]func(val, token string) bool{
+	"prefix": strings.HasPrefix,
+	"ignore-case": func(val, token string) bool {
+		return strings.HasPrefix(strings.ToLower(val), strings.ToLower(token))
+	},
+	"substring": func(val, token string) bool {
+		return strings.Contains(strings.ToLower(val), strings.ToLower(token))
+	},
+	"fuzzy": func(val, token string) bool {
+		return isSubsequence(strings.ToLower(token), strings.ToLower(val))
+	},
+}
+
+const defaultMatchMode = "prefix"
+
+var matchMode = defaultMatchMode
+
+//setupMatchMode picks the match mode from $BOSH_COMPLETE_MATCH, or match in
+// the tool config
+func setupMatchMode() {
+	mode := envString("BOSH_COMPLETE_MATCH", getToolConfig().Match)
+	if mode == "" {
+		return
+	}
+
+	if _, found := matchModes[mode]; !found {
+		log.Write("Unknown match mode `%s'. Using %s", mode, matchMode)
+		return
+	}
+
+	matchMode = mode
+}
+
+//matchesLoosely returns whether candidates may be handed back that don't
+// start with what was typed, which shells that do their own matching need to
+// be told to leave alone
+func matchesLoosely() bool {
+	return dontFilterPrefix || matchMode != defaultMatchMode
+}
+
+//isSubsequence returns whether the characters of sub all appear in s, in
+// order, e.g. "zk" in "prod-zookeeper"
+func isSubsequence(sub, s string) bool {
+	for _, r := range sub {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(string(r)):]
+	}
+	return true
+}
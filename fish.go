@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+
+	"text/template"
+)
+
+//fish hands over the current process's command line and where the cursor is
+// in it, like bash's COMP_LINE and COMP_POINT but counting characters rather
+// than bytes. -f keeps fish from offering files of its own alongside
+var fishSource = `
+function __bosh_complete
+	set -lx COMP_LINE (commandline -p)
+	set -lx COMP_POINT (string length -- (commandline -cp))
+	{{.Executable}} complete --shell fish {{.Debug}} --
+end
+
+complete -c {{.Bosh}} -f -a '(__bosh_complete)'
+`
+
+func doFishSource() {
+	tmpl := template.Must(template.New("fish_source").Parse(fishSource))
+	me, err := os.Executable()
+	debug := ""
+	if opts.Debug {
+		debug = "--debug"
+	}
+	if err != nil {
+		panic("Could not determine executable location")
+	}
+	err = tmpl.Execute(os.Stdout, struct {
+		Executable string
+		Bosh       string
+		Debug      string
+	}{
+		Executable: me,
+		Bosh:       "bosh",
+		Debug:      debug,
+	})
+	if err != nil {
+		panic("Could not render source template for fish")
+	}
+}
@@ -8,6 +8,10 @@ type flag struct {
 	Long     string
 	Short    rune
 	Complete compFunc
+	//Whether the flag can be given multiple times to build up a list of values
+	Repeatable bool
+	//Whether the flag's value is itself a comma separated list of values
+	CommaSeparated bool
 }
 
 func insertFlag(f flag) {
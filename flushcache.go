@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+//doFlushCache throws away cached director responses: all of them, or just
+// those for the given environment (by alias or URL) and/or endpoint. Giving
+// an endpoint like /deployments also flushes everything beneath it, such as
+// /deployments/cf/instances
+func doFlushCache() {
+	director, err := environmentDirector(opts.FlushCache.Environment)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	flushed, err := flushDiskCache(responseCacheDir(), director, opts.FlushCache.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not flush cache: %s\n", err)
+		os.Exit(1)
+	}
+
+	//Recent failures are flushed too, since whatever was wrong may well have
+	// been fixed by now. They aren't counted, not being responses
+	_, err = flushDiskCache(failureCacheDir(), director, opts.FlushCache.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not flush cached failures: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Flushed %d cached response(s)\n", flushed)
+}
+
+//flushDiskCache removes entries from the given cache dir for the given
+// director and endpoint, where empty strings match anything. It returns how
+// many were removed
+func flushDiskCache(dir, director, endpoint string) (int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	endpoint = strings.TrimRight(endpoint, "/")
+	flushed := 0
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		location := fmt.Sprintf("%s/%s", dir, file.Name())
+		if director != "" || endpoint != "" {
+			entry := diskEntry{}
+			//Entries that can't be read are no use to anybody, so they go too
+			if readCacheFile(location, &entry) == nil {
+				if director != "" && entry.Director != director {
+					continue
+				}
+				if endpoint != "" && !pathUnder(entry.Path, endpoint) {
+					continue
+				}
+			}
+		}
+
+		err = os.Remove(location)
+		if err != nil && !os.IsNotExist(err) {
+			return flushed, err
+		}
+		flushed++
+	}
+
+	return flushed, nil
+}
+
+//pathUnder returns whether path is the endpoint, or something beneath it, or
+// the endpoint with a query
+func pathUnder(path, endpoint string) bool {
+	return path == endpoint ||
+		strings.HasPrefix(path, endpoint+"/") ||
+		strings.HasPrefix(path, endpoint+"?")
+}
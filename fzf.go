@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"text/template"
+)
+
+//The fzf key bindings replace the word before the cursor with whatever is
+// picked out of fzf. Each candidate's value comes before a tab, with what fzf
+// shows of it after
+var fzfSources = map[string]string{
+	"bash": `
+__bosh_fzf() {
+	local before="${READLINE_LINE:0:$READLINE_POINT}"
+	local word="${before##* }"
+	local choice="$(COMP_LINE="$READLINE_LINE" COMP_POINT="$READLINE_POINT" {{.Executable}} complete --shell fzf {{.Debug}} -- | {{.Picker}} | cut -f1)"
+	if [[ -n "$choice" ]]; then
+		before="${before%"$word"}$choice"
+		READLINE_LINE="$before${READLINE_LINE:$READLINE_POINT}"
+		READLINE_POINT=${#before}
+	fi
+}
+
+bind -x '"{{.Key}}": __bosh_fzf'
+`,
+	"zsh": `
+__bosh_fzf() {
+	local word="${LBUFFER##* }"
+	local choice="$(COMP_LINE="$BUFFER" COMP_POINT="${#LBUFFER}" {{.Executable}} complete --shell fzf {{.Debug}} -- | {{.Picker}} | cut -f1)"
+	if [[ -n "$choice" ]]; then
+		LBUFFER="${LBUFFER%"$word"}$choice"
+	fi
+	zle reset-prompt
+}
+
+zle -N __bosh_fzf
+bindkey '{{.Key}}' __bosh_fzf
+`,
+}
+
+//What each shell calls the key that the fzf bindings go on: Ctrl-X b
+var fzfKeys = map[string]string{
+	"bash": `\C-xb`,
+	"zsh":  "^Xb",
+}
+
+const fzfPicker = `fzf --height=40% --reverse --select-1 --exit-0 --delimiter='\t' --with-nth=2.. --tabstop=4`
+
+//formatFzf gives each candidate ready to go on the command line, then a tab,
+// then what fzf shows of it and its description
+func formatFzf(candidates []candidate, quote string) []string {
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		val := escapePosix(c.Value, "", true)
+		if len(candidates) == 1 && !dontAddSpace {
+			val += " "
+		}
+		ret = append(ret, strings.Join([]string{val, c.display(), c.Description}, descriptionSeparator))
+	}
+
+	return ret
+}
+
+//doFzfSource prints key bindings for bash or zsh (or the shell in $SHELL if
+// neither is given) that pick the current word's completion with fzf
+func doFzfSource(args []string) {
+	shell := ""
+	if len(args) > 0 {
+		shell = args[0]
+	} else if loginShell := os.Getenv("SHELL"); loginShell != "" {
+		shell = loginShell[strings.LastIndex(loginShell, "/")+1:]
+	}
+
+	source, found := fzfSources[shell]
+	if !found {
+		fmt.Fprintf(os.Stderr, "Usage: bosh-complete fzf-source <bash|zsh>\n")
+		os.Exit(1)
+	}
+
+	tmpl := template.Must(template.New("fzf_source").Parse(source))
+	me, err := os.Executable()
+	debug := ""
+	if opts.Debug {
+		debug = "--debug"
+	}
+	if err != nil {
+		panic("Could not determine executable location")
+	}
+	err = tmpl.Execute(os.Stdout, struct {
+		Executable string
+		Debug      string
+		Picker     string
+		Key        string
+	}{
+		Executable: me,
+		Debug:      debug,
+		Picker:     fzfPicker,
+		Key:        fzfKeys[shell],
+	})
+	if err != nil {
+		panic("Could not render fzf source template for " + shell)
+	}
+}
@@ -3,14 +3,14 @@ package main
 func insertGlobalFlags() {
 	insertFlag(flag{Long: "version", Short: 'v'})
 	insertFlag(flag{Long: "config", Complete: compFiles})
-	insertFlag(flag{Long: "environment", Short: 'e', Complete: compEnvAliases})
+	insertFlag(flag{Long: "environment", Short: 'e', Complete: compEnvironments})
 	insertFlag(flag{Long: "ca-cert", Complete: compFiles})
 	insertFlag(flag{Long: "sha2"})
 	insertFlag(flag{Long: "parallel", Complete: compNoop})
 	insertFlag(flag{Long: "client", Complete: compNoop})
 	insertFlag(flag{Long: "client-secret", Complete: compNoop})
 	insertFlag(flag{Long: "deployment", Short: 'd', Complete: compDeployments})
-	insertFlag(flag{Long: "column", Complete: compNoop})
+	insertFlag(flag{Long: "column", Complete: compColumns, Repeatable: true, CommaSeparated: true})
 	insertFlag(flag{Long: "json"})
 	insertFlag(flag{Long: "tty"})
 	insertFlag(flag{Long: "no-color"})
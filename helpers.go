@@ -3,173 +3,492 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/thomasmitchell/bosh-complete/director"
 	yaml "gopkg.in/yaml.v2"
 )
 
-var boshClient *client
-
-type boshConfig struct {
-	Environments []boshEnvironment `yaml:"environments"`
+//The environment variables that change how a client gets made
+var clientEnvvars = []string{
+	"BOSH_ALL_PROXY",
+	"BOSH_ONE_TIME_PASSCODE",
+	"BOSH_COMPLETE_CLIENT_CERT",
+	"BOSH_COMPLETE_CLIENT_KEY",
+	"BOSH_COMPLETE_UAA_CA_CERT",
+	"BOSH_COMPLETE_UAA_SKIP_SSL_VALIDATION",
+	"BOSH_COMPLETE_SKIP_SSL_VALIDATION",
+	"BOSH_COMPLETE_UAA_CLIENT",
+	"BOSH_COMPLETE_UAA_CLIENT_SECRET",
+	"BOSH_COMPLETE_DIRECTOR_PORT",
 }
 
-type boshEnvironment struct {
-	URL          string `yaml:"url"`
-	CACert       string `yaml:"ca_cert"`
-	Alias        string `yaml:"alias"`
-	Username     string `yaml:"username"`
-	Password     string `yaml:"password"`
-	RefreshToken string `yaml:"refresh_token"`
+//clientKey identifies the client that getBoshClient would make for ctx
+func clientKey(ctx compContext) string {
+	parts := []string{}
+	for _, flag := range []string{"--environment", "--client", "--client-secret", "--ca-cert", "--config"} {
+		val, _ := ctx.FlagValue(flag)
+		parts = append(parts, val)
+	}
+	for _, envvar := range clientEnvvars {
+		parts = append(parts, os.Getenv(envvar))
+	}
+
+	return strings.Join(parts, "\x00")
 }
 
-func getBoshConfig(ctx compContext) (*boshConfig, error) {
-	location := fmt.Sprintf("%s/.bosh/config", os.Getenv("HOME"))
-	if cfg, found := ctx.Flags["--config"]; found {
-		location = cfg[0]
+//clientOptions is how clients cache, retry, and log, as configured
+func clientOptions() director.Options {
+	return director.Options{
+		Logger:               &log,
+		Observer:             stats,
+		Store:                diskStore{},
+		TTL:                  cacheTTLFor,
+		StaleWhileRevalidate: staleWhileRevalidate,
+		Revalidate:           queueRevalidation,
+		StaleOnError:         staleOnError,
+		Lock:                 lockFetch,
+		Offline:              offlineMode,
+		CacheSize:            maxCacheSize,
+		MaxResponseSize:      maxResponseSize,
+		Retries:              maxRetries,
 	}
+}
 
-	confFile, err := os.Open(location)
+//getBoshClient returns the pool's client for the environment in ctx, making
+// it if need be
+func getBoshClient(ctx compContext) (*director.Client, error) {
+	return boshClients.get(clientKey(ctx), func() (*director.Client, error) {
+		return newBoshClient(ctx)
+	})
+}
+
+//newBoshClient makes a client for the environment in ctx, with credentials
+// from wherever ctx says to get them
+func newBoshClient(ctx compContext) (*director.Client, error) {
+	ret, hasCredentials, err := configureBoshClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	ret := &boshConfig{}
+	if !hasCredentials {
+		return nil, fmt.Errorf("Environment `%s' is not in the bosh config, hasn't been logged in to with `bosh-complete login', and no client credentials were given", ret.URL)
+	}
+
+	//Who responses are cached as is worked out now, before any tokens get
+	// refreshed
+	ret.Identity()
 
-	err = yaml.NewDecoder(confFile).Decode(ret)
-	return ret, err
+	return ret, nil
 }
 
-func getBoshClient(ctx compContext) (*client, error) {
-	if boshClient != nil {
-		return boshClient, nil
+//configureBoshClient sets up a client for the environment in ctx, saying
+// whether there was anything to authenticate to it with. Logging in is the
+// one thing that can do without
+func configureBoshClient(ctx compContext) (*director.Client, bool, error) {
+	envName, found := ctx.FlagValue("--environment")
+	if !found {
+		return nil, false, fmt.Errorf("env not given")
+	}
+	cfg, err := getBoshConfig(ctx)
+	if err != nil {
+		return nil, false, err
 	}
 
-	var envs []string
-	var depFound bool
-	if envs, depFound = ctx.Flags["--environment"]; !depFound {
-		return nil, fmt.Errorf("env not given")
+	envAddr, env := cfg.resolveEnvironment(envName)
+	envAlias := ""
+	if env != nil {
+		envAlias = env.Alias
 	}
-	envName := envs[0]
-	cfg, err := getBoshConfig(ctx)
+	envCfg := getToolConfig().environment(envAlias, envAddr)
+
+	log.Write("making client for addr: %s (environment from %s)", envAddr, ctx.FlagSource("--environment"))
+
+	ret := director.NewClient(envAddr, clientOptions())
+
+	if env != nil {
+		ret.CACert = env.CACert
+		ret.Username = env.Username
+		ret.Password = env.Password
+		ret.RefreshToken = env.RefreshToken
+		//The bosh CLI only ever stores bearer tokens, but don't send anything
+		// that we wouldn't know how to present
+		if env.AccessTokenType == "" || strings.EqualFold(env.AccessTokenType, "bearer") {
+			ret.AccessToken = env.AccessToken
+		} else {
+			log.Write("Ignoring access token of unknown type `%s' from config", env.AccessTokenType)
+		}
+	}
+
+	//A login made with `bosh-complete login' is used over the bosh CLI's
+	login, err := getLogin(envAddr)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	if login != nil {
+		log.Write("credentials from bosh-complete login")
+		ret.Username, ret.Password = login.Username, login.Password
+		ret.ClientID, ret.ClientSecret = login.Client, login.ClientSecret
+		ret.AccessToken, ret.RefreshToken = login.AccessToken, login.RefreshToken
+		if ret.CACert == "" {
+			ret.CACert = login.CACert
+		}
+	}
+
+	//Flags override env vars (see parseContext), which override the config.
+	// Each is applied on its own, so that e.g. a freshly exported
+	// BOSH_CLIENT_SECRET can be used with the client name from the config
+	if client, found := ctx.FlagValue("--client"); found {
+		log.Write("client from %s", ctx.FlagSource("--client"))
+		ret.ClientID = client
+		//Tokens in the config belong to whoever logged in with the bosh CLI,
+		// which isn't necessarily this client
+		ret.AccessToken, ret.RefreshToken = "", ""
+	} else if ret.Username != "" {
+		log.Write("username from config")
+	}
+
+	if clientSecret, found := ctx.FlagValue("--client-secret"); found {
+		log.Write("client secret from %s", ctx.FlagSource("--client-secret"))
+		ret.ClientSecret = clientSecret
+	} else if ret.Password != "" {
+		log.Write("password from config")
+	}
+
+	//A secret given without a client goes along with the username from the
+	// config (e.g. a basic auth director's rotated password)
+	if ret.ClientID == "" && ret.ClientSecret != "" {
+		ret.Password, ret.ClientSecret = ret.ClientSecret, ""
+	}
+
+	if caCert, found := ctx.FlagValue("--ca-cert"); found {
+		log.Write("CA cert from %s", ctx.FlagSource("--ca-cert"))
+		ret.CACert, err = director.LoadCACert(caCert)
+		if err != nil {
+			return nil, false, err
+		}
+	} else if envCfg.CACert != "" {
+		log.Write("CA cert from tool config")
+		ret.CACert, err = director.LoadCACert(expandHome(envCfg.CACert))
+		if err != nil {
+			return nil, false, err
+		}
+	} else if env != nil && env.CACert != "" && ret.CACert == env.CACert {
+		//What bosh alias-env --ca-cert left, for this environment alone
+		log.Write("CA cert from config")
+		ret.CACert, err = director.LoadCACert(ret.CACert)
+		if err != nil {
+			return nil, false, fmt.Errorf("Bad ca_cert for environment `%s' in the bosh config: %s", envName, err)
+		}
+	} else if ret.CACert != "" {
+		log.Write("CA cert from bosh-complete login")
 	}
 
-	//I think bosh looks for the address in the alias, and then rescans for the
-	// first instance of that address
-	// So... first, we look for the alias
-	var env *boshEnvironment
-	for _, e := range cfg.Environments {
-		if e.Alias == envName {
-			env = &e
-			break
+	ret.AllProxy = envString("BOSH_ALL_PROXY", envCfg.Proxy)
+
+	clientCert, clientKey := os.Getenv("BOSH_COMPLETE_CLIENT_CERT"), os.Getenv("BOSH_COMPLETE_CLIENT_KEY")
+	if clientCert != "" || clientKey != "" {
+		log.Write("client certificate from $BOSH_COMPLETE_CLIENT_CERT")
+		ret.ClientCertificate, ret.ClientKey, err = director.LoadClientCert(clientCert, clientKey)
+		if err != nil {
+			return nil, false, err
 		}
 	}
 
-	envAddr := envName
-	if env != nil {
-		envAddr = env.URL
+	//For SSO directors, where there's no password to grant with. The tokens it's
+	// traded for get saved, so it only needs to be given once
+	if passcode := os.Getenv("BOSH_ONE_TIME_PASSCODE"); passcode != "" && ret.ClientID == "" {
+		log.Write("passcode from $BOSH_ONE_TIME_PASSCODE")
+		ret.Passcode = passcode
 	}
 
-	log.Write("making client for addr: %s", envAddr)
+	//Certificates are checked against the system's CAs, along with the CA cert
+	// if there is one. Not checking them at all has to be asked for
+	ret.SkipSSLValidation = envBool("BOSH_COMPLETE_SKIP_SSL_VALIDATION", envCfg.SkipSSLValidation)
+	if ret.SkipSSLValidation {
+		log.Write("Not checking the director's certificate")
+	}
 
-	ret := &client{
-		URL:               envAddr,
-		SkipSSLValidation: true,
-		cache:             map[string]string{},
+	//Like the bosh CLI, UAA's cert is validated the same way as the director's
+	// unless told otherwise
+	ret.UAACACert, ret.UAASkipSSLValidation = ret.CACert, ret.SkipSSLValidation
+	if uaaCACert := os.Getenv("BOSH_COMPLETE_UAA_CA_CERT"); uaaCACert != "" {
+		log.Write("UAA CA cert from $BOSH_COMPLETE_UAA_CA_CERT")
+		ret.UAACACert, err = director.LoadCACert(uaaCACert)
+		if err != nil {
+			return nil, false, err
+		}
+		ret.UAASkipSSLValidation = false
 	}
 
-	env = nil
-	for _, e := range cfg.Environments {
-		if e.URL == envAddr {
-			env = &e
-			break
+	if skip := os.Getenv("BOSH_COMPLETE_UAA_SKIP_SSL_VALIDATION"); skip != "" {
+		ret.UAASkipSSLValidation, err = strconv.ParseBool(skip)
+		if err != nil {
+			return nil, false, fmt.Errorf("Invalid value for BOSH_COMPLETE_UAA_SKIP_SSL_VALIDATION: `%s'", skip)
 		}
 	}
 
-	if env == nil {
-		return nil, fmt.Errorf("Could not get auth info for env: %s", envName)
+	//Grants made on behalf of a user go through the bosh CLI's UAA client,
+	// unless this UAA has its own for the purpose
+	ret.UAAClientID = "bosh_cli"
+	if envCfg.UAAClient != "" {
+		log.Write("UAA client from config")
+		ret.UAAClientID, ret.UAAClientSecret = envCfg.UAAClient, envCfg.UAAClientSecret
+	}
+	if uaaClient := os.Getenv("BOSH_COMPLETE_UAA_CLIENT"); uaaClient != "" {
+		log.Write("UAA client from $BOSH_COMPLETE_UAA_CLIENT")
+		ret.UAAClientID = uaaClient
+		ret.UAAClientSecret = os.Getenv("BOSH_COMPLETE_UAA_CLIENT_SECRET")
 	}
 
-	ret.Username = env.Username
-	ret.Password = env.Password
-	ret.RefreshToken = env.RefreshToken
+	ret.DefaultPort = envCfg.Port
+	if port := os.Getenv("BOSH_COMPLETE_DIRECTOR_PORT"); port != "" {
+		ret.DefaultPort, err = strconv.Atoi(port)
+		if err != nil || ret.DefaultPort <= 0 || ret.DefaultPort > 65535 {
+			return nil, false, fmt.Errorf("Invalid value for BOSH_COMPLETE_DIRECTOR_PORT: `%s'", port)
+		}
+	}
 
-	//--client and --client-secret flags override config
-	if client, found := ctx.Flags["--client"]; found {
-		ret.Username = client[0]
+	//New tokens go back wherever the old ones came from
+	if login != nil && ret.ClientID == "" {
+		ret.SaveTokens = func(accessToken, refreshToken string) error {
+			return saveLoginTokens(envAddr, accessToken, refreshToken)
+		}
+	} else if env != nil && ret.ClientID == "" {
+		envURL := env.URL
+		ret.SaveTokens = func(accessToken, refreshToken string) error {
+			return cfg.saveTokens(envURL, accessToken, refreshToken)
+		}
 	}
 
-	if clientSecret, found := ctx.Flags["--client-secret"]; found {
-		ret.Password = clientSecret[0]
+	return ret, env != nil || login != nil || ret.ClientID != "", nil
+}
+
+//getDirector returns what completers ask about what's on the director, which
+// is the director itself or the bosh CLI, depending on the backend
+func getDirector(ctx compContext) (director.Director, error) {
+	switch directorBackend() {
+	case "cli":
+		return getCLIDirector(ctx)
+	case "bosh-cli":
+		return newBoshCLIDirector(ctx)
+	case "auto":
+		c, err := getBoshClient(ctx)
+		cli, cliErr := getCLIDirector(ctx)
+		if cliErr != nil {
+			log.Write("%s", cliErr)
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		}
+		if err != nil {
+			//e.g. an environment that only the CLI knows how to auth to
+			log.Write("Asking the bosh CLI instead: %s", err)
+			return cli, nil
+		}
+		return getFallbackDirector(ctx, c, cli), nil
+	}
+
+	c, err := getBoshClient(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	boshClient = ret
+	return c, nil
+}
+
+//supports returns whether the director has the given feature. If there's no
+// telling, it's assumed to, and whatever needs the feature can fail on its
+// own
+func supports(c director.Director, ctx compContext, feature director.Feature) bool {
+	info, err := c.Info(ctx.Context)
+	if err != nil {
+		return true
+	}
 
-	return boshClient, nil
+	if !info.Supports(feature) {
+		log.Write("Director version %s doesn't have %s (new in %s)", info.Version, feature.Name, feature.MinVersion)
+		return false
+	}
+	return true
 }
 
-type boshInstance struct {
-	AgentID   string `json:"agent_id"`
-	CID       string `json:"cid"`
-	Job       string `json:"job"`
-	Index     int    `json:"index"`
-	ID        string `json:"id"`
-	ExpectsVM bool   `json:"expects_vm"`
+//ctxDeployment is the deployment that completion is for, which endpoints
+// under a deployment can't do without
+func ctxDeployment(ctx compContext) (string, error) {
+	deployment, depGiven := ctx.FlagValue("--deployment")
+	if !depGiven {
+		return "", fmt.Errorf("No deployment given")
+	}
+
+	return deployment, nil
 }
 
-func fetchInstances(c *client, ctx compContext) ([]boshInstance, error) {
-	var deployments []string
-	var depGiven bool
-	if deployments, depGiven = ctx.Flags["--deployment"]; !depGiven {
-		return nil, fmt.Errorf("No deployment given")
+func epInstances(ctx compContext) (string, error) {
+	deployment, err := ctxDeployment(ctx)
+	if err != nil {
+		return "", err
 	}
 
-	ret := []boshInstance{}
+	return director.InstancesPath(deployment), nil
+}
 
-	err := c.Get(fmt.Sprintf("/deployments/%s/instances", deployments[0]), &ret)
+func fetchInstances(c director.Director, ctx compContext) ([]director.Instance, error) {
+	deployment, err := ctxDeployment(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return ret, nil
+	return c.Instances(ctx.Context, deployment)
 }
 
-type boshRelease struct {
-	Name     string `json:"name"`
-	Versions []struct {
-		Version           string `json:"version"`
-		CurrentlyDeployed bool   `json:"currently_deployed"`
-	} `json:"release_versions"`
+func fetchInstanceDetails(c director.Director, ctx compContext) ([]director.InstanceDetails, error) {
+	deployment, err := ctxDeployment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.InstanceDetails(ctx.Context, deployment)
 }
 
-func fetchReleases(c *client) ([]boshRelease, error) {
-	var releases []boshRelease
-	err := c.Get(fmt.Sprintf("/releases"), &releases)
+func fetchOrphanedDisks(c director.Director, ctx compContext) ([]director.OrphanedDisk, error) {
+	return c.OrphanedDisks(ctx.Context)
+}
+
+func fetchProblems(c director.Director, ctx compContext) ([]director.Problem, error) {
+	deployment, err := ctxDeployment(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return releases, nil
+	return c.Problems(ctx.Context, deployment)
 }
 
-type boshStemcell struct {
-	Name        string `json:"name"`
-	Version     string `json:"version"`
-	Deployments []struct {
-		Name string `json:"name"`
-	} `json:"deployments"`
+func fetchSnapshots(c director.Director, ctx compContext) ([]director.Snapshot, error) {
+	deployment, err := ctxDeployment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Snapshots(ctx.Context, deployment)
+}
+
+//fetchVariables returns the deployment's variables, or none on directors too
+// old to say
+func fetchVariables(c director.Director, ctx compContext) ([]director.Variable, error) {
+	deployment, err := ctxDeployment(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !supports(c, ctx, director.FeatureVariables) {
+		return []director.Variable{}, nil
+	}
+
+	return c.Variables(ctx.Context, deployment)
 }
 
-func fetchStemcells(c *client) ([]boshStemcell, error) {
-	var stemcells []boshStemcell
-	err := c.Get(fmt.Sprintf("/stemcells"), &stemcells)
+func fetchErrands(c director.Director, ctx compContext) ([]director.Errand, error) {
+	deployment, err := ctxDeployment(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return stemcells, nil
+	return c.Errands(ctx.Context, deployment)
+}
+
+//fetchConfigs returns the current configs, limited to the type if one is
+// given
+func fetchConfigs(c director.Director, ctx compContext) ([]director.Config, error) {
+	configType, _ := ctx.FlagValue("--type")
+	return c.Configs(ctx.Context, configType, true)
+}
+
+//fetchConfigHistory returns every revision of the configs, limited to the
+// type if one is given
+func fetchConfigHistory(c director.Director, ctx compContext) ([]director.Config, error) {
+	configType, _ := ctx.FlagValue("--type")
+	return c.Configs(ctx.Context, configType, false)
+}
+
+//The parts of a cloud config that manifests refer to by name
+type cloudConfig struct {
+	AZs          []cloudConfigItem `yaml:"azs"`
+	VMTypes      []cloudConfigItem `yaml:"vm_types"`
+	Networks     []cloudConfigItem `yaml:"networks"`
+	VMExtensions []cloudConfigItem `yaml:"vm_extensions"`
+}
+
+type cloudConfigItem struct {
+	Name string `yaml:"name"`
+}
+
+//fetchCloudConfig returns the current cloud configs, all rolled into one the
+// way the director does when deploying
+func fetchCloudConfig(c director.Director, ctx compContext) (cloudConfig, error) {
+	ret := cloudConfig{}
+	configs, err := c.Configs(ctx.Context, "cloud", true)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, config := range configs {
+		this := cloudConfig{}
+		err = yaml.Unmarshal([]byte(config.Content), &this)
+		if err != nil {
+			log.Write("Could not parse cloud config `%s': %s", config.Name, err)
+			continue
+		}
+
+		ret.AZs = append(ret.AZs, this.AZs...)
+		ret.VMTypes = append(ret.VMTypes, this.VMTypes...)
+		ret.Networks = append(ret.Networks, this.Networks...)
+		ret.VMExtensions = append(ret.VMExtensions, this.VMExtensions...)
+	}
+
+	return ret, nil
+}
+
+//How many of the most recent tasks to consider. Long-lived directors have
+// tens of thousands of them, and nobody is completing the old ones
+const defaultTaskLimit = 100
+
+//taskFilter asks for the recent tasks, limited to the deployment if one is
+// given
+func taskFilter(ctx compContext) director.TaskFilter {
+	deployment, _ := ctx.FlagValue("--deployment")
+	return director.TaskFilter{Deployment: deployment, Limit: defaultTaskLimit}
+}
+
+func fetchTasks(c director.Director, ctx compContext) ([]director.Task, error) {
+	return c.Tasks(ctx.Context, taskFilter(ctx))
+}
+
+//fetchUnfinishedTasks asks for the tasks that are still going, however long
+// ago they were started
+func fetchUnfinishedTasks(c director.Director, ctx compContext) ([]director.Task, error) {
+	filter := taskFilter(ctx)
+	filter.States = []string{"queued", "processing", "cancelling"}
+	return c.Tasks(ctx.Context, filter)
+}
+
+//fetchEvents returns the most recent page of events, limited to the
+// deployment if one is given. Directors without an event log have none
+func fetchEvents(c director.Director, ctx compContext) ([]director.Event, error) {
+	if !supports(c, ctx, director.FeatureEvents) {
+		return []director.Event{}, nil
+	}
+	deployment, _ := ctx.FlagValue("--deployment")
+	return c.Events(ctx.Context, deployment, "")
+}
+
+func fetchReleases(c director.Director, ctx compContext) ([]director.Release, error) {
+	return c.Releases(ctx.Context)
+}
+
+func fetchStemcells(c director.Director, ctx compContext) ([]director.Stemcell, error) {
+	return c.Stemcells(ctx.Context)
 }
 
 type filepath struct {
@@ -207,7 +526,7 @@ func (f filepath) SearchString() string {
 
 	if len(f.parts) > 0 && f.parts[0] == "~" {
 		f.parts = f.parts[1:]
-		homeFilepath := parseFilepath(os.Getenv("HOME"))
+		homeFilepath := parseFilepath(homeDir())
 		f.parts = append(homeFilepath.parts, f.parts...)
 		f.absolute = true
 	}
@@ -239,7 +558,27 @@ func (f filepath) OriginalString() string {
 	return prefix + strings.Join(f.parts, "/") + suffix
 }
 
-func (f filepath) GetContents(acceptFiles bool) ([]filepath, error) {
+//fileFilter says whether the file at the given path should be offered.
+// Directories are always offered, so that paths can be walked down
+type fileFilter func(path string) bool
+
+func anyFile(string) bool {
+	return true
+}
+
+//yamlFile only accepts YAML files, like ops files
+func yamlFile(path string) bool {
+	return strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".yaml")
+}
+
+//tarball only accepts gzipped tarballs, like releases and stemcells
+func tarball(path string) bool {
+	return strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz")
+}
+
+//GetContents returns the directories under f, and the files that accept
+// lets through. If accept is nil, no files are returned
+func (f filepath) GetContents(accept fileFilter) ([]filepath, error) {
 	file, err := os.Open(f.SearchString())
 	if err != nil {
 		return nil, err
@@ -268,22 +607,26 @@ func (f filepath) GetContents(acceptFiles bool) ([]filepath, error) {
 			dir = symlinkInfo.IsDir()
 		}
 
-		if !acceptFiles && !dir {
-			continue
-		}
-
 		theseParts := make([]string, len(f.parts))
 		copy(theseParts, f.parts)
-		ret = append(ret, filepath{
+		this := filepath{
 			parts:    append(theseParts, info.Name()),
 			absolute: f.absolute,
 			dir:      dir,
-		})
+		}
+
+		if !dir && (accept == nil || !accept(this.SearchString())) {
+			continue
+		}
+
+		ret = append(ret, this)
 	}
 	return ret, nil
 }
 
-func walkDirs(cur string, acceptFile bool) ([]string, error) {
+//walkDirs offers what's in the directory that cur is in (or is) that starts
+// with the rest of cur, shown by name alone like the shell shows files
+func walkDirs(cur string, accept fileFilter) ([]candidate, error) {
 	//We'll re-enable the space kickout when it is correct for filepath semantics
 	dontAddSpace = true
 	//don't filter it later on. Filter it in this function
@@ -300,7 +643,7 @@ func walkDirs(cur string, acceptFile bool) ([]string, error) {
 	}
 
 	log.Write("SEARCH PATH: %+v", searchPath.SearchString())
-	contents, err := searchPath.GetContents(acceptFile)
+	contents, err := searchPath.GetContents(accept)
 	if err != nil {
 		return nil, err
 	}
@@ -321,7 +664,7 @@ func walkDirs(cur string, acceptFile bool) ([]string, error) {
 	contents = append(contents, filepath{parts: dotDotPath, dir: true, absolute: path.absolute})
 
 	for _, content := range contents {
-		if !acceptFile && !content.dir {
+		if !content.dir && accept == nil {
 			continue
 		}
 
@@ -341,7 +684,7 @@ func walkDirs(cur string, acceptFile bool) ([]string, error) {
 
 	if path.dir && len(candidates) == 0 {
 		dontAddSpace = false
-		return []string{cur}, nil
+		return []candidate{{Value: cur, Kind: dirKind}}, nil
 	}
 
 	//Check if we should kick out a space
@@ -349,7 +692,7 @@ func walkDirs(cur string, acceptFile bool) ([]string, error) {
 		if !candidates[0].dir {
 			dontAddSpace = false
 		} else {
-			nextContents, err := candidates[0].GetContents(acceptFile)
+			nextContents, err := candidates[0].GetContents(accept)
 			if err == nil && len(nextContents) == 0 { //Yes, should be == nil
 				dontAddSpace = false
 			} else if err != nil {
@@ -358,9 +701,14 @@ func walkDirs(cur string, acceptFile bool) ([]string, error) {
 		}
 	}
 
-	ret := []string{}
-	for _, candidate := range candidates {
-		ret = append(ret, candidate.OriginalString())
+	ret := []candidate{}
+	for _, path := range candidates {
+		c := candidate{Value: path.OriginalString(), Display: path.parts[len(path.parts)-1]}
+		if path.dir {
+			c.Display += "/"
+			c.Kind = dirKind
+		}
+		ret = append(ret, c)
 	}
 
 	return ret, nil
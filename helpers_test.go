@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//isolate points everything that bosh-complete reads or writes at a fresh
+// directory, and clears anything in the environment that would change how it
+// behaves, so that tests only see what they set up themselves. It returns
+// the directory, which stands in for $HOME
+func isolate(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	for _, envvar := range []string{
+		"BOSH_ENVIRONMENT", "BOSH_DEPLOYMENT", "BOSH_CLIENT", "BOSH_CLIENT_SECRET",
+		"BOSH_CA_CERT", "BOSH_CONFIG", "BOSH_ALL_PROXY", "BOSH_ONE_TIME_PASSCODE",
+		"BOSH_COMPLETE_CONFIG", "BOSH_COMPLETE_CONFIG_DIR", "BOSH_COMPLETE_CACHE_DIR",
+		"BOSH_COMPLETE_CLIENT_CERT", "BOSH_COMPLETE_CLIENT_KEY",
+		"BOSH_COMPLETE_UAA_CA_CERT", "BOSH_COMPLETE_UAA_SKIP_SSL_VALIDATION",
+		"BOSH_COMPLETE_SKIP_SSL_VALIDATION",
+		"BOSH_COMPLETE_UAA_CLIENT", "BOSH_COMPLETE_UAA_CLIENT_SECRET",
+		"BOSH_COMPLETE_DIRECTOR_PORT", "BOSH_COMPLETE_DAEMON",
+		"XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_STATE_HOME",
+		"COMP_LINE", "COMP_POINT",
+	} {
+		//Setting it first has it put back afterwards
+		t.Setenv(envvar, "")
+		_ = os.Unsetenv(envvar)
+	}
+	t.Setenv("BOSH_COMPLETE_CLI_HELP", "false")
+	t.Setenv("BOSH_COMPLETE_KEYCHAIN", "false")
+	resetToolConfig(t)
+	return home
+}
+
+//resetToolConfig makes the tool config be read again, now and once the test
+// is done with whatever it set up
+func resetToolConfig(t *testing.T) {
+	forget := func() {
+		toolCfg, toolCfgOnce = nil, sync.Once{}
+		cacheTTLs, cacheTTLsOnce = nil, sync.Once{}
+	}
+	forget()
+	t.Cleanup(forget)
+}
+
+//writeFile writes contents to name under dir, returning where it went
+func writeFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	location := fmt.Sprintf("%s/%s", dir, name)
+	err := ioutil.WriteFile(location, []byte(contents), 0600)
+	if err != nil {
+		t.Fatalf("Could not write %s: %s", location, err)
+	}
+	return location
+}
+
+//testCACert makes a self-signed CA cert, returned PEM encoded
+func testCACert(t *testing.T, name string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not make a key: %s", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not make a cert: %s", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+//indent indents each line of s, for putting a PEM into a YAML block scalar
+func indent(s, prefix string) string {
+	return prefix + strings.Replace(strings.TrimRight(s, "\n"), "\n", "\n"+prefix, -1)
+}
+
+func TestConfigureBoshClientPrecedence(t *testing.T) {
+	caConfig := testCACert(t, "config")
+	caTool := testCACert(t, "tool config")
+	caEnv := testCACert(t, "env")
+	caFlag := testCACert(t, "flag")
+	caNames := map[string]string{caConfig: "config", caTool: "tool config", caEnv: "env", caFlag: "flag", "": "none"}
+
+	boshConfig := fmt.Sprintf(`environments:
+- url: https://10.0.0.1:25555
+  alias: prod
+  username: admin
+  password: config-password
+  ca_cert: |
+%s
+- url: https://10.0.0.2:25555
+  alias: staging
+  username: staging-admin
+  password: staging-password
+`, indent(caConfig, "    "))
+
+	type want struct {
+		URL          string
+		Username     string
+		Password     string
+		ClientID     string
+		ClientSecret string
+		CACert       string
+	}
+	prod := want{URL: "https://10.0.0.1:25555", Username: "admin", Password: "config-password", CACert: "config"}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		//Whether the tool config gives prod its own CA cert
+		toolCA bool
+		want   want
+		err    string
+	}{
+		//Environment
+		{name: "environment from the flag", args: []string{"-e", "prod"}, want: prod},
+		{
+			name: "environment from $BOSH_ENVIRONMENT",
+			env:  map[string]string{"BOSH_ENVIRONMENT": "staging"},
+			want: want{URL: "https://10.0.0.2:25555", Username: "staging-admin", Password: "staging-password", CACert: "none"},
+		},
+		{
+			name: "environment flag over $BOSH_ENVIRONMENT",
+			args: []string{"--environment=prod"},
+			env:  map[string]string{"BOSH_ENVIRONMENT": "staging"},
+			want: prod,
+		},
+		{
+			name: "environment by URL finds the config's credentials",
+			env:  map[string]string{"BOSH_ENVIRONMENT": "https://10.0.0.1:25555"},
+			want: prod,
+		},
+		{name: "no environment", err: "env not given"},
+		{
+			name: "environment not in the config and no credentials",
+			args: []string{"-e", "https://10.0.0.3:25555"},
+			err:  "is not in the bosh config",
+		},
+
+		//Client
+		{
+			name: "client from $BOSH_CLIENT over the config's user",
+			args: []string{"-e", "prod"},
+			env:  map[string]string{"BOSH_CLIENT": "env-client", "BOSH_CLIENT_SECRET": "env-secret"},
+			want: want{URL: prod.URL, Username: "admin", Password: "config-password", ClientID: "env-client", ClientSecret: "env-secret", CACert: "config"},
+		},
+		{
+			name: "client flag over $BOSH_CLIENT",
+			args: []string{"-e", "prod", "--client", "flag-client"},
+			env:  map[string]string{"BOSH_CLIENT": "env-client", "BOSH_CLIENT_SECRET": "env-secret"},
+			want: want{URL: prod.URL, Username: "admin", Password: "config-password", ClientID: "flag-client", ClientSecret: "env-secret", CACert: "config"},
+		},
+		{
+			name: "client with no config entry",
+			args: []string{"-e", "https://10.0.0.3:25555"},
+			env:  map[string]string{"BOSH_CLIENT": "env-client", "BOSH_CLIENT_SECRET": "env-secret"},
+			want: want{URL: "https://10.0.0.3:25555", ClientID: "env-client", ClientSecret: "env-secret", CACert: "none"},
+		},
+
+		//Client secret
+		{
+			name: "client secret flag over $BOSH_CLIENT_SECRET",
+			args: []string{"-e", "prod", "--client-secret=flag-secret"},
+			env:  map[string]string{"BOSH_CLIENT": "env-client", "BOSH_CLIENT_SECRET": "env-secret"},
+			want: want{URL: prod.URL, Username: "admin", Password: "config-password", ClientID: "env-client", ClientSecret: "flag-secret", CACert: "config"},
+		},
+		{
+			name: "client secret without a client is the config user's password",
+			args: []string{"-e", "prod"},
+			env:  map[string]string{"BOSH_CLIENT_SECRET": "env-secret"},
+			want: want{URL: prod.URL, Username: "admin", Password: "env-secret", CACert: "config"},
+		},
+
+		//CA cert
+		{name: "CA cert from the bosh config", args: []string{"-e", "prod"}, want: prod},
+		{
+			name:   "CA cert from the tool config over the bosh config",
+			args:   []string{"-e", "prod"},
+			toolCA: true,
+			want:   want{URL: prod.URL, Username: "admin", Password: "config-password", CACert: "tool config"},
+		},
+		{
+			name:   "CA cert from $BOSH_CA_CERT over the tool config",
+			args:   []string{"-e", "prod"},
+			env:    map[string]string{"BOSH_CA_CERT": caEnv},
+			toolCA: true,
+			want:   want{URL: prod.URL, Username: "admin", Password: "config-password", CACert: "env"},
+		},
+		{
+			name:   "CA cert flag over $BOSH_CA_CERT",
+			args:   []string{"-e", "prod", "--ca-cert", "FLAG_CA"},
+			env:    map[string]string{"BOSH_CA_CERT": caEnv},
+			toolCA: true,
+			want:   want{URL: prod.URL, Username: "admin", Password: "config-password", CACert: "flag"},
+		},
+		{
+			name: "bad CA cert flag",
+			args: []string{"-e", "prod", "--ca-cert", "not a cert"},
+			err:  "CA cert",
+		},
+	}
+
+	insertGlobalFlags()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := isolate(t)
+			t.Setenv("BOSH_CONFIG", writeFile(t, home, "bosh-config", boshConfig))
+			t.Setenv("BOSH_COMPLETE_CONFIG_DIR", home)
+			if test.toolCA {
+				writeFile(t, home, "config.yml", fmt.Sprintf("environments:\n  prod:\n    ca_cert: %s\n",
+					writeFile(t, home, "tool-ca.pem", caTool)))
+			}
+			for envvar, val := range test.env {
+				t.Setenv(envvar, val)
+			}
+
+			args := []string{"bosh"}
+			for _, arg := range test.args {
+				if arg == "FLAG_CA" {
+					arg = writeFile(t, home, "flag-ca.pem", caFlag)
+				}
+				args = append(args, arg)
+			}
+			ctx, ok := parseContext(append(args, "deployments", ""))
+			if !ok {
+				t.Fatalf("Could not parse %q", args)
+			}
+
+			c, err := newBoshClient(ctx)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("Expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			got := want{
+				URL:          c.URL,
+				Username:     c.Username,
+				Password:     c.Password,
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+				CACert:       caNames[c.CACert],
+			}
+			if c.CACert != "" && got.CACert == "" {
+				got.CACert = "something else"
+			}
+			if got != test.want {
+				t.Errorf("got  %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfigureBoshClientTLS(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		//The tool config for prod
+		toolConfig  string
+		wantSkip    bool
+		wantUAASkip bool
+	}{
+		{name: "checked by default"},
+		{name: "skipped by $BOSH_COMPLETE_SKIP_SSL_VALIDATION", env: map[string]string{"BOSH_COMPLETE_SKIP_SSL_VALIDATION": "true"}, wantSkip: true, wantUAASkip: true},
+		{name: "skipped by the tool config", toolConfig: "skip_ssl_validation: true", wantSkip: true, wantUAASkip: true},
+		{
+			name:       "$BOSH_COMPLETE_SKIP_SSL_VALIDATION over the tool config",
+			env:        map[string]string{"BOSH_COMPLETE_SKIP_SSL_VALIDATION": "false"},
+			toolConfig: "skip_ssl_validation: true",
+		},
+		{name: "only UAA skipped", env: map[string]string{"BOSH_COMPLETE_UAA_SKIP_SSL_VALIDATION": "true"}, wantUAASkip: true},
+	}
+
+	insertGlobalFlags()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := isolate(t)
+			t.Setenv("BOSH_CONFIG", writeFile(t, home, "bosh-config",
+				"environments:\n- url: https://10.0.0.1:25555\n  alias: prod\n  username: admin\n  password: admin-password\n"))
+			t.Setenv("BOSH_COMPLETE_CONFIG_DIR", home)
+			if test.toolConfig != "" {
+				writeFile(t, home, "config.yml", fmt.Sprintf("environments:\n  prod:\n    %s\n", test.toolConfig))
+			}
+			for envvar, val := range test.env {
+				t.Setenv(envvar, val)
+			}
+
+			ctx, ok := parseContext([]string{"bosh", "-e", "prod", "deployments", ""})
+			if !ok {
+				t.Fatalf("Could not parse the command line")
+			}
+			c, err := newBoshClient(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if c.SkipSSLValidation != test.wantSkip || c.UAASkipSSLValidation != test.wantUAASkip {
+				t.Errorf("Got skipping %t (UAA %t), want %t (UAA %t)",
+					c.SkipSSLValidation, c.UAASkipSSLValidation, test.wantSkip, test.wantUAASkip)
+			}
+		})
+	}
+}
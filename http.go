@@ -0,0 +1,58 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	//How long a whole completion gets, across every request that it makes
+	defaultCompletionTimeout = 15 * time.Second
+	//How long the shell is kept waiting on the director before a completion
+	// settles for what's cached
+	defaultCompletionBudget = 500 * time.Millisecond
+)
+
+//completionTimeout is the deadline for everything that a single completion
+// does. It can be set with $BOSH_COMPLETE_TIMEOUT (e.g. "5s"), or timeout in
+// the tool config
+func completionTimeout() time.Duration {
+	val := envString("BOSH_COMPLETE_TIMEOUT", getToolConfig().Timeout)
+	if val == "" {
+		return defaultCompletionTimeout
+	}
+
+	ret, err := time.ParseDuration(val)
+	if err != nil || ret <= 0 {
+		log.Write("Ignoring invalid completion timeout: `%s'", val)
+		return defaultCompletionTimeout
+	}
+
+	return ret
+}
+
+//completionBudget is how long a completion may wait on the director before
+// making do with what's cached, leaving the rest to be fetched in the
+// background for next time. It can be set with $BOSH_COMPLETE_BUDGET (e.g.
+// "1s"), or budget in the tool config. Zero means waiting as long as the
+// completion timeout allows
+func completionBudget() time.Duration {
+	val := envString("BOSH_COMPLETE_BUDGET", getToolConfig().Budget)
+	if val == "" {
+		return defaultCompletionBudget
+	}
+
+	ret, err := time.ParseDuration(val)
+	if err != nil || ret < 0 {
+		log.Write("Ignoring invalid completion budget: `%s'", val)
+		return defaultCompletionBudget
+	}
+
+	return ret
+}
+
+//offlineMode returns whether completion has to make do with what's already
+// cached, never going to the network. It's turned on with offline: true in the
+// tool config or BOSH_COMPLETE_OFFLINE=true
+func offlineMode() bool {
+	return envBool("BOSH_COMPLETE_OFFLINE", getToolConfig().Offline)
+}
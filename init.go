@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+//What `init' prints for each shell
+var shellSources = map[string]func(){
+	"bash":       doBashSource,
+	"zsh":        doZshSource,
+	"fish":       doFishSource,
+	"powershell": doPowershellSource,
+	"pwsh":       doPowershellSource,
+}
+
+//doInit prints the completion hook for the given shell, or for the one in
+// $SHELL if none is given
+func doInit(args []string) {
+	shell := ""
+	if len(args) > 0 {
+		shell = args[0]
+	} else if loginShell := os.Getenv("SHELL"); loginShell != "" {
+		shell = loginShell[strings.LastIndex(loginShell, "/")+1:]
+	}
+
+	source, found := shellSources[shell]
+	if !found {
+		shells := make([]string, 0, len(shellSources))
+		for name := range shellSources {
+			shells = append(shells, name)
+		}
+		sort.Strings(shells)
+		fmt.Fprintf(os.Stderr, "Usage: bosh-complete init <%s>\n", strings.Join(shells, "|"))
+		os.Exit(1)
+	}
+
+	source()
+}
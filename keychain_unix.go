@@ -0,0 +1,121 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+//What security exits with when there's no such item (errSecItemNotFound)
+const securityNotFoundStatus = 44
+
+//keychainNotFound returns whether a keychain tool that failed did so only
+// because there was nothing kept for the account. Anything else (a locked
+// keychain, no secret service running, a tool that isn't there) is a real
+// failure, which mustn't be taken for there being nothing to find
+func keychainNotFound(err error, stdout, stderr []byte) bool {
+	exitErr, exited := err.(*exec.ExitError)
+	if !exited {
+		return false
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return exitErr.ExitCode() == securityNotFoundStatus
+	case "linux":
+		//secret-tool says nothing at all when there's no match, and exits 1 for
+		// everything else too
+		return exitErr.ExitCode() == 1 && len(bytes.TrimSpace(stdout)) == 0 && len(bytes.TrimSpace(stderr)) == 0
+	}
+	return false
+}
+
+//keychainError describes a keychain tool failing, with whatever it said about
+// it
+func keychainError(doing string, err error, stderr []byte) error {
+	if msg := strings.TrimSpace(string(stderr)); msg != "" {
+		return fmt.Errorf("Could not %s the keychain: %s (%s)", doing, err, msg)
+	}
+	return fmt.Errorf("Could not %s the keychain: %s", doing, err)
+}
+
+//keychainGet looks up the secret kept for account in the OS keychain (the
+// login keychain on macOS, or the secret service on Linux), saying whether
+// there was one
+func keychainGet(account string) (string, bool, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "account", account)
+	default:
+		return "", false, fmt.Errorf("No keychain support on %s", runtime.GOOS)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	if err != nil && keychainNotFound(err, stdout.Bytes(), stderr.Bytes()) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, keychainError("read from", err, stderr.Bytes())
+	}
+
+	secret := strings.TrimRight(stdout.String(), "\n")
+	return secret, secret != "", nil
+}
+
+//keychainSet keeps secret for account in the OS keychain, over whatever was
+// there before
+func keychainSet(account, secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		//The secret can't go on the command line, where anybody can see it in
+		// ps. Given -w last and without a value, security reads it from stdin
+		// instead, and then again to confirm it
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", keychainService, "-a", account, "-w")
+		cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=bosh-complete "+account,
+			"service", keychainService, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return fmt.Errorf("No keychain support on %s", runtime.GOOS)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return keychainError("store in", err, out)
+	}
+	return nil
+}
+
+//keychainDelete throws away whatever is kept for account in the OS keychain
+func keychainDelete(account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", account)
+	case "linux":
+		cmd = exec.Command("secret-tool", "clear", "service", keychainService, "account", account)
+	default:
+		return fmt.Errorf("No keychain support on %s", runtime.GOOS)
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	//Nothing being there to delete is as good as deleting it
+	if err != nil && !keychainNotFound(err, stdout.Bytes(), stderr.Bytes()) {
+		return keychainError("delete from", err, stderr.Bytes())
+	}
+	return nil
+}
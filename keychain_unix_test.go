@@ -0,0 +1,164 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//fakeKeychainScript stands in for security or secret-tool. It keeps the
+// arguments and stdin of each run in $FAKE_KEYCHAIN_DIR, and says and exits
+// with whatever it's told to
+const fakeKeychainScript = `#!/bin/sh
+echo "$@" >> "$FAKE_KEYCHAIN_DIR/args"
+cat >> "$FAKE_KEYCHAIN_DIR/stdin"
+printf '%s' "$FAKE_KEYCHAIN_STDOUT"
+printf '%s' "$FAKE_KEYCHAIN_STDERR" >&2
+exit "${FAKE_KEYCHAIN_EXIT:-0}"
+`
+
+//fakeKeychain puts a fake keychain tool for this OS first on $PATH, returning
+// the directory that it records what it was given in
+func fakeKeychain(t *testing.T) string {
+	t.Helper()
+	tool := map[string]string{"darwin": "security", "linux": "secret-tool"}[runtime.GOOS]
+	if tool == "" {
+		t.Skipf("No keychain support on %s", runtime.GOOS)
+	}
+
+	dir := t.TempDir()
+	err := os.Mkdir(dir+"/bin", 0700)
+	if err != nil {
+		t.Fatalf("Could not make bin dir: %s", err)
+	}
+	err = ioutil.WriteFile(dir+"/bin/"+tool, []byte(fakeKeychainScript), 0700)
+	if err != nil {
+		t.Fatalf("Could not write fake %s: %s", tool, err)
+	}
+
+	t.Setenv("PATH", dir+"/bin:"+os.Getenv("PATH"))
+	t.Setenv("FAKE_KEYCHAIN_DIR", dir)
+	return dir
+}
+
+//fakeKeychainRecord returns what the fake keychain tool was given as name
+// (args or stdin), over every time it ran
+func fakeKeychainRecord(t *testing.T, dir, name string) string {
+	t.Helper()
+	contents, err := ioutil.ReadFile(dir + "/" + name)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Could not read %s: %s", name, err)
+	}
+	return string(contents)
+}
+
+func TestKeychainGet(t *testing.T) {
+	//How each tool says that there's nothing there, and that the keychain is
+	// locked
+	notFound, locked, lockedMsg := 1, 1, "secret-tool: Cannot get secret of a locked object"
+	if runtime.GOOS == "darwin" {
+		notFound, locked, lockedMsg = securityNotFoundStatus, 36, "security: SecKeychainSearchCopyNext: User interaction is not allowed."
+	}
+
+	tests := []struct {
+		name   string
+		exit   int
+		stdout string
+		stderr string
+		want   string
+		found  bool
+		err    bool
+	}{
+		{name: "found", stdout: "s3cret\n", want: "s3cret", found: true},
+		{name: "not found", exit: notFound},
+		{name: "locked", exit: locked, stderr: lockedMsg, err: true},
+		{name: "no secret service", exit: 1, stderr: "secret-tool: Cannot autolaunch D-Bus without X11 $DISPLAY", err: true},
+		{name: "crashed", exit: 2, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fakeKeychain(t)
+			t.Setenv("FAKE_KEYCHAIN_EXIT", strconv.Itoa(test.exit))
+			t.Setenv("FAKE_KEYCHAIN_STDOUT", test.stdout)
+			t.Setenv("FAKE_KEYCHAIN_STDERR", test.stderr)
+
+			got, found, err := keychainGet("cache")
+			if test.err {
+				if err == nil {
+					t.Errorf("Expected an error, got %q (found: %t)", got, found)
+				} else if test.stderr != "" && !strings.Contains(err.Error(), test.stderr) {
+					t.Errorf("Expected the error to say %q, got %q", test.stderr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if got != test.want || found != test.found {
+				t.Errorf("Got %q (found: %t), want %q (found: %t)", got, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+func TestKeychainGetWithoutTheTool(t *testing.T) {
+	fakeKeychain(t)
+	t.Setenv("PATH", t.TempDir())
+
+	if _, _, err := keychainGet("cache"); err == nil {
+		t.Errorf("Expected an error without a keychain tool")
+	}
+}
+
+func TestKeychainSetKeepsTheSecretOffTheCommandLine(t *testing.T) {
+	dir := fakeKeychain(t)
+
+	err := keychainSet("cache", "hunter2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if args := fakeKeychainRecord(t, dir, "args"); strings.Contains(args, "hunter2") {
+		t.Errorf("The secret is in the arguments: %s", args)
+	}
+	if stdin := fakeKeychainRecord(t, dir, "stdin"); !strings.Contains(stdin, "hunter2") {
+		t.Errorf("Expected the secret on stdin, got %q", stdin)
+	}
+}
+
+//A keychain that can't be read right now still has the cache key in it, which
+// a new one mustn't replace
+func TestKeychainSecretDoesNotReplaceKeyItCannotRead(t *testing.T) {
+	dir := fakeKeychain(t)
+	t.Setenv("FAKE_KEYCHAIN_EXIT", "36")
+	t.Setenv("FAKE_KEYCHAIN_STDERR", "User interaction is not allowed.")
+
+	if _, err := keychainSecret(); err == nil {
+		t.Errorf("Expected an error from a keychain that can't be read")
+	}
+	if args := fakeKeychainRecord(t, dir, "args"); strings.Count(args, "\n") != 1 {
+		t.Errorf("Expected only the one lookup, got:\n%s", args)
+	}
+}
+
+func TestKeychainSecretMakesKeyWhenThereIsNone(t *testing.T) {
+	dir := fakeKeychain(t)
+	notFound := "1"
+	if runtime.GOOS == "darwin" {
+		notFound = strconv.Itoa(securityNotFoundStatus)
+	}
+	t.Setenv("FAKE_KEYCHAIN_EXIT", notFound)
+
+	//The fake fails the store the same way, but it's the asking that counts
+	_, _ = keychainSecret()
+	if args := fakeKeychainRecord(t, dir, "args"); strings.Count(args, "\n") != 2 {
+		t.Errorf("Expected a lookup and then a store, got:\n%s", args)
+	}
+}
@@ -0,0 +1,117 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+//The keychain on Windows is the Credential Manager, which is only got at
+// through advapi32
+var (
+	advapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW   = advapi32.NewProc("CredReadW")
+	procCredWriteW  = advapi32.NewProc("CredWriteW")
+	procCredDeleteW = advapi32.NewProc("CredDeleteW")
+	procCredFree    = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+//credential is a CREDENTIALW
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+//keychainTarget is what the Credential Manager calls the credential for
+// account
+func keychainTarget(account string) (*uint16, error) {
+	return syscall.UTF16PtrFromString(keychainService + ":" + account)
+}
+
+//keychainGet looks up the secret kept for account in the Credential Manager,
+// saying whether there was one
+func keychainGet(account string) (string, bool, error) {
+	target, err := keychainTarget(account)
+	if err != nil {
+		return "", false, err
+	}
+
+	var cred *credential
+	ok, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 {
+		if err == errorNotFound {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("Could not read from the Credential Manager: %s", err)
+	}
+	defer func() { _, _, _ = procCredFree.Call(uintptr(unsafe.Pointer(cred))) }()
+
+	if cred.CredentialBlobSize == 0 {
+		return "", false, nil
+	}
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), true, nil
+}
+
+//keychainSet keeps secret for account in the Credential Manager, over
+// whatever was there before
+func keychainSet(account, secret string) error {
+	target, err := keychainTarget(account)
+	if err != nil {
+		return err
+	}
+	userName, err := syscall.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+
+	cred := credential{
+		Type:       credTypeGeneric,
+		TargetName: target,
+		Persist:    credPersistLocalMachine,
+		UserName:   userName,
+	}
+	if secret != "" {
+		blob := []byte(secret)
+		cred.CredentialBlob, cred.CredentialBlobSize = &blob[0], uint32(len(blob))
+	}
+
+	ok, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ok == 0 {
+		return fmt.Errorf("Could not store in the Credential Manager: %s", err)
+	}
+	return nil
+}
+
+//keychainDelete throws away whatever is kept for account in the Credential
+// Manager
+func keychainDelete(account string) error {
+	target, err := keychainTarget(account)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if ok == 0 && err != errorNotFound {
+		return fmt.Errorf("Could not delete from the Credential Manager: %s", err)
+	}
+	return nil
+}
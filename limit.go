@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+//The most of a director response that will be read, unless told otherwise
+const defaultMaxResponseSize = 32 * 1024 * 1024
+
+//maxResponseSize is the limit on the size of a director response. It can be
+// set with $BOSH_COMPLETE_MAX_RESPONSE_SIZE, in bytes or with a K, M, or G
+// suffix
+func maxResponseSize() int64 {
+	val := os.Getenv("BOSH_COMPLETE_MAX_RESPONSE_SIZE")
+	if val == "" {
+		return defaultMaxResponseSize
+	}
+
+	ret, err := parseSize(val)
+	if err != nil || ret <= 0 {
+		log.Write("Ignoring invalid value for BOSH_COMPLETE_MAX_RESPONSE_SIZE: `%s'", val)
+		return defaultMaxResponseSize
+	}
+
+	return ret
+}
+
+//parseSize parses a number of bytes like "512", "64K", or "32MB"
+func parseSize(val string) (int64, error) {
+	val = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(val)), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(val, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(val, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(val, "G"):
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier != 1 {
+		val = val[:len(val)-1]
+	}
+
+	ret, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return ret * multiplier, nil
+}
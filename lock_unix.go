@@ -0,0 +1,67 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+//lockFile takes an exclusive lock on the file at the given location, making
+// it if need be, and returns a func that releases the lock
+func lockFile(location string) (func(), error) {
+	f, err := os.OpenFile(location, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
+
+//How often a lock that somebody else holds is tried again
+const lockPollInterval = 20 * time.Millisecond
+
+//lockFileWithin is lockFile, except that it gives up once it has waited for
+// the given time. It also says whether it had to wait on somebody else
+func lockFileWithin(location string, wait time.Duration) (func(), bool, error) {
+	f, err := os.OpenFile(location, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, false, err
+	}
+
+	deadline := time.Now().Add(wait)
+	waited := false
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err == syscall.EWOULDBLOCK && time.Now().After(deadline) {
+			err = fmt.Errorf("still locked after %s", wait)
+		}
+		if err != syscall.EWOULDBLOCK {
+			_ = f.Close()
+			return nil, waited, err
+		}
+
+		waited = true
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, waited, nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"time"
+)
+
+//lockFile is a no-op on Windows, where we don't have flock
+func lockFile(location string) (func(), error) {
+	return func() {}, nil
+}
+
+//lockFileWithin is a no-op on Windows too, so nobody ever waits
+func lockFileWithin(location string, wait time.Duration) (func(), bool, error) {
+	return func() {}, false, nil
+}
@@ -3,39 +3,170 @@ package main
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 )
 
 var log logger
 
+type logLevel int
+
+const (
+	logOff logLevel = iota
+	//Only what went wrong
+	logError
+	//What completion is up to
+	logDebug
+	//Everything, including whole requests to and responses from directors
+	logTrace
+)
+
+var logLevels = map[string]logLevel{
+	"off":   logOff,
+	"error": logError,
+	"debug": logDebug,
+	"trace": logTrace,
+}
+
+//The log gets moved aside to <path>.1 when it grows past this
+const defaultMaxLogSize = 10 * 1024 * 1024
+
 type logger struct {
-	on bool
-	f  *os.File
+	level   logLevel
+	path    string
+	maxSize int64
+	lock    sync.Mutex
+	f       *os.File
+	size    int64
 }
 
-func (l *logger) TurnOn() {
-	var err error
+//TurnOn starts logging. The level is taken from $BOSH_COMPLETE_LOG_LEVEL (off,
+// error, debug, or trace) or log_level in the tool config, or is debug if
+// neither is set and debug is true. The log goes to $BOSH_COMPLETE_LOG_FILE
+// (or log_file), and is kept under $BOSH_COMPLETE_LOG_MAX_SIZE
+func (l *logger) TurnOn(debug bool) {
+	//Nothing is logged while the config is read, as logging isn't on yet
+	cfg := getToolConfig()
+
+	l.level = logOff
+	if debug {
+		l.level = logDebug
+	}
+	if val := envString("BOSH_COMPLETE_LOG_LEVEL", cfg.LogLevel); val != "" {
+		if level, found := logLevels[strings.ToLower(val)]; found {
+			l.level = level
+		}
+	}
+	if l.level == logOff {
+		return
+	}
 
-	if _, err := os.Stat("/tmp/bosh_complete"); err != nil {
-		if !os.IsNotExist(err) {
-			panic("Could not stat log dir: " + err.Error())
+	l.path = expandHome(envString("BOSH_COMPLETE_LOG_FILE", cfg.LogFile))
+	if l.path == "" {
+		l.path = fmt.Sprintf("%s/log.txt", logDir())
+	}
+	l.maxSize = defaultMaxLogSize
+	if val := os.Getenv("BOSH_COMPLETE_LOG_MAX_SIZE"); val != "" {
+		if size, err := parseSize(val); err == nil && size > 0 {
+			l.maxSize = size
 		}
-		err = os.Mkdir("/tmp/bosh_complete", 0775)
+	}
+
+	//Nowhere to write means no logging, rather than completion breaking
+	if err := l.open(); err != nil {
+		l.level = logOff
+	}
+}
+
+func (l *logger) open() error {
+	if dir := l.path[:strings.LastIndex(l.path, "/")+1]; dir != "" {
+		err := os.MkdirAll(dir, 0775)
 		if err != nil {
-			panic("Could not make log dir: " + err.Error())
+			return err
 		}
 	}
 
-	l.f, err = os.OpenFile("/tmp/bosh_complete/log.txt", os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
 	if err != nil {
-		panic("Could not open logging file" + err.Error())
+		return err
 	}
+	l.f = f
 
-	l.on = true
+	l.size = 0
+	if info, err := f.Stat(); err == nil {
+		l.size = info.Size()
+	}
+	return nil
 }
 
-func (l logger) Write(f string, args ...interface{}) {
-	if !l.on {
+//rotate moves the full log aside, replacing whatever was moved aside before
+func (l *logger) rotate() {
+	_ = l.f.Close()
+	_ = os.Rename(l.path, l.path+".1")
+	if err := l.open(); err != nil {
+		l.level = logOff
+	}
+}
+
+//On returns whether anything is being logged by Write, so that callers can
+// skip building up messages that are going nowhere
+func (l *logger) On() bool {
+	return l.level >= logDebug
+}
+
+//Tracing returns whether whole requests and responses should be logged
+func (l *logger) Tracing() bool {
+	return l.level >= logTrace
+}
+
+//Error logs something that went wrong
+func (l *logger) Error(f string, args ...interface{}) {
+	l.write(logError, f, args...)
+}
+
+//Write logs what completion is up to
+func (l *logger) Write(f string, args ...interface{}) {
+	l.write(logDebug, f, args...)
+}
+
+func (l *logger) write(level logLevel, f string, args ...interface{}) {
+	if l.level < level {
 		return
 	}
-	_, _ = l.f.Write([]byte(fmt.Sprintf("%s\n", fmt.Sprintf(f, args...))))
+
+	line := redact(fmt.Sprintf(f, args...)) + "\n"
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.size+int64(len(line)) > l.maxSize {
+		l.rotate()
+		if l.level < level {
+			return
+		}
+	}
+	n, _ := l.f.Write([]byte(line))
+	l.size += int64(n)
+}
+
+//Credentials that never make it into the log, whatever the level
+var redactions = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)(authorization:\s*\w+\s+)\S+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|password|passcode|client_secret|secret)"\s*:\s*")[^"]*`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)\b((?:access_token|refresh_token|password|passcode|client_secret|bosh_client_secret)=)[^&\s]+`), "${1}[REDACTED]"},
+	//The values of flags like --client-secret, whether given as --flag=value or
+	// as the next word, in however the words are quoted and joined in the log
+	{regexp.MustCompile(`(?i)(--(?:client-secret|password|passcode)(?:=` + logQuote + `?|` + logQuote + `?(?:,\s*|\s+and\s+|\s+)` + logQuote + `?))[^\s'"` + "`" + `]+`), "${1}[REDACTED]"},
+}
+
+//What words can be quoted with in the log
+const logQuote = `['"` + "`" + `]`
+
+func redact(s string) string {
+	for _, r := range redactions {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"authorization header", "Authorization: Bearer abc.def.ghi", "Authorization: Bearer [REDACTED]"},
+		{"JSON token", `{"access_token":"abc","token_type":"bearer"}`, `{"access_token":"[REDACTED]","token_type":"bearer"}`},
+		{"form secret", "grant_type=client_credentials&client_secret=hunter2&x=y", "grant_type=client_credentials&client_secret=[REDACTED]&x=y"},
+		{"form password", "username=admin&password=hunter2", "username=admin&password=[REDACTED]"},
+		{"env assignment", "BOSH_CLIENT_SECRET=hunter2 bosh deploy", "BOSH_CLIENT_SECRET=[REDACTED] bosh deploy"},
+
+		{"flag with =", "running bosh --client=ci --client-secret=hunter2 --json deployments",
+			"running bosh --client=ci --client-secret=[REDACTED] --json deployments"},
+		{"flag then a word", "Listing remote directory with: bosh --client-secret hunter2 -d cf ssh",
+			"Listing remote directory with: bosh --client-secret [REDACTED] -d cf ssh"},
+		{"password flag with =", "running bosh --password=hunter2 log-in", "running bosh --password=[REDACTED] log-in"},
+		{"password flag then a word", "running bosh --password hunter2 log-in", "running bosh --password [REDACTED] log-in"},
+		{"passcode flag", "running bosh log-in --passcode=123456", "running bosh log-in --passcode=[REDACTED]"},
+		{"flag in upper case", "bosh --CLIENT-SECRET=hunter2", "bosh --CLIENT-SECRET=[REDACTED]"},
+		{"quoted flag with =", "bosh --client-secret='hunter2'", "bosh --client-secret='[REDACTED]'"},
+
+		{"shell's args", "Bosh args: ['bosh', '--client-secret', 'hunter2', 'deployments', '']",
+			"Bosh args: ['bosh', '--client-secret', '[REDACTED]', 'deployments', '']"},
+		{"shell's args with =", "Bosh args: ['bosh', '--client-secret=hunter2', '']",
+			"Bosh args: ['bosh', '--client-secret=[REDACTED]', '']"},
+		{"COMP_LINE args", "Using args from COMP_LINE: [`bosh', `--client-secret', `hunter2', `']",
+			"Using args from COMP_LINE: [`bosh', `--client-secret', `[REDACTED]', `']"},
+		{"split args", "Split `--client-secret=hunter2' into parts `--client-secret' and `hunter2'",
+			"Split `--client-secret=[REDACTED]' into parts `--client-secret' and `[REDACTED]'"},
+		{"trailing flag", "Using --client-secret `hunter2' from after the cursor",
+			"Using --client-secret `[REDACTED]' from after the cursor"},
+		{"double quoted", `bosh --client-secret "hunter2"`, `bosh --client-secret "[REDACTED]"`},
+
+		{"flag with no value yet", "Bosh args: ['bosh', '--client-secret', '']", "Bosh args: ['bosh', '--client-secret', '']"},
+		{"other flags", "running bosh --client ci -d cf --json instances", "running bosh --client ci -d cf --json instances"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := redact(test.line); got != test.want {
+				t.Errorf("redact(%q)\n got %q\nwant %q", test.line, got, test.want)
+			}
+		})
+	}
+}
+
+//Completions log the command line in several shapes as they go, none of which
+// should give the secret away
+func TestCompletionLogHasNoSecrets(t *testing.T) {
+	const secret = "hunter2-s3cret"
+	lines := []struct {
+		name     string
+		args     []string
+		compLine string
+	}{
+		{"flag with =", []string{"bosh", "--client-secret=" + secret, "-d", ""}, ""},
+		{"flag then a word", []string{"bosh", "--client-secret", secret, "-d", ""}, ""},
+		{"from COMP_LINE", nil, "bosh --client-secret " + secret + " -d "},
+		{"from COMP_LINE with =", nil, "bosh --client-secret=" + secret + " -d "},
+		{"after the cursor", nil, "bosh -d  --client ci --client-secret " + secret},
+	}
+
+	for _, line := range lines {
+		t.Run(line.name, func(t *testing.T) {
+			home := isolate(t)
+			t.Setenv("BOSH_COMPLETE_LOG_LEVEL", "trace")
+			t.Setenv("BOSH_COMPLETE_LOG_FILE", home+"/log.txt")
+			if line.compLine != "" {
+				t.Setenv("COMP_LINE", line.compLine)
+				point := len(line.compLine)
+				if strings.Contains(line.compLine, "-d  ") {
+					point = strings.Index(line.compLine, "-d  ") + 3
+				}
+				t.Setenv("COMP_POINT", strconv.Itoa(point))
+			}
+			log = logger{}
+			log.TurnOn(false)
+			defer func() {
+				if log.f != nil {
+					_ = log.f.Close()
+				}
+				log = logger{}
+			}()
+
+			resetCompletionState()
+			runCompletion(line.args)
+
+			contents, err := ioutil.ReadFile(home + "/log.txt")
+			if err != nil {
+				t.Fatalf("Could not read the log: %s", err)
+			}
+			if len(contents) == 0 {
+				t.Fatalf("Nothing was logged")
+			}
+			if strings.Contains(string(contents), secret) {
+				t.Errorf("The secret is in the log:\n%s", contents)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+//doLogin logs in to the given environment (or $BOSH_ENVIRONMENT) and keeps
+// what it gets in bosh-complete's own store, for completions to use instead
+// of whatever is in the bosh CLI's config. It asks for whatever it needs that
+// it wasn't given: a client secret with --client, a one time passcode with
+// --sso (for directors whose UAA is fronted by SSO, where there's no password
+// to do a grant with), or else a username and password.
+func doLogin(args []string) {
+	ctx := compContext{
+		Context: context.Background(),
+		Flags:   map[string][]string{},
+		FromEnv: map[string]string{},
+	}
+	if len(args) > 0 {
+		ctx.Flags["--environment"] = []string{args[0]}
+	}
+	if opts.Login.Client != "" {
+		ctx.Flags["--client"] = []string{opts.Login.Client}
+	}
+	if opts.Login.CACert != "" {
+		ctx.Flags["--ca-cert"] = []string{opts.Login.CACert}
+	}
+	ctx.insertEnvvars()
+
+	c, _, err := configureBoshClient(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	info, err := c.Info(ctx.Context)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not reach director `%s': %s\n", c.URL, err)
+		os.Exit(1)
+	}
+
+	//Whatever was there before is what we're replacing
+	c.AccessToken, c.RefreshToken = "", ""
+	c.SaveTokens = nil
+
+	passcode := opts.Login.Passcode
+	if passcode == "" {
+		passcode = os.Getenv("BOSH_ONE_TIME_PASSCODE")
+	}
+
+	switch {
+	case c.ClientID != "":
+		if c.ClientSecret == "" {
+			c.ClientSecret = mustPrompt("Client secret", true)
+		}
+	case passcode != "" || opts.Login.SSO:
+		if info.Auth.Type == "basic" {
+			fmt.Printf("`%s' uses basic auth. Passcodes aren't needed\n", c.URL)
+			return
+		}
+		if passcode == "" {
+			fmt.Fprintf(os.Stderr, "Get a one time passcode from %s/passcode\n", strings.TrimRight(info.Auth.Options.URL, "/"))
+			passcode = mustPrompt("One time passcode", true)
+		}
+		c.Username, c.Password = "", ""
+		c.Passcode = passcode
+	default:
+		c.Username = opts.Login.Username
+		if c.Username == "" {
+			c.Username = mustPrompt("Username", false)
+		}
+		c.Password = mustPrompt("Password", true)
+	}
+
+	err = c.Authenticate(ctx.Context)
+	if err == nil {
+		//Basic auth doesn't get checked until something is asked for
+		err = c.Refetch(ctx.Context, director.DeploymentsPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not log in: %s\n", err)
+		os.Exit(1)
+	}
+
+	login := storedLogin{
+		URL:          c.URL,
+		CACert:       c.CACert,
+		Client:       c.ClientID,
+		ClientSecret: c.ClientSecret,
+		AccessToken:  c.CurrentAccessToken(),
+		RefreshToken: c.RefreshToken,
+	}
+	if c.IsBasic() && c.ClientID == "" {
+		login.Username, login.Password = c.Username, c.Password
+	}
+
+	err = saveLogin(login)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not save login: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Logged in to `%s'\n", c.URL)
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+//prompt asks on stderr for something, and reads the answer from stdin.
+// Secrets aren't echoed back when stdin is a terminal
+func prompt(question string, secret bool) (string, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", question)
+
+	if fd := int(os.Stdin.Fd()); secret && terminal.IsTerminal(fd) {
+		answer, err := terminal.ReadPassword(fd)
+		fmt.Fprintf(os.Stderr, "\n")
+		return string(answer), err
+	}
+
+	answer, err := stdin.ReadString('\n')
+	if err == io.EOF && answer != "" {
+		err = nil
+	}
+	return strings.TrimRight(answer, "\r\n"), err
+}
+
+func mustPrompt(question string, secret bool) string {
+	answer, err := prompt(question, secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read %s: %s\n", strings.ToLower(question), err)
+		os.Exit(1)
+	}
+	if answer == "" {
+		fmt.Fprintf(os.Stderr, "No %s given\n", strings.ToLower(question))
+		os.Exit(1)
+	}
+	return answer
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//loginStore is where `bosh-complete login' keeps what it got, apart from the
+// bosh CLI's config
+type loginStore struct {
+	Logins []storedLogin `yaml:"logins"`
+}
+
+//storedLogin is how to authenticate to one director
+type storedLogin struct {
+	URL    string `yaml:"url"`
+	CACert string `yaml:"ca_cert,omitempty"`
+	//Directors that do basic auth have no tokens, so it's the password that
+	// has to be kept
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	//Client credentials tokens can't be refreshed, so the client is kept to
+	// grant new ones with
+	Client       string `yaml:"client,omitempty"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	AccessToken  string `yaml:"access_token,omitempty"`
+	RefreshToken string `yaml:"refresh_token,omitempty"`
+	//Whether the password, secret, and tokens are in the OS keychain instead
+	InKeychain bool `yaml:"in_keychain,omitempty"`
+}
+
+//loginSecrets is what of a login goes in the keychain
+type loginSecrets struct {
+	Password     string `json:"password,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+//keychainLogins returns whether logins keep their secrets in the OS keychain.
+// They do unless told not to with keychain: false in the tool config or
+// BOSH_COMPLETE_KEYCHAIN=false, e.g. on headless machines without one
+func keychainLogins() bool {
+	return envBool("BOSH_COMPLETE_KEYCHAIN", orDefault(getToolConfig().Keychain, true))
+}
+
+func (l *storedLogin) keychainAccount() string {
+	return "login:" + l.URL
+}
+
+//fetchSecrets fills in the login's secrets from the keychain, if that's where
+// they are
+func (l *storedLogin) fetchSecrets() error {
+	if !l.InKeychain {
+		return nil
+	}
+
+	contents, found, err := keychainGet(l.keychainAccount())
+	if err != nil {
+		return err
+	}
+	if !found {
+		log.Write("No secrets in the keychain for the login to `%s'", l.URL)
+		return nil
+	}
+
+	secrets := loginSecrets{}
+	err = json.Unmarshal([]byte(contents), &secrets)
+	if err != nil {
+		return fmt.Errorf("Could not parse the keychain's secrets for `%s': %s", l.URL, err)
+	}
+
+	l.Password, l.ClientSecret = secrets.Password, secrets.ClientSecret
+	l.AccessToken, l.RefreshToken = secrets.AccessToken, secrets.RefreshToken
+	return nil
+}
+
+//stashSecrets moves the login's secrets into the keychain, unless that's
+// turned off, in which case they're taken back out of it
+func (l *storedLogin) stashSecrets() error {
+	if !keychainLogins() {
+		if l.InKeychain {
+			l.InKeychain = false
+			return keychainDelete(l.keychainAccount())
+		}
+		return nil
+	}
+
+	contents, err := json.Marshal(loginSecrets{
+		Password:     l.Password,
+		ClientSecret: l.ClientSecret,
+		AccessToken:  l.AccessToken,
+		RefreshToken: l.RefreshToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = keychainSet(l.keychainAccount(), string(contents))
+	if err != nil {
+		return fmt.Errorf("%s. Set BOSH_COMPLETE_KEYCHAIN=false (or keychain: false in the tool config) to keep logins in a file instead", err)
+	}
+
+	l.Password, l.ClientSecret, l.AccessToken, l.RefreshToken = "", "", "", ""
+	l.InKeychain = true
+	return nil
+}
+
+func loginStorePath() string {
+	return fmt.Sprintf("%s/logins.yml", configDir())
+}
+
+func loadLogins() (*loginStore, error) {
+	ret := &loginStore{}
+	contents, err := ioutil.ReadFile(loginStorePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ret, nil
+		}
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(contents, ret)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse logins `%s': %s", loginStorePath(), err)
+	}
+
+	return ret, nil
+}
+
+//getLogin returns the stored login for the director at the given URL, or nil
+// if it hasn't been logged in to
+func getLogin(url string) (*storedLogin, error) {
+	store, err := loadLogins()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range store.Logins {
+		if store.Logins[i].URL == url {
+			return &store.Logins[i], store.Logins[i].fetchSecrets()
+		}
+	}
+
+	return nil, nil
+}
+
+//updateLogins calls fn with the stored logins, which changes them as it
+// likes and says whether it did. If it did, they're written back out. The
+// store is locked throughout. Secrets aren't fetched from the keychain for
+// fn, so any login it changes the secrets of has to fetch (and stash) them
+// itself
+func updateLogins(fn func(*loginStore) (bool, error)) error {
+	err := ensureDir(configDir())
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockFile(loginStorePath() + ".lock")
+	if err != nil {
+		return fmt.Errorf("Could not lock logins: %s", err)
+	}
+	defer unlock()
+
+	store, err := loadLogins()
+	if err != nil {
+		return err
+	}
+
+	changed, err := fn(store)
+	if err != nil || !changed {
+		return err
+	}
+
+	out, err := yaml.Marshal(store)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(loginStorePath(), out)
+}
+
+//saveLogin stores the login, over whatever there was for its director
+func saveLogin(login storedLogin) error {
+	return updateLogins(func(store *loginStore) (bool, error) {
+		//Where the secrets were before is where they're taken back out of, if
+		// need be
+		for i := range store.Logins {
+			if store.Logins[i].URL == login.URL {
+				login.InKeychain = store.Logins[i].InKeychain
+				err := login.stashSecrets()
+				store.Logins[i] = login
+				return true, err
+			}
+		}
+
+		err := login.stashSecrets()
+		store.Logins = append(store.Logins, login)
+		return true, err
+	})
+}
+
+//saveLoginTokens keeps the tokens from a new UAA grant with the login for the
+// director at the given URL
+func saveLoginTokens(url, accessToken, refreshToken string) error {
+	return updateLogins(func(store *loginStore) (bool, error) {
+		for i := range store.Logins {
+			if store.Logins[i].URL != url {
+				continue
+			}
+
+			login := &store.Logins[i]
+			err := login.fetchSecrets()
+			if err != nil {
+				return false, err
+			}
+			login.AccessToken, login.RefreshToken = accessToken, refreshToken
+			return true, login.stashSecrets()
+		}
+
+		log.Write("Not saving tokens: `%s' has no login", url)
+		return false, nil
+	})
+}
+
+//clearLogins forgets the login for the director at the given URL, or every
+// login if url is empty, returning how many were forgotten
+func clearLogins(url string) (int, error) {
+	cleared := 0
+	err := updateLogins(func(store *loginStore) (bool, error) {
+		kept := []storedLogin{}
+		for _, login := range store.Logins {
+			if url != "" && login.URL != url {
+				kept = append(kept, login)
+				continue
+			}
+
+			if login.InKeychain {
+				err := keychainDelete(login.keychainAccount())
+				if err != nil {
+					return false, err
+				}
+			}
+		}
+
+		cleared = len(store.Logins) - len(kept)
+		store.Logins = kept
+		return cleared > 0, nil
+	})
+
+	return cleared, err
+}
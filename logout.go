@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+//doLogout throws away the tokens kept for the given environment (by alias or
+// URL), or for every environment if none is given, so that the next
+// completion has to authenticate from scratch. That's whatever
+// `bosh-complete login' kept, and the tokens in the bosh CLI config, so this
+// logs the bosh CLI out of those environments as well.
+func doLogout(args []string) {
+	location := os.Getenv("BOSH_CONFIG")
+	if location == "" {
+		location = defaultBoshConfigPath()
+	}
+
+	cfg, err := loadBoshConfig(location)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	envName := ""
+	if len(args) > 0 {
+		envName = args[0]
+	}
+
+	//With nothing in the bosh config, there may not even be one to clear
+	cleared := 0
+	if len(cfg.Environments) > 0 {
+		cleared, err = cfg.clearTokens(envName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not clear tokens: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	envAddr := ""
+	if envName != "" {
+		envAddr, _ = cfg.resolveEnvironment(envName)
+	}
+	forgotten, err := clearLogins(envAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not clear logins: %s\n", err)
+		os.Exit(1)
+	}
+	cleared += forgotten
+
+	if envName != "" && cleared == 0 {
+		fmt.Printf("No stored tokens for environment `%s'\n", envName)
+		return
+	}
+
+	fmt.Printf("Cleared stored tokens for %d environment(s)\n", cleared)
+}
@@ -11,11 +11,50 @@ import (
 var opts options
 
 type options struct {
-	Debug      bool     `cli:"-d, --debug"`
-	Complete   struct{} `cli:"complete"`
-	BashSource struct{} `cli:"bash-source"`
-	ZshSource  struct{} `cli:"zsh-source"`
-	Version    struct{} `cli:"version"`
+	Debug            bool     `cli:"-d, --debug"`
+	ShowVersion      bool     `cli:"--version"`
+	Filter           string   `cli:"--filter"`
+	Shell            string   `cli:"--shell"`
+	Complete         struct{} `cli:"complete"`
+	Init             struct{} `cli:"init"`
+	BashSource       struct{} `cli:"bash-source"`
+	ZshSource        struct{} `cli:"zsh-source"`
+	FishSource       struct{} `cli:"fish-source"`
+	FzfSource        struct{} `cli:"fzf-source"`
+	PowershellSource struct{} `cli:"powershell-source"`
+	Version          struct{} `cli:"version"`
+	Logout           struct{} `cli:"logout"`
+	Login            struct {
+		Username string `cli:"-u, --username"`
+		Client   string `cli:"--client"`
+		CACert   string `cli:"--ca-cert"`
+		SSO      bool   `cli:"--sso"`
+		Passcode string `cli:"--passcode"`
+	} `cli:"login"`
+	FlushCache struct {
+		Environment string `cli:"-e, --environment"`
+		Path        string `cli:"--path"`
+	} `cli:"flush-cache"`
+	Cache struct {
+		Ls struct {
+			Environment string `cli:"-e, --environment"`
+		} `cli:"ls"`
+		Show struct {
+			Environment string `cli:"-e, --environment"`
+		} `cli:"show"`
+	} `cli:"cache"`
+	Daemon  struct{} `cli:"daemon"`
+	Prewarm struct {
+		All bool `cli:"-a, --all"`
+	} `cli:"prewarm"`
+	Doctor     struct{} `cli:"doctor"`
+	SelfUpdate struct {
+		Force bool `cli:"-f, --force"`
+	} `cli:"self-update"`
+	//Run in the background by completions that served stale responses
+	Revalidate struct {
+		Path []string `cli:"--path"`
+	} `cli:"revalidate"`
 }
 
 func main() {
@@ -27,27 +66,72 @@ func main() {
 	if os.Getenv("BOSH_COMPLETE_DEBUG") != "" {
 		opts.Debug = true
 	}
-	if opts.Debug {
-		log.TurnOn()
-	}
+	log.TurnOn(opts.Debug)
 
 	log.Write("")
 
+	if opts.Shell == "" {
+		opts.Shell = "bash"
+	}
+
+	if opts.Filter == "" {
+		opts.Filter = os.Getenv("BOSH_COMPLETE_FILTER")
+	}
+
+	if opts.ShowVersion {
+		doVersion()
+		return
+	}
+
 	switch command {
 	case "complete":
 		doComplete(args)
+	case "init":
+		doInit(args)
 	case "bash-source":
 		doBashSource()
 	case "zsh-source":
 		//For my weird friends Nic and Long
 		doZshSource()
+	case "fish-source":
+		doFishSource()
+	case "fzf-source":
+		doFzfSource(args)
+	case "powershell-source":
+		doPowershellSource()
 	case "version":
 		doVersion()
+	case "logout":
+		doLogout(args)
+	case "login":
+		doLogin(args)
+	case "flush-cache":
+		doFlushCache()
+	case "cache ls":
+		doCacheLs()
+	case "cache show":
+		doCacheShow(args)
+	case "cache":
+		fmt.Fprintf(os.Stderr, "Usage: bosh-complete cache ls|show\n")
+		os.Exit(1)
+	case "daemon":
+		doDaemon()
+	case "prewarm":
+		doPrewarm(args, opts.Prewarm.All)
+	case "doctor":
+		doDoctor(args)
+	case "self-update":
+		doSelfUpdate(opts.SelfUpdate.Force)
+	case "revalidate":
+		doRevalidate(opts.Revalidate.Path, args)
 	default:
 		panic("Unknown command: " + command)
 	}
 }
 
 func doVersion() {
-	fmt.Println(version.Version)
+	fmt.Printf("bosh-complete %s\n", version.Version)
+	fmt.Printf("commit: %s\n", version.Commit)
+	fmt.Printf("built: %s\n", version.BuildDate)
+	fmt.Printf("bosh CLI: %s - %s\n", version.MinBoshCLIVersion, version.MaxBoshCLIVersion)
 }
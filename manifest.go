@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Keys at the top of a file that make it look like a BOSH manifest
+var manifestKeyRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^name:`),
+	regexp.MustCompile(`(?m)^releases:`),
+}
+
+//looksLikeManifest returns whether the file at path has all the top-level
+// keys that a BOSH manifest would
+func looksLikeManifest(path string) bool {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	for _, re := range manifestKeyRegexes {
+		if !re.Match(contents) {
+			return false
+		}
+	}
+	return true
+}
+
+//Matches the ((placeholders)) that get filled in with variables
+var placeholderRegex = regexp.MustCompile(`\(\(\s*!?([^()\s]+)\s*\)\)`)
+
+//manifestVarNames returns the variables that a manifest (or ops file) uses,
+// from its variables section and its placeholders. Placeholders like
+// ((cert.ca)) use the cert variable
+func manifestVarNames(path string) []string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Write("Could not read `%s' for variables: %s", path, err)
+		return nil
+	}
+
+	ret := []string{}
+	for _, match := range placeholderRegex.FindAllSubmatch(contents, -1) {
+		name := strings.SplitN(string(match[1]), ".", 2)[0]
+		//Absolute names live in the config server and can't be given with -v
+		if !strings.HasPrefix(name, "/") {
+			ret = append(ret, name)
+		}
+	}
+
+	manifest := struct {
+		Variables []struct {
+			Name string `yaml:"name"`
+		} `yaml:"variables"`
+	}{}
+	if yaml.Unmarshal(contents, &manifest) == nil {
+		for _, variable := range manifest.Variables {
+			ret = append(ret, variable.Name)
+		}
+	}
+
+	return ret
+}
+
+//varsFileNames returns the variables that a vars file sets
+func varsFileNames(path string) []string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	vars := map[string]interface{}{}
+	if yaml.Unmarshal(contents, &vars) != nil {
+		return nil
+	}
+
+	ret := make([]string, 0, len(vars))
+	for name := range vars {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+//unresolvedVars returns the variables used by the manifest given as the first
+// argument and its ops files that nothing else on the command line sets yet.
+// It returns false if there's no manifest to go by
+func unresolvedVars(ctx compContext) ([]string, bool) {
+	if len(ctx.Args) == 0 {
+		return nil, false
+	}
+
+	used := map[string]bool{}
+	for _, path := range append([]string{ctx.Args[0]}, ctx.Flags["--ops-file"]...) {
+		for _, name := range manifestVarNames(path) {
+			used[name] = true
+		}
+	}
+
+	for _, flag := range []string{"--var", "--var-file"} {
+		for _, val := range ctx.Flags[flag] {
+			delete(used, strings.SplitN(val, "=", 2)[0])
+		}
+	}
+	for _, flag := range []string{"--vars-file", "--vars-store"} {
+		for _, path := range ctx.Flags[flag] {
+			for _, name := range varsFileNames(path) {
+				delete(used, name)
+			}
+		}
+	}
+
+	ret := make([]string, 0, len(used))
+	for name := range used {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+
+	return ret, true
+}
+
+//loadDocument reads the YAML document at path into generic maps and slices
+func loadDocument(path string) (interface{}, bool) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Write("Could not read `%s': %s", path, err)
+		return nil, false
+	}
+
+	var doc interface{}
+	err = yaml.Unmarshal(contents, &doc)
+	if err != nil {
+		log.Write("Could not parse `%s': %s", path, err)
+		return nil, false
+	}
+
+	return doc, true
+}
+
+//mapValue returns the value at key if node is a map, whichever kind of map the
+// YAML parser made of it
+func mapValue(node interface{}, key string) (interface{}, bool) {
+	switch m := node.(type) {
+	case map[interface{}]interface{}:
+		val, found := m[key]
+		return val, found
+	case map[string]interface{}:
+		val, found := m[key]
+		return val, found
+	}
+	return nil, false
+}
+
+func mapKeys(node interface{}) []string {
+	ret := []string{}
+	switch m := node.(type) {
+	case map[interface{}]interface{}:
+		for key := range m {
+			ret = append(ret, fmt.Sprintf("%v", key))
+		}
+	case map[string]interface{}:
+		for key := range m {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func isContainer(node interface{}) bool {
+	switch node.(type) {
+	case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+//pathStep follows one go-patch path segment (a key, an index, or key=value to
+// pick an array element) down from node
+func pathStep(node interface{}, segment string) (interface{}, bool) {
+	segment = strings.TrimSuffix(segment, "?")
+	list, isList := node.([]interface{})
+	if !isList {
+		return mapValue(node, segment)
+	}
+
+	if index, err := strconv.Atoi(segment); err == nil {
+		if index < 0 || index >= len(list) {
+			return nil, false
+		}
+		return list[index], true
+	}
+
+	parts := strings.SplitN(segment, "=", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	for _, element := range list {
+		if val, found := mapValue(element, parts[0]); found && fmt.Sprintf("%v", val) == parts[1] {
+			return element, true
+		}
+	}
+	return nil, false
+}
+
+//documentPathSegments returns the go-patch path segments that could come next
+// after the given segments. Array elements with a name are picked by it, and
+// the rest by index. Segments that lead somewhere deeper end in a slash
+func documentPathSegments(doc interface{}, segments []string) []string {
+	node := doc
+	for _, segment := range segments {
+		var found bool
+		node, found = pathStep(node, segment)
+		if !found {
+			return nil
+		}
+	}
+
+	ret := []string{}
+	add := func(segment string, child interface{}) {
+		if isContainer(child) {
+			segment += "/"
+		}
+		ret = append(ret, segment)
+	}
+
+	if list, isList := node.([]interface{}); isList {
+		for i, element := range list {
+			if name, found := mapValue(element, "name"); found {
+				add(fmt.Sprintf("name=%v", name), element)
+			} else {
+				add(strconv.Itoa(i), element)
+			}
+		}
+		return ret
+	}
+
+	for _, key := range mapKeys(node) {
+		child, _ := mapValue(node, key)
+		add(key, child)
+	}
+	return ret
+}
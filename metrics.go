@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//pathStats is what the requests for one path cost
+type pathStats struct {
+	fetches int
+	hits    int
+	bytes   int64
+	took    time.Duration
+}
+
+//completionStats adds up where the time of a completion went, so that it can
+// be told whether slowness is down to UAA, the director, or the disk
+type completionStats struct {
+	lock      sync.Mutex
+	paths     map[string]*pathStats
+	grants    int
+	authTook  time.Duration
+	diskReads int
+	diskTook  time.Duration
+}
+
+var stats = &completionStats{paths: map[string]*pathStats{}}
+
+func (s *completionStats) path(path string) *pathStats {
+	if idx := strings.Index(path, "?"); idx >= 0 {
+		path = path[:idx]
+	}
+	if _, found := s.paths[path]; !found {
+		s.paths[path] = &pathStats{}
+	}
+	return s.paths[path]
+}
+
+//Fetched records a request that went to the director
+func (s *completionStats) Fetched(path string, bytes int64, took time.Duration) {
+	log.Write("Fetched %s: %d bytes in %s", path, bytes, took)
+	s.lock.Lock()
+	p := s.path(path)
+	p.fetches++
+	p.bytes += bytes
+	p.took += took
+	s.lock.Unlock()
+}
+
+//Hit records a response handed out from the cache
+func (s *completionStats) Hit(path string) {
+	s.lock.Lock()
+	s.path(path).hits++
+	s.lock.Unlock()
+}
+
+func (s *completionStats) Authed(took time.Duration) {
+	log.Write("UAA grant took %s", took)
+	s.lock.Lock()
+	s.grants++
+	s.authTook += took
+	s.lock.Unlock()
+}
+
+func (s *completionStats) readDisk(took time.Duration) {
+	s.lock.Lock()
+	s.diskReads++
+	s.diskTook += took
+	s.lock.Unlock()
+}
+
+func (s *completionStats) reset() {
+	s.lock.Lock()
+	s.paths = map[string]*pathStats{}
+	s.grants, s.authTook = 0, 0
+	s.diskReads, s.diskTook = 0, 0
+	s.lock.Unlock()
+}
+
+//summary describes where the time went, slowest path first
+func (s *completionStats) summary() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	paths := make([]string, 0, len(s.paths))
+	for path := range s.paths {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return s.paths[paths[i]].took > s.paths[paths[j]].took
+	})
+
+	ret := []string{}
+	if s.grants > 0 {
+		ret = append(ret, fmt.Sprintf("UAA: %d grant(s) in %s", s.grants, s.authTook.Round(time.Millisecond)))
+	}
+	for _, path := range paths {
+		p := s.paths[path]
+		ret = append(ret, fmt.Sprintf("%s: %d fetch(es), %d bytes in %s, %d cache hit(s)",
+			path, p.fetches, p.bytes, p.took.Round(time.Millisecond), p.hits))
+	}
+	if s.diskReads > 0 {
+		ret = append(ret, fmt.Sprintf("Disk cache: %d read(s) in %s", s.diskReads, s.diskTook.Round(time.Millisecond)))
+	}
+
+	return ret
+}
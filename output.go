@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//What goes between a candidate's value and the rest of what's said about it,
+// for shells that read them from the same line
+const descriptionSeparator = "\t"
+
+//Descriptions longer than this many characters get cut short so they don't
+// blow out the width of the completion menu. Zero means never truncate
+const defaultDescriptionWidth = 60
+
+var descriptionWidth = defaultDescriptionWidth
+
+//withDescription puts the description after the value, for shells that read
+// them from the same line
+func withDescription(value, description string) string {
+	if description == "" {
+		return value
+	}
+	return value + descriptionSeparator + description
+}
+
+func setupDescriptionWidth() {
+	widthStr := os.Getenv("BOSH_COMPLETE_DESCRIPTION_WIDTH")
+	if widthStr == "" {
+		return
+	}
+
+	width, err := strconv.Atoi(widthStr)
+	if err != nil || width < 0 {
+		log.Write("Invalid BOSH_COMPLETE_DESCRIPTION_WIDTH `%s'. Using %d", widthStr, descriptionWidth)
+		return
+	}
+
+	descriptionWidth = width
+}
+
+//truncateDescription cuts the description down to the configured width,
+// counting characters rather than bytes so that multibyte characters are
+// neither split nor counted more than once
+func truncateDescription(description string) string {
+	if descriptionWidth == 0 || utf8.RuneCountInString(description) <= descriptionWidth {
+		return description
+	}
+
+	const ellipsis = "…"
+	runes := []rune(description)
+	if descriptionWidth <= 1 {
+		return string(runes[:descriptionWidth])
+	}
+	return strings.TrimRight(string(runes[:descriptionWidth-1]), " ") + ellipsis
+}
+
+//Turns the final list of candidates into the lines the shell's completion
+// hook expects to read back. quote is the quote that the word being completed
+// was opened with, if it was
+type formatter func(candidates []candidate, quote string) []string
+
+var formatters = map[string]formatter{
+	"bash":       formatBash,
+	"zsh":        formatZsh,
+	"fish":       formatFish,
+	"fzf":        formatFzf,
+	"powershell": formatPowershell,
+}
+
+func formatCandidates(shell string, candidates []candidate, token string) string {
+	format, found := formatters[shell]
+	if !found {
+		log.Write("Unknown shell `%s'. Formatting output for bash", shell)
+		format = formatBash
+	}
+
+	quote := ""
+	if strings.HasPrefix(token, `"`) || strings.HasPrefix(token, "'") {
+		quote = token[:1]
+	}
+
+	return strings.Join(format(candidates, quote), "\n")
+}
+
+//Characters that bash and zsh would take as something other than part of the
+// word. A leading ~ is left alone so that it still means the home directory
+const posixSpecialChars = " \t\n\r'\"\\$`|&;()<>*?[]{}!#"
+
+//escapePosix makes the value safe for bash or zsh to put on the command line.
+// Values in a word that was opened with a quote stay within that quote, which
+// is only closed if the value is finished (i.e. isn't a directory to go on
+// into)
+func escapePosix(val, quote string, finished bool) string {
+	closing := ""
+	if finished {
+		closing = quote
+	}
+
+	switch quote {
+	case "'":
+		return "'" + strings.Replace(val, "'", `'\''`, -1) + closing
+	case `"`:
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(val)
+		return `"` + escaped + closing
+	}
+
+	if !strings.ContainsAny(val, posixSpecialChars) {
+		return val
+	}
+	ret := strings.Builder{}
+	for _, r := range val {
+		if strings.ContainsRune(posixSpecialChars, r) {
+			ret.WriteRune('\\')
+		}
+		ret.WriteRune(r)
+	}
+	return ret.String()
+}
+
+func formatBash(candidates []candidate, quote string) []string {
+	if bashMenuEnabled() {
+		candidates = groupByKind(candidates)
+		//bash is only listing the candidates, not putting any of them on the
+		// command line, so there's room for descriptions and color
+		if os.Getenv("COMP_TYPE") == bashListingCompType && len(candidates) > 1 {
+			return bashListing(candidates)
+		}
+	}
+
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		//bash has nowhere to show descriptions
+		ret = append(ret, escapePosix(c.Value, quote, !dontAddSpace))
+	}
+
+	if len(ret) == 1 && !dontAddSpace {
+		ret[0] = fmt.Sprintf("%s ", ret[0])
+	}
+
+	return ret
+}
+
+//formatZsh starts with a line saying whether zsh should put a space after a
+// lone candidate ("space" or "nospace"), and then "unfiltered" if zsh should
+// leave candidates that don't start with what was typed alone, followed by
+// the candidates as the value:description pairs that _describe takes. zsh
+// does its own quoting
+func formatZsh(candidates []candidate, quote string) []string {
+	mode := "space"
+	if dontAddSpace {
+		mode = "nospace"
+	}
+	if matchesLoosely() {
+		mode += " unfiltered"
+	}
+
+	ret := make([]string, 0, len(candidates)+1)
+	ret = append(ret, mode)
+	for _, c := range candidates {
+		val := strings.Replace(strings.Replace(c.Value, `\`, `\\`, -1), ":", `\:`, -1)
+		if c.Description != "" {
+			val += ":" + truncateDescription(c.Description)
+		}
+		ret = append(ret, val)
+	}
+
+	return ret
+}
+
+//formatFish gives fish the value<tab>description lines it wants. fish does its
+// own quoting, and already knows not to put a space after paths and the like
+func formatFish(candidates []candidate, quote string) []string {
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ret = append(ret, withDescription(c.Value, truncateDescription(c.Description)))
+	}
+
+	return ret
+}
+
+//formatPowershell gives each candidate's value, what to list it as, and its
+// description, separated by tabs
+func formatPowershell(candidates []candidate, quote string) []string {
+	ret := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		val := c.Value
+		//PowerShell escapes single quotes within single quotes by doubling them
+		if quote != "" || strings.ContainsAny(val, " \t\n\r'$`;,(){}@|&<>\"") {
+			val = fmt.Sprintf("'%s'", strings.Replace(val, "'", "''", -1))
+		}
+		if len(candidates) == 1 && !dontAddSpace {
+			val = fmt.Sprintf("%s ", val)
+		}
+		ret = append(ret, strings.Join([]string{val, c.display(), truncateDescription(c.Description)}, descriptionSeparator))
+	}
+
+	return ret
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+const appDirName = "bosh-complete"
+
+//cacheDir is where bosh-complete keeps data that it can regenerate, such as
+// director responses. That's wherever the platform keeps caches, unless told
+// otherwise with $BOSH_COMPLETE_CACHE_DIR or cache_dir in the tool config
+func cacheDir() string {
+	if dir := envString("BOSH_COMPLETE_CACHE_DIR", getToolConfig().CacheDir); dir != "" {
+		return strings.TrimRight(expandHome(dir), "/")
+	}
+	return platformDir("XDG_CACHE_HOME", ".cache", "Library/Caches", "LOCALAPPDATA")
+}
+
+//configDir is where bosh-complete's own configuration lives, along with its
+// logins and plugins. That's wherever the platform keeps configuration,
+// unless told otherwise with $BOSH_COMPLETE_CONFIG_DIR. It can't be set in
+// the tool config, which lives there
+func configDir() string {
+	if dir := os.Getenv("BOSH_COMPLETE_CONFIG_DIR"); dir != "" {
+		return strings.TrimRight(expandHome(dir), "/")
+	}
+
+	//The config used to be under ~/.config on macOS too, and is left there if
+	// that's where it is
+	if legacy := fmt.Sprintf("%s/.config/%s", homeDir(), appDirName); runtime.GOOS == "darwin" && isDir(legacy) {
+		return xdgDir("XDG_CONFIG_HOME", ".config")
+	}
+	return platformDir("XDG_CONFIG_HOME", ".config", "Library/Application Support", "APPDATA")
+}
+
+//logDir is where the log goes, unless $BOSH_COMPLETE_LOG_FILE or log_file in
+// the tool config says otherwise
+func logDir() string {
+	return platformDir("XDG_STATE_HOME", ".local/state", "Library/Logs", "LOCALAPPDATA")
+}
+
+//platformDir resolves the directory that bosh-complete keeps one sort of
+// thing in. On Windows, that's under the folder in the given variable (e.g.
+// %APPDATA%). On macOS, it's under the given directory in ~/Library, unless
+// the XDG variable is set, as it's only ever set on a Mac on purpose.
+// Everywhere else, it's the XDG base directory
+func platformDir(xdgVar, xdgFallback, macDir, windowsVar string) string {
+	switch runtime.GOOS {
+	case "windows":
+		if base := os.Getenv(windowsVar); base != "" {
+			return fmt.Sprintf("%s/%s", strings.TrimRight(base, `/\`), appDirName)
+		}
+		return fmt.Sprintf("%s/%s/%s", homeDir(), xdgFallback, appDirName)
+	case "darwin":
+		if !strings.HasPrefix(os.Getenv(xdgVar), "/") {
+			return fmt.Sprintf("%s/%s/%s", homeDir(), macDir, appDirName)
+		}
+	}
+
+	return xdgDir(xdgVar, xdgFallback)
+}
+
+//xdgDir resolves the XDG base directory given by envvar, falling back to the
+// given directory under $HOME when it is unset. The spec says that relative
+// paths are invalid and should be ignored
+func xdgDir(envvar, fallback string) string {
+	base := os.Getenv(envvar)
+	if !strings.HasPrefix(base, "/") {
+		base = fmt.Sprintf("%s/%s", homeDir(), fallback)
+	}
+
+	return fmt.Sprintf("%s/%s", strings.TrimRight(base, "/"), appDirName)
+}
+
+//homeDir is the user's home directory: $HOME, or %USERPROFILE% on Windows
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home
+}
+
+func isDir(location string) bool {
+	info, err := os.Stat(location)
+	return err == nil && info.IsDir()
+}
+
+//ensureDir makes the given directory (and its parents) if it doesn't exist
+func ensureDir(dir string) error {
+	return os.MkdirAll(dir, 0700)
+}
+
+//expandHome turns a leading ~/ into the home directory, as configured paths
+// aren't run through a shell that would do it for them
+func expandHome(location string) string {
+	if strings.HasPrefix(location, "~/") {
+		return homeDir() + location[1:]
+	}
+	return location
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestXDGDirs(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skipf("%s has its own places for things", runtime.GOOS)
+	}
+
+	tests := []struct {
+		name   string
+		envvar string
+		value  string
+		dir    func() string
+		want   string
+	}{
+		{"config from XDG_CONFIG_HOME", "XDG_CONFIG_HOME", "/xdg/config", configDir, "/xdg/config/bosh-complete"},
+		{"config under HOME without XDG_CONFIG_HOME", "XDG_CONFIG_HOME", "", configDir, "HOME/.config/bosh-complete"},
+		{"config ignores a relative XDG_CONFIG_HOME", "XDG_CONFIG_HOME", "xdg/config", configDir, "HOME/.config/bosh-complete"},
+		{"config trims a trailing slash", "XDG_CONFIG_HOME", "/xdg/config/", configDir, "/xdg/config/bosh-complete"},
+
+		{"cache from XDG_CACHE_HOME", "XDG_CACHE_HOME", "/xdg/cache", cacheDir, "/xdg/cache/bosh-complete"},
+		{"cache under HOME without XDG_CACHE_HOME", "XDG_CACHE_HOME", "", cacheDir, "HOME/.cache/bosh-complete"},
+		{"cache ignores a relative XDG_CACHE_HOME", "XDG_CACHE_HOME", "xdg/cache", cacheDir, "HOME/.cache/bosh-complete"},
+
+		{"log from XDG_STATE_HOME", "XDG_STATE_HOME", "/xdg/state", logDir, "/xdg/state/bosh-complete"},
+		{"log under HOME without XDG_STATE_HOME", "XDG_STATE_HOME", "", logDir, "HOME/.local/state/bosh-complete"},
+		{"log ignores a relative XDG_STATE_HOME", "XDG_STATE_HOME", "xdg/state", logDir, "HOME/.local/state/bosh-complete"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home := isolate(t)
+			t.Setenv(test.envvar, test.value)
+
+			want := test.want
+			if want[0] != '/' {
+				want = home + want[len("HOME"):]
+			}
+			if got := test.dir(); got != want {
+				t.Errorf("Got `%s', want `%s'", got, want)
+			}
+		})
+	}
+}
+
+func TestDirOverrides(t *testing.T) {
+	t.Run("BOSH_COMPLETE_CACHE_DIR over XDG_CACHE_HOME", func(t *testing.T) {
+		isolate(t)
+		t.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+		t.Setenv("BOSH_COMPLETE_CACHE_DIR", "/elsewhere/cache/")
+
+		if got := cacheDir(); got != "/elsewhere/cache" {
+			t.Errorf("Got `%s', want `/elsewhere/cache'", got)
+		}
+	})
+
+	t.Run("cache_dir from the tool config", func(t *testing.T) {
+		home := isolate(t)
+		t.Setenv("BOSH_COMPLETE_CONFIG", writeFile(t, home, "config.yml", "cache_dir: ~/my-cache\n"))
+
+		if got, want := cacheDir(), home+"/my-cache"; got != want {
+			t.Errorf("Got `%s', want `%s'", got, want)
+		}
+	})
+
+	t.Run("BOSH_COMPLETE_CONFIG_DIR over XDG_CONFIG_HOME", func(t *testing.T) {
+		home := isolate(t)
+		t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+		t.Setenv("BOSH_COMPLETE_CONFIG_DIR", "~/my-config")
+
+		if got, want := configDir(), home+"/my-config"; got != want {
+			t.Errorf("Got `%s', want `%s'", got, want)
+		}
+	})
+}
+
+func TestMacDirs(t *testing.T) {
+	if runtime.GOOS != "darwin" {
+		t.Skip("Only macOS keeps things under ~/Library")
+	}
+
+	home := isolate(t)
+	if got, want := cacheDir(), home+"/Library/Caches/bosh-complete"; got != want {
+		t.Errorf("cacheDir() = `%s', want `%s'", got, want)
+	}
+	if got, want := configDir(), home+"/Library/Application Support/bosh-complete"; got != want {
+		t.Errorf("configDir() = `%s', want `%s'", got, want)
+	}
+	if got, want := logDir(), home+"/Library/Logs/bosh-complete"; got != want {
+		t.Errorf("logDir() = `%s', want `%s'", got, want)
+	}
+
+	//XDG variables are only ever set on a Mac on purpose
+	t.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+	if got := cacheDir(); got != "/xdg/cache/bosh-complete" {
+		t.Errorf("cacheDir() = `%s' with XDG_CACHE_HOME set", got)
+	}
+}
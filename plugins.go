@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+//How long a plugin gets to describe itself
+const pluginDescribeTimeout = 2 * time.Second
+
+//pluginDescription is what a plugin says about itself when run with
+// `describe'
+type pluginDescription struct {
+	//Commands that the plugin completes in full, which bosh-complete doesn't
+	// know about (e.g. those of a company's own bosh wrapper)
+	Commands []pluginCommand `json:"commands"`
+	//Commands that bosh-complete already completes, whose candidates the
+	// plugin gets to change
+	Wraps []string `json:"wraps"`
+}
+
+type pluginCommand struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	//Flags that take values have them completed by the plugin
+	Flags []cliFlag `json:"flags,omitempty"`
+	//How many positional arguments the plugin completes
+	Args int `json:"args,omitempty"`
+}
+
+//pluginRequest is what a plugin is given on stdin when run with `complete'
+type pluginRequest struct {
+	Command      string              `json:"command"`
+	Args         []string            `json:"args"`
+	CurrentToken string              `json:"current_token"`
+	CurrentFlag  string              `json:"current_flag,omitempty"`
+	Flags        map[string][]string `json:"flags"`
+	//What bosh-complete (or the plugin before this one) came up with, for
+	// commands that the plugin wraps
+	Candidates []pluginCandidate `json:"candidates,omitempty"`
+}
+
+//pluginResponse is what a plugin prints to stdout when run with `complete'
+type pluginResponse struct {
+	Candidates []pluginCandidate `json:"candidates"`
+}
+
+type pluginCandidate struct {
+	Value       string `json:"value"`
+	Display     string `json:"display,omitempty"`
+	Description string `json:"description,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+}
+
+//completionPlugin is a plugin that's been found, and what it said about
+// itself
+type completionPlugin struct {
+	Path string
+	pluginDescription
+	//run hands the plugin a JSON request, and returns its JSON response
+	run func(ctx context.Context, request []byte) ([]byte, error)
+}
+
+//loadGoPlugin loads a Go plugin (a .so) in builds made with -tags goplugin.
+// It's nil otherwise, and Go plugins are skipped
+var loadGoPlugin func(path string) (*completionPlugin, error)
+
+//The plugins found for this completion
+var plugins []*completionPlugin
+
+func pluginDir() string {
+	return fmt.Sprintf("%s/plugins", configDir())
+}
+
+func pluginTablePath() string {
+	return fmt.Sprintf("%s/plugins.json", cacheDir())
+}
+
+//loadPlugins finds the plugins in the plugin directory, in name order.
+// Executables are only run to describe themselves when they're new or have
+// changed, and what they said is kept in the cache dir until then
+func loadPlugins() []*completionPlugin {
+	files, err := ioutil.ReadDir(pluginDir())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Write("Could not list plugins: %s", err)
+		}
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	table := map[string]pluginDescription{}
+	contents, err := ioutil.ReadFile(pluginTablePath())
+	if err == nil && json.Unmarshal(contents, &table) != nil {
+		log.Write("Ignoring unreadable plugin table")
+		table = map[string]pluginDescription{}
+	}
+	changed := false
+	ret := []*completionPlugin{}
+	current := map[string]pluginDescription{}
+
+	for _, file := range files {
+		path := fmt.Sprintf("%s/%s", pluginDir(), file.Name())
+		if file.IsDir() {
+			continue
+		}
+
+		if strings.HasSuffix(file.Name(), ".so") {
+			if loadGoPlugin == nil {
+				log.Write("Skipping Go plugin `%s': not built with -tags goplugin", path)
+				continue
+			}
+			p, err := loadGoPlugin(path)
+			if err != nil {
+				log.Write("Could not load Go plugin `%s': %s", path, err)
+				continue
+			}
+			ret = append(ret, p)
+			continue
+		}
+
+		if !pluginExecutable(file) {
+			continue
+		}
+
+		key, err := cliBinaryKey(path)
+		if err != nil {
+			continue
+		}
+		description, found := table[key]
+		if !found {
+			description, err = describePlugin(path)
+			if err != nil {
+				log.Write("Could not get plugin `%s' to describe itself: %s", path, err)
+				continue
+			}
+			changed = true
+		}
+		current[key] = description
+
+		ret = append(ret, &completionPlugin{Path: path, pluginDescription: description, run: execPlugin(path)})
+	}
+
+	//Plugins that have gone (or changed) are forgotten
+	if changed || len(current) != len(table) {
+		savePluginTable(current)
+	}
+
+	return ret
+}
+
+func savePluginTable(table map[string]pluginDescription) {
+	contents, err := json.Marshal(table)
+	if err != nil {
+		return
+	}
+
+	err = ensureDir(cacheDir())
+	if err == nil {
+		err = writeFileAtomic(pluginTablePath(), contents)
+	}
+	if err != nil {
+		log.Write("Could not save plugin table: %s", err)
+	}
+}
+
+//pluginExecutable returns whether the file is one that can be run as a
+// plugin. Anything else in the plugin directory (a README, say) is ignored
+func pluginExecutable(file os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return strings.HasSuffix(strings.ToLower(file.Name()), ".exe")
+	}
+	return file.Mode()&0111 != 0
+}
+
+func describePlugin(path string) (pluginDescription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginDescribeTimeout)
+	defer cancel()
+
+	ret := pluginDescription{}
+	output, err := exec.CommandContext(ctx, path, "describe").Output()
+	if err != nil {
+		return ret, err
+	}
+
+	err = json.Unmarshal(output, &ret)
+	return ret, err
+}
+
+//execPlugin runs the executable at path with `complete', the request on its
+// stdin and the response on its stdout. What it says on stderr is ignored
+func execPlugin(path string) func(context.Context, []byte) ([]byte, error) {
+	return func(ctx context.Context, request []byte) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, path, "complete")
+		cmd.Stdin = bytes.NewReader(request)
+		return cmd.Output()
+	}
+}
+
+//complete asks the plugin for candidates, handing it those that there
+// already are if it's wrapping a command
+func (p *completionPlugin) complete(ctx compContext, candidates []candidate) ([]candidate, error) {
+	req := pluginRequest{
+		Command:      ctx.Command,
+		Args:         append([]string{}, ctx.Args...),
+		CurrentToken: ctx.CurrentToken,
+		CurrentFlag:  ctx.CurrentFlag,
+		Flags:        ctx.Flags,
+	}
+	for _, c := range candidates {
+		req.Candidates = append(req.Candidates, pluginCandidate{
+			Value:       c.Value,
+			Display:     c.Display,
+			Description: c.Description,
+			Kind:        c.Kind,
+		})
+	}
+
+	request, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	output, err := p.run(ctx.Context, request)
+	log.Write("Plugin `%s' took %s", p.Path, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := pluginResponse{}
+	err = json.Unmarshal(output, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse response: %s", err)
+	}
+
+	ret := make([]candidate, 0, len(resp.Candidates))
+	for _, c := range resp.Candidates {
+		ret = append(ret, candidate{Value: c.Value, Display: c.Display, Description: c.Description, Kind: c.Kind})
+	}
+	return ret, nil
+}
+
+//compPlugin has the plugin complete the whole thing, for the commands that it
+// brought
+func compPlugin(p *completionPlugin) compFunc {
+	return func(ctx compContext) ([]candidate, error) {
+		return p.complete(ctx, nil)
+	}
+}
+
+//insertPluginCommands finds the plugins, and adds the commands that they
+// bring. Commands that bosh-complete already has can only be wrapped, not
+// replaced
+func insertPluginCommands() {
+	plugins = loadPlugins()
+
+	known := map[string]bool{}
+	for _, cmd := range commands {
+		known[cmd.Name] = true
+	}
+
+	for _, p := range plugins {
+		for _, c := range p.Commands {
+			if known[c.Name] {
+				log.Write("Plugin `%s' can't replace command `%s', only wrap it", p.Path, c.Name)
+				continue
+			}
+
+			cmd := command{Name: c.Name}
+			for i := 0; i < c.Args; i++ {
+				cmd.Args = append(cmd.Args, compPlugin(p))
+			}
+			for _, f := range c.Flags {
+				toInsert := flag{Long: f.Long}
+				if f.Short != "" {
+					toInsert.Short = rune(f.Short[0])
+				}
+				if f.TakesValue {
+					toInsert.Complete = compPlugin(p)
+				}
+				cmd.Flags = append(cmd.Flags, toInsert)
+			}
+
+			log.Write("Adding command `%s' from plugin `%s'", c.Name, p.Path)
+			cmd = cmd.Insert()
+			known[c.Name] = true
+			for _, alias := range c.Aliases {
+				if !known[alias] {
+					cmd.Alias(alias)
+					known[alias] = true
+				}
+			}
+		}
+	}
+}
+
+//withPlugins has the plugins that wrap the given command (or the command
+// that it's an alias of) change what fn comes up with, each in turn. A plugin
+// that fails is passed over
+func withPlugins(commandName string, fn compFunc) compFunc {
+	name := commandName
+	if cmd, found := commands.Find(commandName); found && cmd.AliasOf != "" {
+		name = cmd.AliasOf
+	}
+
+	wrapping := []*completionPlugin{}
+	for _, p := range plugins {
+		for _, wrapped := range p.Wraps {
+			if wrapped == name {
+				wrapping = append(wrapping, p)
+				break
+			}
+		}
+	}
+	if len(wrapping) == 0 {
+		return fn
+	}
+
+	return func(ctx compContext) ([]candidate, error) {
+		candidates, err := fn(ctx)
+		if err != nil {
+			//The plugin may well know better
+			log.Write("%s", err)
+			candidates = nil
+		}
+
+		for _, p := range wrapping {
+			wrapped, err := p.complete(ctx, candidates)
+			if err != nil {
+				log.Write("Plugin `%s' failed: %s", p.Path, err)
+				continue
+			}
+			candidates = wrapped
+		}
+		return candidates, nil
+	}
+}
@@ -0,0 +1,63 @@
+//go:build goplugin
+// +build goplugin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"plugin"
+)
+
+//Builds made with -tags goplugin can load Go plugins from the plugin
+// directory. They take the same JSON as executables do, only through a call
+// instead of stdin and stdout:
+//
+//	func Describe() ([]byte, error)
+//	func Complete(request []byte) ([]byte, error)
+//
+// and, as with any Go plugin, they need building with the same Go and
+// packages as bosh-complete itself
+func init() {
+	loadGoPlugin = func(path string) (*completionPlugin, error) {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		describeSym, err := p.Lookup("Describe")
+		if err != nil {
+			return nil, err
+		}
+		describe, ok := describeSym.(func() ([]byte, error))
+		if !ok {
+			return nil, fmt.Errorf("Describe is a %T, not a func() ([]byte, error)", describeSym)
+		}
+
+		completeSym, err := p.Lookup("Complete")
+		if err != nil {
+			return nil, err
+		}
+		complete, ok := completeSym.(func([]byte) ([]byte, error))
+		if !ok {
+			return nil, fmt.Errorf("Complete is a %T, not a func([]byte) ([]byte, error)", completeSym)
+		}
+
+		output, err := describe()
+		if err != nil {
+			return nil, err
+		}
+		ret := &completionPlugin{Path: path}
+		err = json.Unmarshal(output, &ret.pluginDescription)
+		if err != nil {
+			return nil, err
+		}
+
+		//The call can't be abandoned, so a plugin that hangs hangs completion
+		ret.run = func(_ context.Context, request []byte) ([]byte, error) {
+			return complete(request)
+		}
+		return ret, nil
+	}
+}
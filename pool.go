@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//clientPool keeps a client for each environment (and set of credentials for
+// it) that's been asked about, each with its own auth state, CA, and cache
+// namespace. A completion normally only makes the one, but the command line's
+// -e needn't be $BOSH_ENVIRONMENT, and the daemon and prewarm go between
+// environments
+type clientPool struct {
+	lock    sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	once   sync.Once
+	client *director.Client
+	err    error
+}
+
+//Clients by everything that went into making them (see clientKey)
+var boshClients = &clientPool{clients: map[string]*pooledClient{}}
+
+//get returns the client for key, calling newClient to make it if there isn't
+// one yet. Prewarm asks for several at once, so anybody after the same
+// client waits on the one being made; a client being made for one
+// environment doesn't hold up another's
+func (p *clientPool) get(key string, newClient func() (*director.Client, error)) (*director.Client, error) {
+	p.lock.Lock()
+	entry, found := p.clients[key]
+	if !found {
+		entry = &pooledClient{}
+		p.clients[key] = entry
+	}
+	p.lock.Unlock()
+
+	entry.once.Do(func() {
+		client, err := newClient()
+		//all reads these while others may still be being made
+		p.lock.Lock()
+		entry.client, entry.err = client, err
+		p.lock.Unlock()
+	})
+
+	//Failing to make a client isn't remembered, so that e.g. a config fixed
+	// while the daemon runs gets noticed
+	if entry.err != nil {
+		p.lock.Lock()
+		if p.clients[key] == entry {
+			delete(p.clients, key)
+		}
+		p.lock.Unlock()
+	}
+
+	return entry.client, entry.err
+}
+
+//all returns every client that's been made so far
+func (p *clientPool) all() []*director.Client {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ret := make([]*director.Client, 0, len(p.clients))
+	for _, entry := range p.clients {
+		if entry.client != nil {
+			ret = append(ret, entry.client)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+
+	"text/template"
+)
+
+var powershellSource = `
+Register-ArgumentCompleter -Native -CommandName {{.Bosh}} -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+
+	$point = $cursorPosition - $commandAst.Extent.StartOffset
+	# The command's extent doesn't include trailing whitespace, so pad back out
+	# to the cursor to tell a new word from the end of the last one
+	$env:COMP_LINE = $commandAst.ToString().PadRight($point)
+	$env:COMP_POINT = $point
+	$output = & '{{.Executable}}' complete --shell powershell {{.Debug}} --
+	Remove-Item Env:\COMP_LINE, Env:\COMP_POINT
+
+	$output | Where-Object { $_ -ne '' } | ForEach-Object {
+		$value, $display, $description = $_ -split "` + "`" + `t", 3
+		if (-not $display) { $display = $value.Trim() }
+		if (-not $description) { $description = $display }
+		[System.Management.Automation.CompletionResult]::new($value, $display, 'ParameterValue', $description)
+	}
+}
+`
+
+func doPowershellSource() {
+	tmpl := template.Must(template.New("powershell_source").Parse(powershellSource))
+	me, err := os.Executable()
+	debug := ""
+	if opts.Debug {
+		debug = "--debug"
+	}
+	if err != nil {
+		panic("Could not determine executable location")
+	}
+	err = tmpl.Execute(os.Stdout, struct {
+		Executable string
+		Bosh       string
+		Debug      string
+	}{
+		Executable: me,
+		Bosh:       "bosh",
+		Debug:      debug,
+	})
+	if err != nil {
+		panic("Could not render source template for powershell")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/thomasmitchell/bosh-complete/director"
+)
+
+//doPrewarm fetches everything completions usually want from the given
+// environments (or $BOSH_ENVIRONMENT, or every environment in the bosh
+// config with --all) into the disk cache, so that the first completion of a
+// session doesn't have to wait on the director. It's meant to be run from
+// shell startup or cron. Environments are prewarmed at the same time, each
+// with its own client
+func doPrewarm(args []string, all bool) {
+	environments := args
+	if all {
+		cfg, err := getBoshConfig(prewarmContext(""))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		environments = nil
+		for _, env := range cfg.Environments {
+			name := env.Alias
+			if name == "" {
+				name = env.URL
+			}
+			environments = append(environments, name)
+		}
+		if len(environments) == 0 {
+			fmt.Fprintf(os.Stderr, "No environments in the bosh config `%s'\n", cfg.Location)
+			os.Exit(1)
+		}
+	}
+	if len(environments) == 0 {
+		//Whatever $BOSH_ENVIRONMENT says
+		environments = []string{""}
+	}
+
+	results := make([]string, len(environments))
+	failed := make([]bool, len(environments))
+	wg := sync.WaitGroup{}
+	for i, env := range environments {
+		wg.Add(1)
+		go func(i int, env string) {
+			defer wg.Done()
+			results[i], failed[i] = prewarmEnvironment(prewarmContext(env))
+		}(i, env)
+	}
+	wg.Wait()
+
+	anyFailed := false
+	for i := range results {
+		if failed[i] {
+			anyFailed = true
+			fmt.Fprintf(os.Stderr, "%s\n", results[i])
+			continue
+		}
+		fmt.Printf("%s\n", results[i])
+	}
+	if anyFailed {
+		os.Exit(1)
+	}
+}
+
+//prewarmContext is the context for prewarming the given environment, or
+// $BOSH_ENVIRONMENT if it's empty
+func prewarmContext(environment string) compContext {
+	ctx := compContext{
+		Context: context.Background(),
+		Flags:   map[string][]string{},
+		FromEnv: map[string]string{},
+	}
+	if environment != "" {
+		ctx.Flags["--environment"] = []string{environment}
+	}
+	ctx.insertEnvvars()
+	return ctx
+}
+
+//prewarmEnvironment prewarms the environment in ctx, returning what to say
+// about it, and whether it failed
+func prewarmEnvironment(ctx compContext) (string, bool) {
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithTimeout(ctx.Context, completionTimeout())
+	defer cancel()
+
+	envName, _ := ctx.FlagValue("--environment")
+	c, err := getBoshClient(ctx)
+	if err != nil {
+		return fmt.Sprintf("Could not prewarm `%s': %s", envName, err), true
+	}
+
+	paths := []string{director.DeploymentsPath, director.ReleasesPath, director.StemcellsPath}
+	info, err := c.Info(ctx.Context)
+	if err != nil {
+		return fmt.Sprintf("Could not reach director `%s': %s", c.URL, err), true
+	}
+	if info.Supports(director.FeatureConfigs) {
+		paths = append(paths, director.ConfigsPath("", true))
+	}
+
+	errs := c.RefetchMany(ctx.Context, paths)
+
+	//Instances can only be asked for once we know what deployments there are
+	deployments := []director.Deployment{}
+	if _, failed := errs[director.DeploymentsPath]; !failed {
+		deployments, err = c.Deployments(ctx.Context)
+		if err != nil {
+			errs[director.DeploymentsPath] = err
+		}
+	}
+
+	instancePaths := []string{}
+	for _, dep := range deployments {
+		instancePaths = append(instancePaths, director.InstancesPath(dep.Name))
+	}
+	for path, err := range c.RefetchMany(ctx.Context, instancePaths) {
+		errs[path] = err
+	}
+
+	prewarmed := len(paths) + len(instancePaths) - len(errs)
+	if len(errs) > 0 {
+		return fmt.Sprintf("Prewarmed %d response(s) from `%s', but %s", prewarmed, c.URL, errs), true
+	}
+
+	return fmt.Sprintf("Prewarmed %d response(s) from `%s'", prewarmed, c.URL), false
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+const defaultRetries = 2
+
+//maxRetries is how many times a failed request may be sent again. It can be
+// set with $BOSH_COMPLETE_RETRIES, where 0 turns retrying off
+func maxRetries() int {
+	val := os.Getenv("BOSH_COMPLETE_RETRIES")
+	if val == "" {
+		return defaultRetries
+	}
+
+	ret, err := strconv.Atoi(val)
+	if err != nil || ret < 0 {
+		log.Write("Ignoring invalid value for BOSH_COMPLETE_RETRIES: `%s'", val)
+		return defaultRetries
+	}
+
+	return ret
+}
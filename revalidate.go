@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+//Paths that were served stale during this completion, and so need fetching
+// again once it's done
+var stalePaths = map[string]bool{}
+var stalePathsLock sync.Mutex
+
+//Set in the daemon, which keeps its cache fresh on its own
+var daemonMode bool
+
+//staleWhileRevalidate returns whether stale responses should be served while
+// they're refreshed in the background. It can be turned off with
+// BOSH_COMPLETE_STALE_WHILE_REVALIDATE=false
+func staleWhileRevalidate() bool {
+	val := os.Getenv("BOSH_COMPLETE_STALE_WHILE_REVALIDATE")
+	if val == "" {
+		return true
+	}
+
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Write("Ignoring invalid value for BOSH_COMPLETE_STALE_WHILE_REVALIDATE: `%s'", val)
+		return true
+	}
+
+	return enabled
+}
+
+//staleOnError returns whether a director that fails (or can't be
+// authenticated with) partway through a completion should be made up for with
+// whatever's cached, however old. It can be turned off with
+// BOSH_COMPLETE_STALE_ON_ERROR=false
+func staleOnError() bool {
+	return envBool("BOSH_COMPLETE_STALE_ON_ERROR", orDefault(getToolConfig().StaleOnError, true))
+}
+
+func queueRevalidation(path string) {
+	stalePathsLock.Lock()
+	stalePaths[path] = true
+	stalePathsLock.Unlock()
+}
+
+//revalidateInBackground starts a detached bosh-complete to refetch whatever
+// was served stale, so that the next completion has it fresh. It's handed the
+// same command line, so that it ends up with the same client
+func revalidateInBackground(boshArgs []string) {
+	stalePathsLock.Lock()
+	paths := make([]string, 0, len(stalePaths))
+	for path := range stalePaths {
+		paths = append(paths, path)
+	}
+	stalePaths = map[string]bool{}
+	stalePathsLock.Unlock()
+
+	if len(paths) == 0 || daemonMode {
+		return
+	}
+	sort.Strings(paths)
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Write("Could not find own executable to revalidate with: %s", err)
+		return
+	}
+
+	args := []string{"revalidate"}
+	for _, path := range paths {
+		args = append(args, "--path", path)
+	}
+	args = append(args, "--")
+	args = append(args, boshArgs...)
+
+	cmd := exec.Command(self, args...)
+	//Nothing of it should end up in front of the user, or keep the shell
+	// waiting on output
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	detach(cmd)
+
+	err = cmd.Start()
+	if err != nil {
+		log.Write("Could not start revalidation: %s", err)
+		return
+	}
+
+	log.Write("Revalidating %d stale paths in the background (pid %d)", len(paths), cmd.Process.Pid)
+	_ = cmd.Process.Release()
+}
+
+//doRevalidate refetches the given paths for the client that the given command
+// line would use, updating the disk cache
+func doRevalidate(paths, boshArgs []string) {
+	insertGlobalFlags()
+	commands.Populate()
+
+	ctx, ok := parseContext(boshArgs)
+	if !ok {
+		return
+	}
+
+	var cancel context.CancelFunc
+	ctx.Context, cancel = context.WithTimeout(context.Background(), completionTimeout())
+	defer cancel()
+
+	c, err := getBoshClient(ctx)
+	if err != nil {
+		log.Write("Could not revalidate: %s", err)
+		return
+	}
+
+	for _, path := range paths {
+		err = c.Refetch(ctx.Context, path)
+		if err != nil {
+			log.Write("Could not revalidate %s: %s", path, err)
+		}
+	}
+}
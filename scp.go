@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+//Where things usually are on a bosh-deployed VM, offered for remote paths when
+// the VM itself isn't asked
+var commonRemotePaths = []string{
+	"/var/vcap/",
+	"/var/vcap/bosh/",
+	"/var/vcap/bosh/log/",
+	"/var/vcap/data/",
+	"/var/vcap/jobs/",
+	"/var/vcap/monit/",
+	"/var/vcap/packages/",
+	"/var/vcap/store/",
+	"/var/vcap/sys/",
+	"/var/vcap/sys/log/",
+	"/var/vcap/sys/run/",
+	"/tmp/",
+}
+
+//remoteListingEnabled returns whether completing a remote scp path may run
+// `bosh ssh' to look at what's there. It doesn't unless told to, with scp_ls:
+// true in the tool config or BOSH_COMPLETE_SCP_LS=true
+func remoteListingEnabled() bool {
+	//Looking is a trip to the instance and back
+	if offlineMode() {
+		return false
+	}
+	return envBool("BOSH_COMPLETE_SCP_LS", getToolConfig().SCPListing)
+}
+
+//splitRemotePath splits a bosh scp argument like web/0:/var/vcap into the
+// instance and the path on it. It returns false for local paths
+func splitRemotePath(arg string) (instance, path string, remote bool) {
+	colon := strings.Index(arg, ":")
+	if colon <= 0 || strings.ContainsAny(arg[:1], "./~") {
+		return "", "", false
+	}
+
+	return arg[:colon], arg[colon+1:], true
+}
+
+//compSCPPaths offers local files, instances to copy to or from, and once an
+// instance has been given, paths on it
+func compSCPPaths(ctx compContext) ([]candidate, error) {
+	instance, path, remote := splitRemotePath(ctx.CurrentToken)
+	if !remote {
+		return compOr(compFiles, compSCPInstances)(ctx)
+	}
+
+	dontAddSpace = true
+	dir := path[:strings.LastIndex(path, "/")+1]
+	var paths []string
+	if remoteListingEnabled() {
+		var err error
+		paths, err = listRemoteDir(ctx, instance, dir, strings.HasPrefix(path[len(dir):], "."))
+		if err != nil {
+			log.Write("Could not list `%s' on `%s': %s", dir, instance, err)
+			paths = nil
+		}
+	}
+	if paths == nil {
+		paths = commonRemotePaths
+	}
+
+	ret := make([]candidate, 0, len(paths))
+	for _, p := range paths {
+		ret = append(ret, candidate{Value: instance + ":" + p, Display: p[strings.LastIndex(strings.TrimSuffix(p, "/"), "/")+1:]})
+	}
+
+	return ret, nil
+}
+
+//compSCPInstances offers instance groups and instances, ready for a remote
+// path to be typed after them. Since it goes alongside local files, it does its
+// own prefix filtering, and leaves trouble reaching the director to the logs
+func compSCPInstances(ctx compContext) ([]candidate, error) {
+	instances, err := compInstances(ctx)
+	if err != nil {
+		log.Write("Not offering instances to scp: %s", err)
+		return nil, nil
+	}
+
+	candidates := []candidate{}
+	if !strings.Contains(ctx.CurrentToken, "/") {
+		groups, _ := compInstanceGroups(ctx)
+		for _, group := range groups {
+			candidates = append(candidates, candidate{Value: group.Value + ":"})
+		}
+	}
+	for _, instance := range instances {
+		if !strings.HasSuffix(instance.Value, "/") {
+			instance.Value += ":"
+		}
+		candidates = append(candidates, instance)
+	}
+
+	ret := []candidate{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c.Value, ctx.CurrentToken) {
+			ret = append(ret, c)
+		}
+	}
+
+	return ret, nil
+}
+
+//The flags passed along to `bosh ssh' so that it talks to the same director
+// and deployment as what's being completed
+var remoteListingFlags = []string{
+	"--environment", "--deployment", "--config", "--ca-cert", "--client", "--client-secret",
+}
+
+//listRemoteDir runs ls on the instance by way of `bosh ssh', returning the
+// contents of dir with directories ending in a slash
+func listRemoteDir(ctx compContext, instance, dir string, hidden bool) ([]string, error) {
+	lsFlags := "-1p"
+	if hidden {
+		lsFlags = "-1pA"
+	}
+	target := "."
+	if dir != "" {
+		target = dir
+	}
+
+	args, env := boshCLIFlags(ctx, remoteListingFlags...)
+	args = append(args, "ssh", instance, "--results", "--json",
+		"-c", fmt.Sprintf("ls %s '%s'", lsFlags, strings.Replace(target, "'", `'\''`, -1)),
+	)
+
+	log.Write("Listing remote directory with: bosh %s", strings.Join(args, " "))
+	cmd := exec.CommandContext(ctx.Context, "bosh", args...)
+	cmd.Env = env
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	results := struct {
+		Tables []struct {
+			Rows []map[string]interface{}
+		}
+	}{}
+	err = json.Unmarshal(output, &results)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse output of bosh ssh: %s", err)
+	}
+
+	//A group runs the command on every instance, but one listing is plenty
+	stdout := ""
+	for _, table := range results.Tables {
+		for _, row := range table.Rows {
+			if stdout == "" {
+				stdout, _ = row["stdout"].(string)
+			}
+		}
+	}
+
+	ret := []string{}
+	for _, name := range strings.Split(stdout, "\n") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			ret = append(ret, dir+name)
+		}
+	}
+
+	return ret, nil
+}
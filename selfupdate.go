@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	fp "path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomasmitchell/bosh-complete/version"
+)
+
+const (
+	latestReleaseURL = "https://api.github.com/repos/thomasmitchell/bosh-complete/releases/latest"
+	//The release asset listing the SHA-256 of every binary in the release, as
+	// made by `make checksums'
+	checksumsAssetName = "sha256sums.txt"
+	selfUpdateTimeout  = 2 * time.Minute
+	//Far more than a binary should ever be
+	maxReleaseAssetSize = 256 * 1024 * 1024
+)
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r githubRelease) assetURL(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, true
+		}
+	}
+	return "", false
+}
+
+//releaseVersionRegex matches semantic versions like 1.2.3 or 1.3.0-rc.1
+var releaseVersionRegex = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+//compareReleaseVersions returns whether a is older (-1), the same as (0), or
+// newer than (1) b, going by semantic versioning. It returns false if either
+// isn't a semantic version (e.g. a development build)
+func compareReleaseVersions(a, b string) (int, bool) {
+	am, bm := releaseVersionRegex.FindStringSubmatch(a), releaseVersionRegex.FindStringSubmatch(b)
+	if am == nil || bm == nil {
+		return 0, false
+	}
+
+	for i := 1; i <= 3; i++ {
+		an, _ := strconv.Atoi(am[i])
+		bn, _ := strconv.Atoi(bm[i])
+		if an != bn {
+			return compareInts(an, bn), true
+		}
+	}
+
+	//A pre-release comes before the release itself
+	switch {
+	case am[4] == bm[4]:
+		return 0, true
+	case am[4] == "":
+		return 1, true
+	case bm[4] == "":
+		return -1, true
+	}
+
+	aIDs, bIDs := strings.Split(am[4], "."), strings.Split(bm[4], ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		if aIDs[i] == bIDs[i] {
+			continue
+		}
+		//Numeric identifiers sort as numbers, and before anything else
+		an, aErr := strconv.Atoi(aIDs[i])
+		bn, bErr := strconv.Atoi(bIDs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return compareInts(an, bn), true
+		case aErr == nil:
+			return -1, true
+		case bErr == nil:
+			return 1, true
+		case aIDs[i] < bIDs[i]:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+	return compareInts(len(aIDs), len(bIDs)), true
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+//shouldUpdate decides whether to replace the current version with the latest
+// release, saying why not if it shouldn't. Without force, it only ever moves
+// to a newer release: never back to an older one, and never away from a build
+// whose version can't be compared, like a development build
+func shouldUpdate(current, latest string, force bool) (bool, string) {
+	if force {
+		return true, ""
+	}
+
+	cmp, ok := compareReleaseVersions(current, latest)
+	switch {
+	case !ok:
+		return false, fmt.Sprintf("Can't tell whether bosh-complete %s is older than release %s, so not updating. Give --force to install %s anyway", current, latest, latest)
+	case cmp == 0:
+		return false, fmt.Sprintf("bosh-complete %s is the latest release", current)
+	case cmp > 0:
+		return false, fmt.Sprintf("bosh-complete %s is newer than the latest release (%s), so not updating. Give --force to go back to %s", current, latest, latest)
+	}
+	return true, ""
+}
+
+//releaseAssetName is what the binary for this platform is called in a release
+func releaseAssetName() string {
+	if runtime.GOOS == "windows" {
+		return "bosh-complete-windows.exe"
+	}
+	return fmt.Sprintf("bosh-complete-%s", runtime.GOOS)
+}
+
+//doSelfUpdate replaces the running binary with the one from the latest GitHub
+// release, if it's newer, after checking it against the release's checksums
+func doSelfUpdate(force bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), selfUpdateTimeout)
+	defer cancel()
+
+	releaseURL := envString("BOSH_COMPLETE_RELEASES_URL", latestReleaseURL)
+	release := githubRelease{}
+	body, err := downloadReleaseAsset(ctx, releaseURL)
+	if err == nil {
+		err = json.Unmarshal(body, &release)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not find the latest release: %s\n", err)
+		os.Exit(1)
+	}
+
+	latest := strings.TrimPrefix(release.TagName, "v")
+	if update, reason := shouldUpdate(version.Version, latest, force); !update {
+		fmt.Printf("%s\n", reason)
+		return
+	}
+
+	//Releases are only built for amd64
+	assetName := releaseAssetName()
+	assetURL, found := release.assetURL(assetName)
+	if !found || runtime.GOARCH != "amd64" {
+		fmt.Fprintf(os.Stderr, "Release %s has no binary for %s/%s\n", release.TagName, runtime.GOOS, runtime.GOARCH)
+		os.Exit(1)
+	}
+	checksumsURL, found := release.assetURL(checksumsAssetName)
+	if !found {
+		fmt.Fprintf(os.Stderr, "Release %s has no %s to check the binary against\n", release.TagName, checksumsAssetName)
+		os.Exit(1)
+	}
+
+	checksums, err := downloadReleaseAsset(ctx, checksumsURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not download checksums: %s\n", err)
+		os.Exit(1)
+	}
+	sum, found := parseChecksums(checksums)[assetName]
+	if !found {
+		fmt.Fprintf(os.Stderr, "%s has no checksum for %s\n", checksumsAssetName, assetName)
+		os.Exit(1)
+	}
+
+	binary, err := downloadReleaseAsset(ctx, assetURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not download %s: %s\n", assetName, err)
+		os.Exit(1)
+	}
+	actual := sha256.Sum256(binary)
+	if hex.EncodeToString(actual[:]) != sum {
+		fmt.Fprintf(os.Stderr, "Checksum of the downloaded %s doesn't match. Not updating\n", assetName)
+		os.Exit(1)
+	}
+
+	me, err := executablePath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not find this binary: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = replaceExecutable(me, binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not replace `%s': %s\n", me, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Updated `%s' from %s to %s\n", me, version.Version, latest)
+}
+
+//replaceExecutable puts binary where the running executable is. Windows won't
+// let a running executable be written over, or renamed over, but will let it
+// be moved aside. What's moved aside can't be deleted until it has exited, so
+// it's left for the next update to clean up
+func replaceExecutable(me string, binary []byte) error {
+	if runtime.GOOS != "windows" {
+		return writeFileAtomicMode(me, binary, 0755)
+	}
+
+	aside := me + ".old"
+	_ = os.Remove(aside)
+	err := os.Rename(me, aside)
+	if err != nil {
+		return fmt.Errorf("Could not move the running binary aside: %s", err)
+	}
+
+	err = writeFileAtomicMode(me, binary, 0755)
+	if err != nil {
+		if restoreErr := os.Rename(aside, me); restoreErr != nil {
+			return fmt.Errorf("%s (and could not put the old binary back from `%s': %s)", err, aside, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func downloadReleaseAsset(ctx context.Context, assetURL string) ([]byte, error) {
+	req, err := http.NewRequest("GET", assetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	//GitHub is out on the internet, so it's not reached through a jumpbox
+	// meant for the director
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s returned status %d", assetURL, resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxReleaseAssetSize))
+}
+
+//parseChecksums reads sha256sum output, which has lines like
+// `<hex digest>  <file name>', into digests by file name
+func parseChecksums(checksums []byte) map[string]string {
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		//sha256sum puts a * in front of files it read in binary mode
+		ret[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return ret
+}
+
+//executablePath is where the running binary really is, following symlinks so
+// that a link into e.g. ~/bin doesn't get replaced by the binary itself
+func executablePath() (string, error) {
+	location, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < 32; i++ {
+		target, err := os.Readlink(location)
+		if err != nil {
+			//Not a symlink
+			return location, nil
+		}
+		location = linkTarget(location, target)
+	}
+
+	return "", fmt.Errorf("Too many symlinks to `%s'", location)
+}
+
+//linkTarget is where a symlink at location to target leads, which is
+// relative to the symlink's directory unless target is absolute
+func linkTarget(location, target string) string {
+	if fp.IsAbs(target) {
+		return target
+	}
+	return fp.Join(fp.Dir(location), target)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	fp "path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCompareReleaseVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"1.2.3", "1.2.3", 0, true},
+		{"1.2.3", "v1.2.3", 0, true},
+		{"1.2.3", "1.2.4", -1, true},
+		{"1.10.0", "1.9.0", 1, true},
+		{"2.0.0", "1.99.99", 1, true},
+		{"1.3.0-rc.1", "1.3.0", -1, true},
+		{"1.3.0", "1.3.0-rc.1", 1, true},
+		{"1.3.0-rc.2", "1.3.0-rc.10", -1, true},
+		{"1.3.0-rc.1", "1.3.0-beta", 1, true},
+		{"1.3.0-1", "1.3.0-alpha", -1, true},
+		{"1.3.0-rc", "1.3.0-rc.1", -1, true},
+		{"1.3.0-rc.1", "1.2.9", 1, true},
+		{"1.2.3+build.5", "1.2.3", 0, true},
+
+		{"dev", "1.2.3", 0, false},
+		{"development", "1.2.3", 0, false},
+		{"1.2", "1.2.3", 0, false},
+		{"1.2.3", "latest", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := compareReleaseVersions(test.a, test.b)
+		if ok != test.ok || got != test.want {
+			t.Errorf("compareReleaseVersions(%q, %q) = %d, %t; want %d, %t", test.a, test.b, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestShouldUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		latest  string
+		force   bool
+		want    bool
+	}{
+		{"older", "1.2.3", "1.3.0", false, true},
+		{"release candidate of the latest", "1.3.0-rc.1", "1.3.0", false, true},
+		{"the latest", "1.3.0", "1.3.0", false, false},
+		{"newer", "1.4.0", "1.3.0", false, false},
+		{"release candidate ahead of the latest", "1.4.0-rc.1", "1.3.0", false, false},
+		{"development build", "dev", "1.3.0", false, false},
+		{"unparseable release", "1.3.0", "nightly", false, false},
+
+		{"forced to the latest", "1.3.0", "1.3.0", true, true},
+		{"forced downgrade", "1.4.0", "1.3.0", true, true},
+		{"forced from a development build", "dev", "1.3.0", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, reason := shouldUpdate(test.current, test.latest, test.force)
+			if got != test.want {
+				t.Errorf("shouldUpdate(%q, %q, %t) = %t (%s); want %t", test.current, test.latest, test.force, got, reason, test.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("Expected a reason not to update")
+			}
+		})
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	got := parseChecksums([]byte(
+		"ABCDEF  bosh-complete-darwin\n" +
+			"123456 *bosh-complete-windows.exe\n" +
+			"\n" +
+			"not a checksum line\n"))
+
+	if len(got) != 2 || got["bosh-complete-darwin"] != "abcdef" || got["bosh-complete-windows.exe"] != "123456" {
+		t.Errorf("Got %v", got)
+	}
+}
+
+func TestLinkTarget(t *testing.T) {
+	tests := []struct {
+		goos     string
+		location string
+		target   string
+		want     string
+	}{
+		{"", "/usr/local/bin/bosh-complete", "/opt/bosh-complete/bin/bosh-complete", "/opt/bosh-complete/bin/bosh-complete"},
+		{"", "/usr/local/bin/bosh-complete", "../libexec/bosh-complete", "/usr/local/libexec/bosh-complete"},
+		{"", "/usr/local/bin/bosh-complete", "bosh-complete-1.2.3", "/usr/local/bin/bosh-complete-1.2.3"},
+
+		{"windows", `C:\Users\me\bin\bosh-complete.exe`, `D:\tools\bosh-complete.exe`, `D:\tools\bosh-complete.exe`},
+		{"windows", `C:\Users\me\bin\bosh-complete.exe`, `..\tools\bosh-complete.exe`, `C:\Users\me\tools\bosh-complete.exe`},
+	}
+
+	for _, test := range tests {
+		if (test.goos == "windows") != (runtime.GOOS == "windows") {
+			continue
+		}
+		if got := linkTarget(test.location, test.target); got != test.want {
+			t.Errorf("linkTarget(%q, %q) = %q; want %q", test.location, test.target, got, test.want)
+		}
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	//With the OS's own separators, which on Windows aren't slashes
+	me := fp.Join(t.TempDir(), "bosh-complete")
+	err := ioutil.WriteFile(me, []byte("old"), 0755)
+	if err != nil {
+		t.Fatalf("Could not write %s: %s", me, err)
+	}
+
+	err = replaceExecutable(me, []byte("new"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(me)
+	if err != nil || string(contents) != "new" {
+		t.Errorf("Expected the new binary, got %q (%v)", contents, err)
+	}
+
+	if runtime.GOOS == "windows" {
+		contents, err = ioutil.ReadFile(me + ".old")
+		if err != nil || string(contents) != "old" {
+			t.Errorf("Expected the old binary moved aside, got %q (%v)", contents, err)
+		}
+	}
+}
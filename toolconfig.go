@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+//toolConfig is bosh-complete's own configuration, as opposed to the bosh CLI
+// config that it reads environments from
+type toolConfig struct {
+	UAAClient       string `yaml:"uaa_client"`
+	UAAClientSecret string `yaml:"uaa_client_secret"`
+	//How long a whole completion gets (e.g. "5s")
+	Timeout string `yaml:"timeout"`
+	//How long a completion waits on the director before settling for what's
+	// cached (e.g. "500ms")
+	Budget string `yaml:"budget"`
+	//Where responses and the like are kept, instead of the XDG cache directory
+	CacheDir string `yaml:"cache_dir"`
+	//What gets logged (off, error, debug, or trace), and where to
+	LogLevel string `yaml:"log_level"`
+	LogFile  string `yaml:"log_file"`
+	//How long cached responses are good for, by kind of data (deployments,
+	// instances, releases, stemcells, tasks, events, configs, auth, or default
+	// for everything else but auth)
+	TTL map[string]string `yaml:"ttl"`
+	//Whether to ask bosh.io about stemcells and releases when completing
+	// uploads of them
+	BoshIO bool `yaml:"boshio"`
+	//Whether to ask the director's CredHub for the names of variables
+	CredHub bool `yaml:"credhub"`
+	//Whether to run `bosh ssh' to list what's on an instance when completing
+	// the remote paths of scp
+	SCPListing bool `yaml:"scp_ls"`
+	//Whether to keep responses on disk between completions. Defaults to true
+	DiskCache *bool `yaml:"disk_cache"`
+	//Whether to learn commands and flags from the bosh CLI's help. Defaults to
+	// true
+	CLIHelp *bool `yaml:"cli_help"`
+	//How what's typed is matched against candidates (prefix, ignore-case,
+	// substring, or fuzzy)
+	Match string `yaml:"match"`
+	//Whether to complete from what's cached, however old, when the director
+	// fails. Defaults to true
+	StaleOnError *bool `yaml:"stale_on_error"`
+	//Whether to only ever complete from what's cached
+	Offline bool `yaml:"offline"`
+	//Whether `bosh-complete login' keeps passwords, secrets, and tokens in the
+	// OS keychain rather than in its file. Defaults to true
+	Keychain *bool `yaml:"keychain"`
+	//How to ask the director: api, cli (through `bosh --json'), auto (the API,
+	// falling back to the CLI), or bosh-cli (the bosh CLI's director client,
+	// in builds with -tags boshcli)
+	Backend string `yaml:"backend"`
+	//Settings for specific environments, keyed by alias or URL. These win over
+	// the top-level settings
+	Environments map[string]toolEnvironment `yaml:"environments"`
+	//What was wrong with the config, if it couldn't be used
+	Problems []string `yaml:"-"`
+}
+
+type toolEnvironment struct {
+	UAAClient       string `yaml:"uaa_client"`
+	UAAClientSecret string `yaml:"uaa_client_secret"`
+	//The port to use when the environment's URL doesn't have one
+	Port int `yaml:"port"`
+	//The CA cert (or a path to it) to use instead of the one in the bosh
+	// config
+	CACert string `yaml:"ca_cert"`
+	//Whether to not check the director's certificate at all
+	SkipSSLValidation bool `yaml:"skip_ssl_validation"`
+	//A jumpbox to go through, given the same way as $BOSH_ALL_PROXY, or a
+	// SOCKS5 proxy (socks5://host:port) that's already tunneling to one
+	Proxy string `yaml:"proxy"`
+}
+
+var toolCfg *toolConfig
+var toolCfgOnce sync.Once
+
+func toolConfigPath() string {
+	if path := os.Getenv("BOSH_COMPLETE_CONFIG"); path != "" {
+		return path
+	}
+
+	return fmt.Sprintf("%s/config.yml", configDir())
+}
+
+//getToolConfig returns the tool config, reading it in the first time. A
+// broken config shouldn't stop completion, so problems are only logged, and
+// leave the settings at their defaults
+func getToolConfig() *toolConfig {
+	toolCfgOnce.Do(func() {
+		toolCfg = &toolConfig{}
+		location := toolConfigPath()
+		contents, err := ioutil.ReadFile(location)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Write("Could not read config `%s': %s", location, err)
+				toolCfg.Problems = []string{err.Error()}
+			}
+			return
+		}
+
+		err = yaml.Unmarshal(contents, toolCfg)
+		if err != nil {
+			log.Write("Could not parse config `%s': %s", location, err)
+			toolCfg = &toolConfig{Problems: []string{err.Error()}}
+		}
+	})
+
+	return toolCfg
+}
+
+//environment returns the settings for the environment with the given alias or
+// URL, with the top-level settings filled in wherever it doesn't set its own
+func (t *toolConfig) environment(alias, url string) toolEnvironment {
+	ret, found := t.Environments[alias]
+	if !found || alias == "" {
+		ret = t.Environments[url]
+	}
+
+	if ret.UAAClient == "" {
+		ret.UAAClient, ret.UAAClientSecret = t.UAAClient, t.UAAClientSecret
+	}
+
+	return ret
+}
+
+//envBool returns the boolean setting in the given environment variable, or
+// configured if the variable isn't set (or isn't a boolean)
+func envBool(envvar string, configured bool) bool {
+	val := os.Getenv(envvar)
+	if val == "" {
+		return configured
+	}
+
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Write("Ignoring invalid value for %s: `%s'", envvar, val)
+		return configured
+	}
+
+	return enabled
+}
+
+//envString returns the setting in the given environment variable, or
+// configured if the variable isn't set
+func envString(envvar, configured string) string {
+	if val := os.Getenv(envvar); val != "" {
+		return val
+	}
+	return configured
+}
+
+//orDefault is for the settings that are on unless the config says otherwise
+func orDefault(setting *bool, def bool) bool {
+	if setting == nil {
+		return def
+	}
+	return *setting
+}
@@ -2,3 +2,17 @@ package version
 
 //Version is the version of this binary
 var Version = "dev"
+
+//Commit is the git commit that this binary was built from, with a + on the end
+// if there were uncommitted changes
+var Commit = "unknown"
+
+//BuildDate is when this binary was built
+var BuildDate = "unknown"
+
+//The range of bosh CLI versions whose commands and flags completion lines up
+// with
+const (
+	MinBoshCLIVersion = "6.0.0"
+	MaxBoshCLIVersion = "7.x"
+)
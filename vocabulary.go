@@ -0,0 +1,38 @@
+package main
+
+//The fixed sets of values that the bosh CLI (or the director behind it)
+// accepts, by what they're for
+var vocabularies = map[string][]string{
+	"config-types": {"cloud", "runtime", "cpi"},
+	//The actions that the director records events for
+	"event-actions": {
+		"acquire", "cleanup ssh", "create", "delete", "recreate", "release",
+		"restart", "run", "setup ssh", "start", "stop", "update",
+	},
+	//The kinds of object that the director records events about
+	"event-object-types": {
+		"cloud-config", "cpi-config", "deployment", "disk", "errand", "instance",
+		"lock", "network", "release", "runtime-config", "snapshot", "stemcell",
+		"user", "variable", "vm",
+	},
+	"http-methods": {"GET", "POST", "PUT", "DELETE"},
+	"on-off":       {"on", "off"},
+	//Every resolution that the director has for cloud-check problems
+	"resolutions": {
+		"ignore", "reboot_vm", "recreate_vm", "recreate_vm_without_wait",
+		"delete_vm", "delete_vm_reference", "delete_disk_reference",
+		"reattach_disk", "reattach_disk_and_reboot",
+	},
+	//Every state that a director task can be in
+	"task-states": {"processing", "queued", "cancelling", "cancelled", "done", "error", "timeout"},
+}
+
+//compVocabulary offers the values of the named vocabulary
+func compVocabulary(name string) compFunc {
+	values, found := vocabularies[name]
+	if !found {
+		panic("Unknown vocabulary: " + name)
+	}
+
+	return compEnum(values...)
+}
@@ -1,35 +1,36 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
 	"text/template"
 )
 
-var zshSource = fmt.Sprintf(`
+//The line up to the cursor is rebuilt from the words, quotes and all, so that
+// bosh-complete can split it up the same way it does bash's COMP_LINE
+var zshSource = `
 #compdef {{.Bosh}}
-autoload -U compinit && compinit
-autoload -U bashcompinit && bashcompinit
+(( $+functions[compdef] )) || { autoload -U compinit && compinit }
 
-_bosh_comp() {
-	local output="$({{.Executable}} complete {{.Debug}} -- ${COMP_WORDS[@]:0:$COMP_CWORD} "${COMP_WORDS[$COMP_CWORD]}")"
-	COMPREPLY=()
-	local TMPIFS="$IFS"
-	IFS=''
-  while read -r line; do
-		if [[ -n "$line" ]]; then
-      COMPREPLY+=("$line")
-    fi
-	done <<< "$output"
-	IFS="$TMPIFS"
+_bosh_complete() {
+	local before="${(j: :)words[1,CURRENT-1]} $PREFIX"
+	local after="$SUFFIX ${(j: :)words[CURRENT+1,-1]}"
+	local -a lines candidates
+	lines=("${(@f)$(COMP_LINE="$before$after" COMP_POINT="${#before}" {{.Executable}} complete --shell zsh {{.Debug}} -- "${(@)words[1,CURRENT-1]}" "$PREFIX")}")
+	(( ${#lines} > 1 )) || return 1
+
+	local -a describeOpts
+	candidates=("${(@)lines[2,-1]}")
+	[[ "${lines[1]}" == nospace* ]] && describeOpts+=(-S '')
+	[[ "${lines[1]}" == *unfiltered ]] && describeOpts+=(-U)
+	_describe -t values '{{.Bosh}}' candidates "${describeOpts[@]}"
 }
 
-complete -o nospace -F _bosh_comp {{.Bosh}}
-`)
+compdef _bosh_complete {{.Bosh}}
+`
 
 func doZshSource() {
-	tmpl := template.Must(template.New("bash_source").Parse(zshSource))
+	tmpl := template.Must(template.New("zsh_source").Parse(zshSource))
 	me, err := os.Executable()
 	debug := ""
 	if opts.Debug {